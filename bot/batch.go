@@ -0,0 +1,235 @@
+package bot
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jriddick/geoffrey/irc"
+	"github.com/jriddick/geoffrey/msg"
+)
+
+// batches holds the open batches and the requests that
+// are waiting for a reply from the server
+type batches struct {
+	sync.Mutex
+	open    map[string]*msg.Message
+	labels  map[string]chan []*msg.Message
+	echoes  []*echo
+	counter uint64
+}
+
+// echo is a message waiting to be echoed by the server
+type echo struct {
+	message *msg.Message
+	done    chan struct{}
+}
+
+// resetBatches drops all open batches
+func (b *Bot) resetBatches() {
+	b.batches.Lock()
+	b.batches.open = nil
+	b.batches.Unlock()
+}
+
+// process groups batches, resolves labeled replies and
+// suppresses our own echoed messages. It returns the
+// messages that should be passed on to the handlers.
+func (b *Bot) process(message *msg.Message) []*msg.Message {
+	b.batches.Lock()
+	defer b.batches.Unlock()
+
+	if b.batches.open == nil {
+		b.batches.open = make(map[string]*msg.Message)
+	}
+
+	// Start and end batches
+	if message.Command == irc.Batch && len(message.Params) > 0 {
+		ref := message.Params[0]
+
+		if strings.HasPrefix(ref, "+") {
+			b.batches.open[ref[1:]] = message
+			return nil
+		}
+
+		start, ok := b.batches.open[strings.TrimPrefix(ref, "-")]
+		if !ok {
+			return nil
+		}
+		delete(b.batches.open, strings.TrimPrefix(ref, "-"))
+
+		// Nested batches are part of their parent
+		if parent, ok := b.batches.open[start.Tags[msg.BatchTag]]; ok {
+			parent.Batch = append(parent.Batch, start)
+			return nil
+		}
+
+		if label, ok := start.Tags[msg.LabelTag]; ok {
+			b.resolve(label, start.Batch)
+		}
+
+		return []*msg.Message{start}
+	}
+
+	// Collect the messages of open batches
+	if ref, ok := message.Tags[msg.BatchTag]; ok {
+		if batch, ok := b.batches.open[ref]; ok {
+			batch.Batch = append(batch.Batch, message)
+			return nil
+		}
+	}
+
+	// Resolve the labeled replies
+	if label, ok := message.Tags[msg.LabelTag]; ok {
+		if message.Command == irc.Ack {
+			b.resolve(label, nil)
+			return nil
+		}
+
+		b.resolve(label, []*msg.Message{message})
+	}
+
+	// Suppress the messages we sent ourselves
+	if b.isEcho(message) {
+		if _, ok := message.Tags[msg.LabelTag]; !ok {
+			b.confirm(message)
+		}
+		return nil
+	}
+
+	return []*msg.Message{message}
+}
+
+// isEcho returns true if the message is an echo of our own
+func (b *Bot) isEcho(message *msg.Message) bool {
+	if message.Command != irc.Message && message.Command != irc.Notice && message.Command != "TAGMSG" {
+		return false
+	}
+
+	return message.Prefix != nil && b.IsMe(message.Prefix.Name) && b.HasCapability("echo-message")
+}
+
+// resolve passes the reply to the request with the label
+func (b *Bot) resolve(label string, reply []*msg.Message) {
+	if waiting, ok := b.batches.labels[label]; ok {
+		waiting <- reply
+		delete(b.batches.labels, label)
+	}
+}
+
+// confirm marks the first matching unlabeled message as delivered
+func (b *Bot) confirm(message *msg.Message) {
+	for i, pending := range b.batches.echoes {
+		if pending.message.Command == message.Command &&
+			strings.EqualFold(pending.message.Param(0), message.Param(0)) &&
+			pending.message.LastParam() == message.LastParam() {
+			close(pending.done)
+			b.batches.echoes = append(b.batches.echoes[:i], b.batches.echoes[i+1:]...)
+			return
+		}
+	}
+}
+
+// label returns a new unique label
+func (b *Bot) label() string {
+	b.batches.counter++
+	return "g" + strconv.FormatUint(b.batches.counter, 36)
+}
+
+// Request sends the message with a label and waits for the
+// server to reply. The reply is a single message, all the
+// messages of a labeled batch, or empty when the server only
+// acknowledged the message. It requires labeled-response.
+func (b *Bot) Request(ctx context.Context, message *msg.Message) ([]*msg.Message, error) {
+	if !b.HasCapability("labeled-response") {
+		return nil, ErrNoLabeledResponse
+	}
+
+	// Label a copy so the caller can reuse the message
+	labeled := *message
+	labeled.Tags = make(msg.Tags, len(message.Tags)+1)
+	for key, value := range message.Tags {
+		labeled.Tags[key] = value
+	}
+
+	reply := make(chan []*msg.Message, 1)
+
+	b.batches.Lock()
+	if b.batches.labels == nil {
+		b.batches.labels = make(map[string]chan []*msg.Message)
+	}
+	label := b.label()
+	labeled.Tags[msg.LabelTag] = label
+	b.batches.labels[label] = reply
+	b.batches.Unlock()
+
+	if err := b.SendMessage(&labeled); err != nil {
+		b.forget(label)
+		return nil, err
+	}
+
+	select {
+	case messages := <-reply:
+		return messages, nil
+	case <-ctx.Done():
+		b.forget(label)
+		return nil, ctx.Err()
+	}
+}
+
+// forget stops waiting for the label
+func (b *Bot) forget(label string) {
+	b.batches.Lock()
+	delete(b.batches.labels, label)
+	b.batches.Unlock()
+}
+
+// Deliver sends the message and waits until the server has
+// echoed it back. Without echo-message it returns as soon as
+// the message has been queued.
+func (b *Bot) Deliver(ctx context.Context, message *msg.Message) error {
+	if !b.HasCapability("echo-message") {
+		return b.SendMessage(message)
+	}
+
+	if b.HasCapability("labeled-response") {
+		_, err := b.Request(ctx, message)
+		return err
+	}
+
+	pending := &echo{
+		message: message,
+		done:    make(chan struct{}),
+	}
+
+	b.batches.Lock()
+	b.batches.echoes = append(b.batches.echoes, pending)
+	b.batches.Unlock()
+
+	if err := b.SendMessage(message); err != nil {
+		b.abandon(pending)
+		return err
+	}
+
+	select {
+	case <-pending.done:
+		return nil
+	case <-ctx.Done():
+		b.abandon(pending)
+		return ctx.Err()
+	}
+}
+
+// abandon stops waiting for the echo
+func (b *Bot) abandon(pending *echo) {
+	b.batches.Lock()
+	defer b.batches.Unlock()
+
+	for i, other := range b.batches.echoes {
+		if other == pending {
+			b.batches.echoes = append(b.batches.echoes[:i], b.batches.echoes[i+1:]...)
+			return
+		}
+	}
+}
@@ -2,15 +2,16 @@ package bot
 
 import (
 	"fmt"
-	"net"
-	"strings"
+	"os"
+	"sync"
 
 	"time"
 
-	badger "github.com/dgraph-io/badger/v2"
 	"github.com/jpillora/backoff"
 	"github.com/jriddick/geoffrey/irc"
 	"github.com/jriddick/geoffrey/msg"
+	"github.com/jriddick/geoffrey/storage"
+	"github.com/jriddick/geoffrey/transcript"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -21,37 +22,138 @@ type MessageHandler func(*Bot, string)
 // Bot is the structure for an IRC bot
 type Bot struct {
 	client       *irc.IRC
-	writer       chan<- string
+	writer       chan<- *msg.Message
 	reader       <-chan *msg.Message
 	stop         chan struct{}
 	config       Config
 	disconnected chan struct{}
-	db           *badger.DB
+	store        storage.Store
+	clock        Clock
+	handlers     sync.WaitGroup
+	transcript   *os.File
+	channels     map[string]*Channel
+	channelsLock sync.RWMutex
+	admins       *msg.MaskSet
+	caps         capabilities
+	batches      batches
+	isupport     isupport
+	users        users
+	queries      queries
+	reconnects   backoff.Backoff
 }
 
-// NewBot creates a new bot
+// NewBot creates a new bot. The configuration is validated
+// first and ConfigErrors is returned if it is invalid.
 func NewBot(config Config) (*Bot, error) {
-	// Open badger
-	db, err := badger.Open(badger.DefaultOptions(config.Database))
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	// Record the session when asked to
+	var recorder *transcript.Recorder
+	var file *os.File
+	var err error
+
+	if config.Transcript != "" {
+		if file, err = os.OpenFile(config.Transcript, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600); err != nil {
+			return nil, err
+		}
+
+		recorder = transcript.NewRecorder(file, config.Services.Password)
+	}
+
+	// Open the database
+	store, err := storage.Open(config.Database)
 
 	if err != nil {
+		if file != nil {
+			file.Close()
+		}
 		return nil, err
 	}
 
+	// Create the client
+	client := irc.NewIRC(irc.Config{
+		Hostname:           config.Hostname,
+		Port:               config.Port,
+		Secure:             config.Secure.Enable,
+		InsecureSkipVerify: !config.Secure.Verify,
+		Timeout:            time.Millisecond * time.Duration(config.Timings.Timeout),
+		MessagesPerSecond:  config.Limits.Messages,
+		Encoding:           config.Encoding.Default,
+		Fallback:           config.Encoding.Fallback,
+		ChannelEncodings:   config.Encoding.Channels,
+		Recorder:           recorder,
+	})
+
 	// Create the bot
+	bot, err := newBot(config, client, store)
+
+	if err != nil {
+		store.Close()
+		if file != nil {
+			file.Close()
+		}
+		return nil, err
+	}
+
+	bot.transcript = file
+
+	return bot, nil
+}
+
+// NewOfflineBot creates a bot that is not connected to a server.
+// The messages sent by the bot are written to the writer, and the
+// timers of the bot and its plugins are driven by the clock. The
+// bottest package uses it to test plugins without a server.
+func NewOfflineBot(config Config, store storage.Store, clock Clock, writer chan<- *msg.Message) (*Bot, error) {
+	bot, err := newBot(config, nil, store)
+
+	if err != nil {
+		return nil, err
+	}
+
+	bot.clock = clock
+	bot.writer = writer
+
+	return bot, nil
+}
+
+// newBot creates the bot and loads the tracked channels
+func newBot(config Config, client *irc.IRC, store storage.Store) (*Bot, error) {
+	// Compile the administrator masks
+	admins, err := msg.NewMaskSet(msg.RFC1459, config.Admins...)
+
+	if err != nil {
+		return nil, err
+	}
+
 	bot := &Bot{
-		client: irc.NewIRC(irc.Config{
-			Hostname:           config.Hostname,
-			Port:               config.Port,
-			Secure:             config.Secure.Enable,
-			InsecureSkipVerify: !config.Secure.Verify,
-			Timeout:            time.Millisecond * time.Duration(config.Timings.Timeout),
-			MessagesPerSecond:  config.Limits.Messages,
-		}),
+		client:       client,
 		config:       config,
 		stop:         make(chan struct{}),
 		disconnected: make(chan struct{}),
-		db:           db,
+		store:        store,
+		clock:        systemClock{},
+		channels:     make(map[string]*Channel),
+		admins:       admins,
+		reconnects: backoff.Backoff{
+			Min:    time.Second,
+			Max:    5 * time.Minute,
+			Jitter: true,
+		},
+	}
+
+	// Track the configured channels
+	for _, entry := range config.Channels {
+		if channel := ParseChannel(entry); channel.Name != "" {
+			bot.Track(channel.Name, channel.Key)
+		}
+	}
+
+	// Merge with the channels managed at runtime
+	if err := bot.loadChannels(); err != nil {
+		return nil, err
 	}
 
 	return bot, nil
@@ -68,6 +170,10 @@ func (b *Bot) Connect() error {
 	b.writer = b.client.Writer()
 	b.reader = b.client.Reader()
 
+	// Negotiate the capabilities before registering
+	b.resetBatches()
+	b.requestCapabilities()
+
 	return nil
 }
 
@@ -79,31 +185,79 @@ func (b *Bot) Handler() {
 		case <-b.stop:
 			// Disconnect the client
 			b.client.Disconnect("Closed")
-			break
+
+			// Stop recording the session
+			if b.transcript != nil {
+				b.transcript.Close()
+			}
+			return
 		case message := <-b.reader:
-			// Log all messages
-			log.Debugln(message.String())
-
-			// Get all handlers for this event
-			if handlers, ok := Handlers[message.Command]; ok {
-				// Go through all configured handlers
-				for _, name := range b.config.Plugins {
-					// Run the handler if we found it
-					if handler, ok := handlers[name]; ok {
-						go func(bot *Bot, msg *msg.Message, handler Handler) {
-							// Mark start time
-							start := time.Now()
-
-							// Execute the handler
-							if _, err := handler.Run(b, msg); err != nil {
-								log.Errorf("[%s] %v", handler.Name, err)
-							} else {
-								// Log the execution time
-								log.Infof("Handler '%s' completed in %s", handler.Name, time.Since(start))
-							}
-						}(b, message, handler)
+			b.handle(message)
+		}
+	}
+}
+
+// handle passes the message through the trackers and runs
+// the handlers of the message
+func (b *Bot) handle(message *msg.Message) {
+	// Log all messages
+	log.Debugln(irc.StripFormatting(message.String()))
+
+	// Reconnects start over once we have registered
+	if message.Command == irc.Welcome {
+		b.reconnects.Reset()
+	}
+
+	// Update the tracked channels and their timed bans
+	b.trackChannels(message)
+	b.trackBans(message)
+
+	// Update the server features and the tracked users
+	b.trackISupport(message)
+	b.trackUsers(message)
+
+	// Pass the replies to the query in flight
+	b.collect(message)
+
+	// Update the negotiated capabilities
+	b.negotiate(message)
+
+	// Group batches and drop our own echoes
+	for _, message := range b.process(message) {
+		b.dispatch(message)
+	}
+}
+
+// Handle passes the message to the bot as if it had been read
+// from the server and waits until the handlers have returned
+func (b *Bot) Handle(message *msg.Message) {
+	b.handle(message)
+	b.handlers.Wait()
+}
+
+// dispatch runs the configured handlers for the message
+func (b *Bot) dispatch(message *msg.Message) {
+	// Get all handlers for this event
+	if handlers, ok := Handlers[message.Command]; ok {
+		// Go through all configured handlers
+		for _, name := range b.config.Plugins {
+			// Run the handler if we found it
+			if handler, ok := handlers[name]; ok {
+				b.handlers.Add(1)
+				go func(bot *Bot, msg *msg.Message, handler Handler) {
+					defer b.handlers.Done()
+
+					// Mark start time
+					start := time.Now()
+
+					// Execute the handler
+					if _, err := handler.Run(b, msg); err != nil {
+						log.Errorf("[%s] %v", handler.Name, err)
+					} else {
+						// Log the execution time
+						log.Infof("Handler '%s' completed in %s", handler.Name, time.Since(start))
 					}
-				}
+				}(b, message, handler)
 			}
 		}
 	}
@@ -114,59 +268,89 @@ func (b *Bot) ErrorHandler() {
 	for {
 		select {
 		case <-b.stop:
-			break
+			return
 		case err := <-b.client.Errors():
 			// Log the error that we got
 			log.Errorf("[geoffrey] %v", err)
 
-			// Check if timeout error occured
-			if err, ok := err.(net.Error); ok && err.Timeout() {
-				// Try to reconnect the bot
+			// Reconnect when the connection has been lost
+			if _, ok := err.(*irc.ConnectionError); ok {
 				b.Reconnect()
 			}
 		}
 	}
 }
 
-// Reconnect will reconnect the bot to the server
+// Reconnect will reconnect the bot to the server. The wait
+// between attempts grows until the bot has registered again.
 func (b *Bot) Reconnect() {
-	// Create the reconnect rate limiter
-	rate := &backoff.Backoff{
-		Max:    5 * time.Minute,
-		Jitter: true,
-	}
-
 	for {
+		// Get the exponential backoff duration and sleep for that amount
+		duration := b.reconnects.Duration()
+		log.Infof("[geoffrey] Reconnecting in %s", duration)
+
 		select {
 		case <-b.stop:
-			break
-		default:
-			// Reconnect to the server
-			if err := b.client.Reconnect(); err != nil {
-				// Get the exponential backoff duration and sleep for that amount until retrying
-				duration := rate.Duration()
-				log.Errorf("[geoffrey] Reconnect failed (%v) retrying in %s", err, duration)
-				time.Sleep(duration)
-			}
-
 			return
+		case <-time.After(duration):
+		}
+
+		// Reconnect to the server
+		if err := b.client.Reconnect(); err != nil {
+			log.Errorf("[geoffrey] Reconnect failed: %v", err)
+			continue
 		}
+
+		// Negotiate the capabilities again
+		b.resetBatches()
+		b.requestCapabilities()
+
+		return
 	}
 }
 
 // Pinger will ping the server every 2 minutes
 func (b *Bot) Pinger() {
 	ticker := time.NewTicker(120 * time.Second)
+	defer ticker.Stop()
+
 	for {
 		select {
 		case <-b.stop:
-			break
+			return
 		case <-ticker.C:
 			b.Ping(fmt.Sprintf("%d", time.Now().UnixNano()))
 		}
 	}
 }
 
+// Compactor will compact the database every hour or at the
+// configured interval
+func (b *Bot) Compactor() {
+	interval := time.Hour
+	if b.config.Timings.Compaction > 0 {
+		interval = time.Millisecond * time.Duration(b.config.Timings.Compaction)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+			start := time.Now()
+
+			if err := storage.Compact(b.store); err != nil {
+				log.Errorf("[geoffrey] Could not compact the database: %v", err)
+			} else {
+				log.Debugf("[geoffrey] Compacted the database in %s", time.Since(start))
+			}
+		}
+	}
+}
+
 // InitHandlers will run Init on all registered handlers
 func (b *Bot) InitHandlers() {
 	for _, enabledHandler := range b.config.Plugins {
@@ -180,7 +364,6 @@ func (b *Bot) InitHandlers() {
 				} else {
 					log.Infof("[geoffrey] Initialized handler '%s' in %s", enabledHandler, time.Since(start))
 				}
-				break
 			}
 		} else {
 			log.Errorf("[geoffrey] Bot '%s' has enabled non-existing plugin '%s'", b.config.BotName, enabledHandler)
@@ -194,32 +377,87 @@ func (b *Bot) Run() {
 	b.InitHandlers()
 	go b.Handler()
 	go b.Pinger()
+	go b.Compactor()
 }
 
 // Send will send the given message to the given receiver
-func (b *Bot) Send(recv, msg string) {
-	b.writer <- fmt.Sprintf("PRIVMSG %s :%s", recv, msg)
+func (b *Bot) Send(recv, text string) error {
+	return b.SendMessage(msg.Privmsg(recv, text))
+}
+
+// Notice will send the given notice to the given receiver
+func (b *Bot) Notice(recv, text string) error {
+	return b.SendMessage(msg.Notice(recv, text))
+}
+
+// SendMessage will validate and send the message to the
+// server. Messages that could inject other commands, such
+// as text containing CR or LF, are never sent.
+func (b *Bot) SendMessage(message *msg.Message) error {
+	if err := message.Validate(); err != nil {
+		return err
+	}
+
+	b.writer <- message
+	return nil
 }
 
 // Join will join the given channel
 func (b *Bot) Join(channel string) {
-	// Make sure we have a hashtag
-	if !strings.HasPrefix(channel, "#") {
+	b.JoinKey(channel, "")
+}
+
+// JoinKey will join the given channel using the key and
+// track it so it is rejoined after reconnects
+func (b *Bot) JoinKey(channel, key string) {
+	// Make sure we have a channel prefix
+	if !b.IsChannel(channel) {
 		channel = "#" + channel
 	}
 
+	// Track the channel
+	b.Track(channel, key)
+
+	// Use the tracked key if none was given
+	if key == "" {
+		if tracked, ok := b.Channel(channel); ok {
+			key = tracked.Key
+		}
+	}
+
 	// Send the join command
-	b.writer <- fmt.Sprintf("JOIN %s", channel)
+	b.SendMessage(msg.Join(channel, key))
+}
+
+// After runs the function once the duration has passed
+// unless the bot has been closed before that
+func (b *Bot) After(duration time.Duration, f func()) {
+	b.clock.AfterFunc(duration, func() {
+		select {
+		case <-b.stop:
+		default:
+			f()
+		}
+	})
+}
+
+// Part will leave the given channel with the reason
+// and stop tracking it
+func (b *Bot) Part(channel, reason string) {
+	// Stop tracking the channel
+	b.Untrack(channel)
+
+	b.SendMessage(msg.Part(channel, reason))
 }
 
 // Ping will send ping to the server
 func (b *Bot) Ping(message string) {
-	b.writer <- "PING " + message
+	b.SendMessage(msg.Ping(message))
 }
 
 // Pong will send pong to the server
 func (b *Bot) Pong(message string) {
-	b.writer <- "PONG :" + message
+	b.SendMessage(msg.Pong(message))
 }
 
 // Nick will send the nick command to the server and
@@ -229,7 +467,7 @@ func (b *Bot) Nick(nick string) {
 	b.config.Identification.Nick = nick
 
 	// Send the nick
-	b.writer <- "NICK " + nick
+	b.SendMessage(msg.Nick(nick))
 }
 
 // User will send the user command to the server and
@@ -240,7 +478,12 @@ func (b *Bot) User(user, name string) {
 	b.config.Identification.Name = name
 
 	// Send the command
-	b.writer <- "USER " + user + " 0 * :" + name
+	b.SendMessage(msg.User(user, name))
+}
+
+// Now returns the current time of the bot
+func (b *Bot) Now() time.Time {
+	return b.clock.Now()
 }
 
 // Close will disconnect the bot from the server
@@ -253,7 +496,34 @@ func (b *Bot) Config() Config {
 	return b.config
 }
 
-// Db returns the active database for this bot
-func (b *Bot) Db() *badger.DB {
-	return b.db
+// IsAdmin returns true if the prefix or the services account
+// of the user matches one of the configured administrator masks
+func (b *Bot) IsAdmin(prefix *msg.Prefix) bool {
+	if prefix == nil {
+		return false
+	}
+
+	return b.admins.Match(prefix, b.Account(prefix.Name))
+}
+
+// HasPlugin returns true if the plugin is enabled for this bot
+func (b *Bot) HasPlugin(name string) bool {
+	for _, plugin := range b.config.Plugins {
+		if plugin == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Store returns the database of the bot
+func (b *Bot) Store() storage.Store {
+	return b.store
+}
+
+// Storage returns the bucket with the name, which keeps the
+// keys of a plugin apart from those of the other plugins
+func (b *Bot) Storage(name string) *storage.Bucket {
+	return storage.NewBucket(b.store, name)
 }
@@ -0,0 +1,62 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/jriddick/geoffrey/msg"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSend(t *testing.T) {
+	Convey("With a bot", t, func() {
+		writer := make(chan *msg.Message, 1)
+		bot := &Bot{
+			writer: writer,
+		}
+
+		Convey("Should send messages", func() {
+			So(bot.Send("#geoffrey", "Hello World"), ShouldBeNil)
+			So((<-writer).String(), ShouldEqual, "PRIVMSG #geoffrey :Hello World")
+		})
+
+		Convey("Should send notices", func() {
+			So(bot.Notice("geoffrey", "Hello"), ShouldBeNil)
+			So((<-writer).String(), ShouldEqual, "NOTICE geoffrey :Hello")
+		})
+
+		Convey("Should not send injected commands", func() {
+			So(bot.Send("#geoffrey", "Title\r\nQUIT :bye"), ShouldEqual, msg.ErrInvalidCharacter)
+			So(writer, ShouldBeEmpty)
+		})
+
+		Convey("Should not send invalid targets", func() {
+			So(bot.Send("#geoffrey #other", "Hello"), ShouldEqual, msg.ErrInvalidParam)
+			So(writer, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestAdmins(t *testing.T) {
+	Convey("With administrator masks", t, func() {
+		admins, err := msg.NewMaskSet(msg.RFC1459, "jriddick", "*!*@admin.example.com")
+		So(err, ShouldBeNil)
+
+		bot := &Bot{
+			admins: admins,
+		}
+
+		Convey("Should match plain nicks", func() {
+			So(bot.IsAdmin(msg.ParsePrefix("JRiddick!user@host")), ShouldBeTrue)
+		})
+
+		Convey("Should match hostmasks", func() {
+			So(bot.IsAdmin(msg.ParsePrefix("other!user@admin.example.com")), ShouldBeTrue)
+		})
+
+		Convey("Should not match others", func() {
+			So(bot.IsAdmin(msg.ParsePrefix("other!user@host")), ShouldBeFalse)
+			So(bot.IsAdmin(nil), ShouldBeFalse)
+		})
+	})
+}
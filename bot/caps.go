@@ -0,0 +1,157 @@
+package bot
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jriddick/geoffrey/irc"
+	"github.com/jriddick/geoffrey/msg"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultCapabilities are the IRCv3 capabilities requested
+// when none have been configured
+var DefaultCapabilities = []string{
+	"account-notify",
+	"account-tag",
+	"batch",
+	"cap-notify",
+	"echo-message",
+	"extended-join",
+	"labeled-response",
+	"message-tags",
+	"server-time",
+}
+
+// capabilities holds the negotiated capabilities
+type capabilities struct {
+	sync.RWMutex
+	available   map[string]string
+	enabled     map[string]bool
+	negotiating bool
+}
+
+// requestCapabilities starts the capability negotiation
+func (b *Bot) requestCapabilities() {
+	b.caps.Lock()
+	b.caps.available = make(map[string]string)
+	b.caps.enabled = make(map[string]bool)
+	b.caps.negotiating = true
+	b.caps.Unlock()
+
+	b.SendMessage(&msg.Message{
+		Command: irc.Cap,
+		Params:  []string{"LS", "302"},
+	})
+}
+
+// HasCapability returns true if the capability is enabled
+func (b *Bot) HasCapability(name string) bool {
+	b.caps.RLock()
+	defer b.caps.RUnlock()
+
+	return b.caps.enabled[name]
+}
+
+// Capabilities returns the enabled capabilities
+func (b *Bot) Capabilities() []string {
+	b.caps.RLock()
+	defer b.caps.RUnlock()
+
+	caps := make([]string, 0, len(b.caps.enabled))
+	for name := range b.caps.enabled {
+		caps = append(caps, name)
+	}
+	sort.Strings(caps)
+
+	return caps
+}
+
+// wantedCapabilities returns the capabilities we request
+func (b *Bot) wantedCapabilities() []string {
+	if len(b.config.Capabilities) > 0 {
+		return b.config.Capabilities
+	}
+
+	return DefaultCapabilities
+}
+
+// negotiate handles the CAP replies from the server
+func (b *Bot) negotiate(message *msg.Message) {
+	if message.Command != irc.Cap {
+		return
+	}
+
+	caps := strings.Fields(message.LastParam())
+
+	b.caps.Lock()
+	if b.caps.available == nil {
+		b.caps.available = make(map[string]string)
+		b.caps.enabled = make(map[string]bool)
+	}
+
+	var request []string
+	end := false
+
+	switch strings.ToUpper(message.Param(1)) {
+	case "LS", "NEW":
+		for _, capability := range caps {
+			name, value := capability, ""
+			if equals := strings.IndexByte(capability, '='); equals > -1 {
+				name, value = capability[:equals], capability[equals+1:]
+			}
+			b.caps.available[name] = value
+		}
+
+		// Wait for the rest of a multiline listing
+		if message.Param(2) == "*" && len(message.Params) > 2 {
+			break
+		}
+
+		for _, name := range b.wantedCapabilities() {
+			if _, ok := b.caps.available[name]; ok && !b.caps.enabled[name] {
+				request = append(request, name)
+			}
+		}
+
+		end = len(request) == 0 && b.caps.negotiating
+	case "ACK":
+		for _, name := range caps {
+			if strings.HasPrefix(name, "-") {
+				delete(b.caps.enabled, name[1:])
+			} else {
+				b.caps.enabled[name] = true
+			}
+		}
+
+		log.Infof("[geoffrey] Enabled capabilities: %s", strings.Join(caps, ", "))
+		end = b.caps.negotiating
+	case "NAK":
+		log.Warnf("[geoffrey] Server refused capabilities: %s", strings.Join(caps, ", "))
+		end = b.caps.negotiating
+	case "DEL":
+		for _, name := range caps {
+			delete(b.caps.available, name)
+			delete(b.caps.enabled, name)
+		}
+	}
+
+	if end {
+		b.caps.negotiating = false
+	}
+	b.caps.Unlock()
+
+	if len(request) > 0 {
+		b.SendMessage(&msg.Message{
+			Command:  irc.Cap,
+			Params:   []string{"REQ"},
+			Trailing: strings.Join(request, " "),
+		})
+	} else if end {
+		b.SendMessage(&msg.Message{
+			Command: irc.Cap,
+			Params:  []string{"END"},
+		})
+	}
+}
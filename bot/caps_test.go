@@ -0,0 +1,232 @@
+package bot
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jriddick/geoffrey/msg"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCapabilities(t *testing.T) {
+	parse := func(raw string) *msg.Message {
+		message, err := msg.ParseMessage(raw)
+		So(err, ShouldBeNil)
+		return message
+	}
+
+	Convey("With capability negotiation", t, func() {
+		writer := make(chan *msg.Message, 10)
+		bot := &Bot{
+			writer: writer,
+		}
+		bot.config.Identification.Nick = "geoffrey"
+
+		bot.requestCapabilities()
+		So((<-writer).String(), ShouldEqual, "CAP LS 302")
+
+		Convey("Should request the supported capabilities", func() {
+			bot.negotiate(parse(":irc.example.com CAP * LS * :batch server-time sasl=PLAIN"))
+			So(writer, ShouldBeEmpty)
+
+			bot.negotiate(parse(":irc.example.com CAP * LS :echo-message labeled-response away-notify"))
+			So((<-writer).String(), ShouldEqual, "CAP REQ :batch echo-message labeled-response server-time")
+
+			bot.negotiate(parse(":irc.example.com CAP geoffrey ACK :batch echo-message labeled-response server-time"))
+			So((<-writer).String(), ShouldEqual, "CAP END")
+
+			So(bot.HasCapability("server-time"), ShouldBeTrue)
+			So(bot.HasCapability("sasl"), ShouldBeFalse)
+			So(bot.Capabilities(), ShouldResemble, []string{"batch", "echo-message", "labeled-response", "server-time"})
+
+			Convey("Should request new capabilities", func() {
+				bot.negotiate(parse(":irc.example.com CAP geoffrey NEW :message-tags"))
+				So((<-writer).String(), ShouldEqual, "CAP REQ :message-tags")
+
+				bot.negotiate(parse(":irc.example.com CAP geoffrey ACK :message-tags"))
+				So(writer, ShouldBeEmpty)
+				So(bot.HasCapability("message-tags"), ShouldBeTrue)
+			})
+
+			Convey("Should remove deleted capabilities", func() {
+				bot.negotiate(parse(":irc.example.com CAP geoffrey DEL :echo-message"))
+				So(bot.HasCapability("echo-message"), ShouldBeFalse)
+			})
+		})
+
+		Convey("Should end without supported capabilities", func() {
+			bot.negotiate(parse(":irc.example.com CAP * LS :sasl"))
+			So((<-writer).String(), ShouldEqual, "CAP END")
+		})
+
+		Convey("Should end when refused", func() {
+			bot.negotiate(parse(":irc.example.com CAP * LS :batch"))
+			So((<-writer).String(), ShouldEqual, "CAP REQ :batch")
+
+			bot.negotiate(parse(":irc.example.com CAP * NAK :batch"))
+			So((<-writer).String(), ShouldEqual, "CAP END")
+			So(bot.HasCapability("batch"), ShouldBeFalse)
+		})
+
+		Convey("Should request the configured capabilities", func() {
+			bot.config.Capabilities = []string{"sasl"}
+
+			bot.negotiate(parse(":irc.example.com CAP * LS :batch sasl"))
+			So((<-writer).String(), ShouldEqual, "CAP REQ :sasl")
+		})
+	})
+
+	Convey("With batches", t, func() {
+		writer := make(chan *msg.Message, 10)
+		bot := &Bot{
+			writer: writer,
+		}
+		bot.config.Identification.Nick = "geoffrey"
+
+		Convey("Should group the messages of a batch", func() {
+			So(bot.process(parse(":irc.example.com BATCH +split netsplit irc.a irc.b")), ShouldBeEmpty)
+			So(bot.process(parse("@batch=split :a!a@a QUIT :irc.a irc.b")), ShouldBeEmpty)
+			So(bot.process(parse("@batch=split :b!b@b QUIT :irc.a irc.b")), ShouldBeEmpty)
+
+			messages := bot.process(parse(":irc.example.com BATCH -split"))
+			So(messages, ShouldHaveLength, 1)
+			So(messages[0].Command, ShouldEqual, "BATCH")
+			So(messages[0].Params, ShouldResemble, []string{"+split", "netsplit", "irc.a", "irc.b"})
+			So(messages[0].Batch, ShouldHaveLength, 2)
+			So(messages[0].Batch[1].Prefix.Name, ShouldEqual, "b")
+		})
+
+		Convey("Should nest batches", func() {
+			bot.process(parse(":irc.example.com BATCH +outer chathistory #geoffrey"))
+			bot.process(parse("@batch=outer :irc.example.com BATCH +inner netjoin"))
+			bot.process(parse("@batch=inner :a!a@a JOIN #geoffrey"))
+			So(bot.process(parse(":irc.example.com BATCH -inner")), ShouldBeEmpty)
+
+			messages := bot.process(parse(":irc.example.com BATCH -outer"))
+			So(messages, ShouldHaveLength, 1)
+			So(messages[0].Batch, ShouldHaveLength, 1)
+			So(messages[0].Batch[0].Batch, ShouldHaveLength, 1)
+		})
+
+		Convey("Should pass messages outside of batches", func() {
+			So(bot.process(parse(":a!a@a PRIVMSG #geoffrey :hello")), ShouldHaveLength, 1)
+			So(bot.process(parse("@batch=unknown :a!a@a PRIVMSG #geoffrey :hello")), ShouldHaveLength, 1)
+		})
+
+		Convey("Should only suppress echoes with echo-message", func() {
+			echo := parse(":geoffrey!bot@host PRIVMSG #geoffrey :hello")
+			So(bot.process(echo), ShouldHaveLength, 1)
+
+			bot.caps.enabled = map[string]bool{"echo-message": true}
+			So(bot.process(echo), ShouldBeEmpty)
+		})
+
+		Convey("Should parse the server time", func() {
+			messages := bot.process(parse("@time=2020-05-20T12:00:00.123Z :a!a@a PRIVMSG #geoffrey :hello"))
+			So(messages[0].Time.Equal(time.Date(2020, 5, 20, 12, 0, 0, 123000000, time.UTC)), ShouldBeTrue)
+		})
+	})
+
+	Convey("With labeled requests", t, func() {
+		writer := make(chan *msg.Message, 10)
+		bot := &Bot{
+			writer: writer,
+		}
+		bot.config.Identification.Nick = "geoffrey"
+
+		Convey("Should require labeled-response", func() {
+			_, err := bot.Request(context.Background(), msg.Privmsg("#geoffrey", "hello"))
+			So(err, ShouldEqual, ErrNoLabeledResponse)
+		})
+
+		Convey("Given labeled-response", func() {
+			bot.caps.enabled = map[string]bool{"labeled-response": true, "echo-message": true, "batch": true}
+
+			type result struct {
+				messages []*msg.Message
+				err      error
+			}
+
+			request := func(message *msg.Message) (string, chan result) {
+				done := make(chan result, 1)
+				go func() {
+					messages, err := bot.Request(context.Background(), message)
+					done <- result{messages, err}
+				}()
+
+				sent := <-writer
+				return sent.Tags[msg.LabelTag], done
+			}
+
+			Convey("Should correlate a single reply", func() {
+				label, done := request(&msg.Message{Command: "WHOIS", Params: []string{"jriddick"}})
+				So(label, ShouldNotBeEmpty)
+
+				bot.process(parse("@label=" + label + " :irc.example.com 401 geoffrey jriddick :No such nick"))
+
+				reply := <-done
+				So(reply.err, ShouldBeNil)
+				So(reply.messages, ShouldHaveLength, 1)
+				So(reply.messages[0].Command, ShouldEqual, "401")
+			})
+
+			Convey("Should correlate a batch reply", func() {
+				label, done := request(&msg.Message{Command: "WHOIS", Params: []string{"jriddick"}})
+
+				bot.process(parse("@label=" + label + " :irc.example.com BATCH +w labeled-response"))
+				bot.process(parse("@batch=w :irc.example.com 311 geoffrey jriddick user host * :Name"))
+				bot.process(parse("@batch=w :irc.example.com 318 geoffrey jriddick :End of WHOIS"))
+				bot.process(parse(":irc.example.com BATCH -w"))
+
+				reply := <-done
+				So(reply.messages, ShouldHaveLength, 2)
+			})
+
+			Convey("Should correlate an acknowledgement", func() {
+				label, done := request(&msg.Message{Command: "MODE", Params: []string{"#geoffrey", "+m"}})
+
+				So(bot.process(parse("@label="+label+" :irc.example.com ACK")), ShouldBeEmpty)
+
+				reply := <-done
+				So(reply.err, ShouldBeNil)
+				So(reply.messages, ShouldBeEmpty)
+			})
+
+			Convey("Should confirm delivery with the labeled echo", func() {
+				done := make(chan error, 1)
+				go func() {
+					done <- bot.Deliver(context.Background(), msg.Privmsg("#geoffrey", "hello"))
+				}()
+
+				label := (<-writer).Tags[msg.LabelTag]
+				So(bot.process(parse("@label="+label+" :geoffrey!bot@host PRIVMSG #geoffrey :hello")), ShouldBeEmpty)
+				So(<-done, ShouldBeNil)
+			})
+
+			Convey("Should stop waiting when cancelled", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+
+				_, err := bot.Request(ctx, msg.Privmsg("#geoffrey", "hello"))
+				So(err, ShouldEqual, context.Canceled)
+				So(bot.batches.labels, ShouldBeEmpty)
+			})
+		})
+
+		Convey("Should confirm delivery without labels", func() {
+			bot.caps.enabled = map[string]bool{"echo-message": true}
+
+			done := make(chan error, 1)
+			go func() {
+				done <- bot.Deliver(context.Background(), msg.Privmsg("#geoffrey", "hello"))
+			}()
+
+			<-writer
+			So(bot.process(parse(":geoffrey!bot@host PRIVMSG #Geoffrey :hello")), ShouldBeEmpty)
+			So(<-done, ShouldBeNil)
+			So(bot.batches.echoes, ShouldBeEmpty)
+		})
+	})
+}
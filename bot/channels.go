@@ -0,0 +1,225 @@
+package bot
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/jriddick/geoffrey/msg"
+	"github.com/jriddick/geoffrey/storage"
+)
+
+// channelBucket is the bucket of the stored channels
+const channelBucket = "channels"
+
+// Channel is a channel tracked by the bot
+type Channel struct {
+	Name     string
+	Key      string
+	Joined   bool
+	Attempts int
+}
+
+// ParseChannel parses a configured channel entry where
+// the key follows the channel name separated by a space.
+//
+// <entry> ::= <channel> [ ' ' <key> ]
+func ParseChannel(entry string) Channel {
+	fields := strings.Fields(entry)
+	channel := Channel{}
+
+	if len(fields) > 0 {
+		channel.Name = fields[0]
+	}
+
+	if len(fields) > 1 {
+		channel.Key = fields[1]
+	}
+
+	// Make sure we have a hashtag
+	if channel.Name != "" && !strings.ContainsAny(channel.Name[:1], defaultChanTypes) {
+		channel.Name = "#" + channel.Name
+	}
+
+	return channel
+}
+
+// channelKey returns the key used to store the channel
+func channelKey(name string) string {
+	return strings.ToLower(name)
+}
+
+// Channels returns all channels tracked by the bot sorted by name
+func (b *Bot) Channels() []Channel {
+	b.channelsLock.RLock()
+	defer b.channelsLock.RUnlock()
+
+	channels := make([]Channel, 0, len(b.channels))
+	for _, channel := range b.channels {
+		channels = append(channels, *channel)
+	}
+
+	sort.Slice(channels, func(i, j int) bool {
+		return channelKey(channels[i].Name) < channelKey(channels[j].Name)
+	})
+
+	return channels
+}
+
+// Channel returns the tracked channel with the given name
+func (b *Bot) Channel(name string) (Channel, bool) {
+	b.channelsLock.RLock()
+	defer b.channelsLock.RUnlock()
+
+	if channel, ok := b.channels[channelKey(name)]; ok {
+		return *channel, true
+	}
+
+	return Channel{}, false
+}
+
+// Track starts tracking the channel so it is rejoined
+// after reconnects and kicks.
+func (b *Bot) Track(name, key string) {
+	b.channelsLock.Lock()
+	defer b.channelsLock.Unlock()
+
+	if channel, ok := b.channels[channelKey(name)]; ok {
+		// Keep the previous key unless a new one is given
+		if key != "" {
+			channel.Key = key
+		}
+		return
+	}
+
+	b.channels[channelKey(name)] = &Channel{
+		Name: name,
+		Key:  key,
+	}
+}
+
+// Untrack stops tracking the channel
+func (b *Bot) Untrack(name string) {
+	b.channelsLock.Lock()
+	defer b.channelsLock.Unlock()
+
+	delete(b.channels, channelKey(name))
+}
+
+// Attempt increments and returns the number of failed
+// join attempts for the channel.
+func (b *Bot) Attempt(name string) int {
+	b.channelsLock.Lock()
+	defer b.channelsLock.Unlock()
+
+	if channel, ok := b.channels[channelKey(name)]; ok {
+		channel.Attempts++
+		return channel.Attempts
+	}
+
+	return 0
+}
+
+// storedChannel is a channel persisted in the database
+type storedChannel struct {
+	Name   string
+	Key    string `json:",omitempty"`
+	Parted bool   `json:",omitempty"`
+}
+
+// storeChannel persists the channel in the database
+func (b *Bot) storeChannel(channel storedChannel) error {
+	return b.Storage(channelBucket).Put(channelKey(channel.Name), channel)
+}
+
+// SaveChannel persists the channel so that it is joined
+// again when the bot is restarted.
+func (b *Bot) SaveChannel(name, key string) error {
+	return b.storeChannel(storedChannel{
+		Name: name,
+		Key:  key,
+	})
+}
+
+// ForgetChannel persists that the channel has been parted so
+// that it is not joined when the bot is restarted, even if it
+// is part of the configuration.
+func (b *Bot) ForgetChannel(name string) error {
+	return b.storeChannel(storedChannel{
+		Name:   name,
+		Parted: true,
+	})
+}
+
+// loadChannels merges the channels persisted in the database
+// with the tracked channels.
+func (b *Bot) loadChannels() error {
+	return b.Storage(channelBucket).Each("", func(key string, value storage.Value) error {
+		var channel storedChannel
+
+		if err := value.Decode(&channel); err != nil {
+			return err
+		}
+
+		if channel.Parted {
+			b.Untrack(channel.Name)
+		} else {
+			b.Track(channel.Name, channel.Key)
+		}
+
+		return nil
+	})
+}
+
+// IsMe returns true if the name is the nick of the bot
+func (b *Bot) IsMe(name string) bool {
+	return strings.EqualFold(name, b.config.Identification.Nick)
+}
+
+// setJoined updates the joined status of a tracked channel
+func (b *Bot) setJoined(name string, joined bool) {
+	b.channelsLock.Lock()
+	defer b.channelsLock.Unlock()
+
+	if channel, ok := b.channels[channelKey(name)]; ok {
+		channel.Joined = joined
+
+		// Reset the attempts after a successful join
+		if joined {
+			channel.Attempts = 0
+		}
+	}
+}
+
+// trackChannels updates the tracked channels from the
+// messages received by the bot.
+func (b *Bot) trackChannels(message *msg.Message) {
+	switch message.Command {
+	case "001":
+		// Every channel has to be joined again after registration
+		// with a fresh number of attempts
+		b.channelsLock.Lock()
+		for _, channel := range b.channels {
+			channel.Joined = false
+			channel.Attempts = 0
+		}
+		b.channelsLock.Unlock()
+	case "JOIN":
+		if message.Prefix != nil && b.IsMe(message.Prefix.Name) {
+			name := message.Trailing
+			if len(message.Params) > 0 {
+				name = message.Params[0]
+			}
+
+			b.Track(name, "")
+			b.setJoined(name, true)
+		}
+	case "PART":
+		if message.Prefix != nil && b.IsMe(message.Prefix.Name) && len(message.Params) > 0 {
+			b.setJoined(message.Params[0], false)
+		}
+	case "KICK":
+		if len(message.Params) > 1 && b.IsMe(message.Params[1]) {
+			b.setJoined(message.Params[0], false)
+		}
+	}
+}
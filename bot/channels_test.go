@@ -0,0 +1,143 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/jriddick/geoffrey/msg"
+	"github.com/jriddick/geoffrey/storage"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestChannels(t *testing.T) {
+	Convey("With channel entries", t, func() {
+		Convey("Should parse channel without key", func() {
+			So(ParseChannel("#geoffrey"), ShouldResemble, Channel{Name: "#geoffrey"})
+		})
+
+		Convey("Should parse channel with key", func() {
+			So(ParseChannel("#geoffrey hunter2"), ShouldResemble, Channel{Name: "#geoffrey", Key: "hunter2"})
+		})
+
+		Convey("Should add missing hashtag", func() {
+			So(ParseChannel("geoffrey").Name, ShouldEqual, "#geoffrey")
+			So(ParseChannel("&local").Name, ShouldEqual, "&local")
+		})
+	})
+
+	Convey("With a tracking bot", t, func() {
+		bot := &Bot{
+			channels: make(map[string]*Channel),
+		}
+		bot.config.Identification.Nick = "geoffrey"
+		bot.Track("#geoffrey", "hunter2")
+
+		parse := func(raw string) *msg.Message {
+			message, err := msg.ParseMessage(raw)
+			So(err, ShouldBeNil)
+			return message
+		}
+
+		Convey("Should mark channel as joined on our own join", func() {
+			bot.trackChannels(parse(":Geoffrey!bot@host JOIN #Geoffrey"))
+
+			channel, ok := bot.Channel("#geoffrey")
+			So(ok, ShouldBeTrue)
+			So(channel.Joined, ShouldBeTrue)
+			So(channel.Key, ShouldEqual, "hunter2")
+		})
+
+		Convey("Should track channels we are forced into", func() {
+			bot.trackChannels(parse(":geoffrey!bot@host JOIN :#other"))
+
+			So(bot.Channels(), ShouldHaveLength, 2)
+		})
+
+		Convey("Should ignore joins from other users", func() {
+			bot.trackChannels(parse(":other!user@host JOIN #other"))
+
+			So(bot.Channels(), ShouldHaveLength, 1)
+		})
+
+		Convey("Should keep tracking after kick", func() {
+			bot.trackChannels(parse(":geoffrey!bot@host JOIN #geoffrey"))
+			bot.trackChannels(parse(":op!user@host KICK #geoffrey geoffrey :bye"))
+
+			channel, ok := bot.Channel("#geoffrey")
+			So(ok, ShouldBeTrue)
+			So(channel.Joined, ShouldBeFalse)
+		})
+
+		Convey("Should keep tracking after forced part", func() {
+			bot.trackChannels(parse(":geoffrey!bot@host JOIN #geoffrey"))
+			bot.trackChannels(parse(":geoffrey!bot@host PART #geoffrey :bye"))
+
+			channel, ok := bot.Channel("#geoffrey")
+			So(ok, ShouldBeTrue)
+			So(channel.Joined, ShouldBeFalse)
+		})
+
+		Convey("Should stop tracking after we part", func() {
+			writer := make(chan *msg.Message, 1)
+			bot.writer = writer
+
+			bot.Part("#geoffrey", "bye")
+
+			So((<-writer).String(), ShouldEqual, "PART #geoffrey :bye")
+
+			_, ok := bot.Channel("#geoffrey")
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("Should only prefix names that are not channels on the server", func() {
+			writer := make(chan *msg.Message, 3)
+			bot.writer = writer
+
+			bot.Join("geoffrey-dev")
+			bot.Join("&local")
+			So((<-writer).String(), ShouldEqual, "JOIN #geoffrey-dev")
+			So((<-writer).String(), ShouldEqual, "JOIN &local")
+
+			bot.trackISupport(parse(":irc.example.com 005 geoffrey CHANTYPES=# :are supported by this server"))
+			bot.Join("&local")
+			So((<-writer).String(), ShouldEqual, "JOIN #&local")
+		})
+
+		Convey("Should persist channels in the database", func() {
+			store := storage.NewMemory()
+			bot.store = store
+
+			So(bot.SaveChannel("#runtime", "secret"), ShouldBeNil)
+			So(bot.ForgetChannel("#geoffrey"), ShouldBeNil)
+
+			restarted := &Bot{
+				channels: make(map[string]*Channel),
+				store:    store,
+			}
+			restarted.Track("#geoffrey", "")
+			restarted.Track("#config", "")
+
+			So(restarted.loadChannels(), ShouldBeNil)
+			So(restarted.Channels(), ShouldResemble, []Channel{
+				{Name: "#config"},
+				{Name: "#runtime", Key: "secret"},
+			})
+		})
+
+		Convey("Should count and reset join attempts", func() {
+			So(bot.Attempt("#geoffrey"), ShouldEqual, 1)
+			So(bot.Attempt("#geoffrey"), ShouldEqual, 2)
+
+			bot.trackChannels(parse(":geoffrey!bot@host JOIN #geoffrey"))
+
+			channel, _ := bot.Channel("#geoffrey")
+			So(channel.Attempts, ShouldEqual, 0)
+
+			bot.Attempt("#geoffrey")
+			bot.trackChannels(parse(":irc.example.com 001 geoffrey :Welcome"))
+
+			channel, _ = bot.Channel("#geoffrey")
+			So(channel.Attempts, ShouldEqual, 0)
+		})
+	})
+}
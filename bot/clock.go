@@ -0,0 +1,28 @@
+package bot
+
+import (
+	"time"
+)
+
+// Clock tells the time and runs the timers of the bot and
+// its plugins, which lets tests control the time
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+	// AfterFunc runs the function once the duration has passed
+	AfterFunc(duration time.Duration, f func())
+}
+
+// systemClock is the wall clock
+type systemClock struct{}
+
+// Now returns the current local time
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// AfterFunc runs the function in its own goroutine once the
+// duration has passed
+func (systemClock) AfterFunc(duration time.Duration, f func()) {
+	time.AfterFunc(duration, f)
+}
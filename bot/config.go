@@ -14,15 +14,43 @@ type Config struct {
 		User string
 		Name string
 	}
+	Services struct {
+		NickServ string `mapstructure:"nickserv"`
+		ChanServ string `mapstructure:"chanserv"`
+		Account  string
+		Password string
+		Identify string
+		Success  string
+		Failure  string
+		Timeout  int
+		Op       []string
+		Voice    []string
+	}
 	Channels []string
-	Timings  struct {
-		Timeout int
+	Encoding struct {
+		Default  string
+		Fallback string
+		Channels map[string]string
+	}
+	Joins struct {
+		Rejoin  bool
+		Delay   int
+		Retry   int
+		Retries int
+		Invite  []string
+	}
+	Timings struct {
+		Timeout    int
+		Compaction int
 	}
 	Limits struct {
 		Messages int `mapstructure:"rate"`
 		Timeout  int `mapstructure:"retries"`
 	}
-	Plugins  []string
-	Database string
-	Settings map[interface{}]interface{}
+	Admins       []string
+	Capabilities []string
+	Plugins      []string
+	Database     string
+	Transcript   string
+	Settings     map[interface{}]interface{}
 }
@@ -12,4 +12,22 @@ var (
 	// ErrHandlerExists occurs when you try to add a handler
 	// that already exists
 	ErrHandlerExists = errors.New("manager: Handler already exists")
+	// ErrNoLabeledResponse occurs when a request needs a reply
+	// but the server has not enabled labeled-response
+	ErrNoLabeledResponse = errors.New("bot: Server has not enabled labeled-response")
+	// ErrQueryTimeout occurs when the server did not reply
+	// to a query in time
+	ErrQueryTimeout = errors.New("bot: Query timed out")
+	// ErrNoSuchNick occurs when a query is for a nick
+	// that does not exist
+	ErrNoSuchNick = errors.New("bot: No such nick")
+	// ErrNoSuchChannel occurs when a query is for a channel
+	// that does not exist
+	ErrNoSuchChannel = errors.New("bot: No such channel")
+	// ErrNotOnChannel occurs when a query needs the bot
+	// to be in the channel
+	ErrNotOnChannel = errors.New("bot: Not on channel")
+	// ErrNoPrivileges occurs when a query needs the bot
+	// to be a channel operator
+	ErrNoPrivileges = errors.New("bot: Channel operator privileges needed")
 )
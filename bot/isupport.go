@@ -0,0 +1,84 @@
+package bot
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/jriddick/geoffrey/irc"
+	"github.com/jriddick/geoffrey/msg"
+)
+
+// defaultChanTypes are the channel prefixes assumed until the
+// server advertises CHANTYPES
+const defaultChanTypes = "#&+!"
+
+// isupport holds the features advertised by the server
+type isupport struct {
+	sync.RWMutex
+	tokens map[string]string
+}
+
+// ISupport returns the value of the feature advertised by the
+// server and whether the server advertised it at all
+func (b *Bot) ISupport(name string) (string, bool) {
+	b.isupport.RLock()
+	defer b.isupport.RUnlock()
+
+	value, ok := b.isupport.tokens[strings.ToUpper(name)]
+	return value, ok
+}
+
+// CaseMapping returns the casemapping used by the server
+func (b *Bot) CaseMapping() msg.CaseMapping {
+	value, _ := b.ISupport("CASEMAPPING")
+	return msg.ParseCaseMapping(value)
+}
+
+// IsChannel returns true if the name starts with one of the
+// channel prefixes advertised by the server in CHANTYPES
+func (b *Bot) IsChannel(name string) bool {
+	types, ok := b.ISupport("CHANTYPES")
+	if !ok {
+		types = defaultChanTypes
+	}
+
+	return name != "" && strings.ContainsAny(name[:1], types)
+}
+
+// trackISupport updates the advertised features from the
+// ISUPPORT replies sent during registration.
+//
+// <reply> ::= '005' <nick> { [ '-' ] <token> [ '=' <value> ] } ':are supported by this server'
+func (b *Bot) trackISupport(message *msg.Message) {
+	switch message.Command {
+	case irc.Welcome:
+		b.isupport.Lock()
+		b.isupport.tokens = nil
+		b.isupport.Unlock()
+	case irc.Bounce:
+		if len(message.Params) < 2 {
+			return
+		}
+
+		b.isupport.Lock()
+		defer b.isupport.Unlock()
+
+		if b.isupport.tokens == nil {
+			b.isupport.tokens = make(map[string]string)
+		}
+
+		for _, token := range message.Params[1:] {
+			if strings.HasPrefix(token, "-") {
+				delete(b.isupport.tokens, strings.ToUpper(token[1:]))
+				continue
+			}
+
+			name, value := token, ""
+			if equals := strings.IndexByte(token, '='); equals > -1 {
+				name, value = token[:equals], token[equals+1:]
+			}
+
+			b.isupport.tokens[strings.ToUpper(name)] = value
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package bot
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jriddick/geoffrey/irc"
+	"github.com/jriddick/geoffrey/msg"
+	"github.com/jriddick/geoffrey/storage"
+	log "github.com/sirupsen/logrus"
+)
+
+// banBucket is the bucket of the timed bans
+const banBucket = "bans"
+
+// banDelay is the shortest time before a timed ban is lifted
+// after joining, giving services time to op the bot
+const banDelay = 5 * time.Second
+
+// defaultModes is the number of mode changes with parameters
+// sent in a single MODE when the server does not advertise it
+const defaultModes = 3
+
+// maxModes is the most mode changes with parameters that fit
+// in the parameters of a single MODE
+const maxModes = 12
+
+// ModeChange is a single mode change where the parameter is
+// empty for modes without one, such as +m
+type ModeChange struct {
+	Add   bool
+	Mode  byte
+	Param string
+}
+
+// String returns the mode change as '+b mask'
+func (c ModeChange) String() string {
+	sign := "-"
+	if c.Add {
+		sign = "+"
+	}
+
+	if c.Param == "" {
+		return sign + string(c.Mode)
+	}
+
+	return sign + string(c.Mode) + " " + c.Param
+}
+
+// modesPerLine returns the number of mode changes with
+// parameters the server accepts in a single MODE
+func (b *Bot) modesPerLine() int {
+	value, ok := b.ISupport("MODES")
+	if !ok {
+		return defaultModes
+	}
+
+	// An empty value means there is no limit
+	modes, err := strconv.Atoi(value)
+	if err != nil || modes <= 0 || modes > maxModes {
+		return maxModes
+	}
+
+	return modes
+}
+
+// Mode sends the mode changes for the target, split into as
+// few MODE commands as the server allows
+func (b *Bot) Mode(target string, changes ...ModeChange) error {
+	limit := b.modesPerLine()
+
+	for len(changes) > 0 {
+		var modes strings.Builder
+		var params []string
+		sign := byte(0)
+
+		n := 0
+		for ; n < len(changes); n++ {
+			change := changes[n]
+			if change.Param != "" {
+				if len(params) == limit {
+					break
+				}
+				params = append(params, change.Param)
+			}
+
+			// Only repeat the sign when it changes
+			next := byte('-')
+			if change.Add {
+				next = '+'
+			}
+
+			if next != sign {
+				sign = next
+				modes.WriteByte(sign)
+			}
+			modes.WriteByte(change.Mode)
+		}
+
+		if err := b.SendMessage(msg.Mode(target, modes.String(), params...)); err != nil {
+			return err
+		}
+
+		changes = changes[n:]
+	}
+
+	return nil
+}
+
+// modeChanges returns the same mode change for every parameter
+func modeChanges(add bool, mode byte, params []string) []ModeChange {
+	changes := make([]ModeChange, 0, len(params))
+	for _, param := range params {
+		changes = append(changes, ModeChange{
+			Add:   add,
+			Mode:  mode,
+			Param: param,
+		})
+	}
+
+	return changes
+}
+
+// Ban bans the masks from the channel
+func (b *Bot) Ban(channel string, masks ...string) error {
+	return b.Mode(channel, modeChanges(true, 'b', masks)...)
+}
+
+// Unban lifts the bans of the masks in the channel
+func (b *Bot) Unban(channel string, masks ...string) error {
+	return b.Mode(channel, modeChanges(false, 'b', masks)...)
+}
+
+// Quiet prevents the masks from talking in the channel
+func (b *Bot) Quiet(channel string, masks ...string) error {
+	return b.Mode(channel, modeChanges(true, 'q', masks)...)
+}
+
+// Unquiet allows the masks to talk in the channel again
+func (b *Bot) Unquiet(channel string, masks ...string) error {
+	return b.Mode(channel, modeChanges(false, 'q', masks)...)
+}
+
+// Op gives channel operator status to the nicks
+func (b *Bot) Op(channel string, nicks ...string) error {
+	return b.Mode(channel, modeChanges(true, 'o', nicks)...)
+}
+
+// Deop takes channel operator status from the nicks
+func (b *Bot) Deop(channel string, nicks ...string) error {
+	return b.Mode(channel, modeChanges(false, 'o', nicks)...)
+}
+
+// Voice gives voice to the nicks
+func (b *Bot) Voice(channel string, nicks ...string) error {
+	return b.Mode(channel, modeChanges(true, 'v', nicks)...)
+}
+
+// Devoice takes voice from the nicks
+func (b *Bot) Devoice(channel string, nicks ...string) error {
+	return b.Mode(channel, modeChanges(false, 'v', nicks)...)
+}
+
+// Moderate sets or unsets the channel as moderated
+func (b *Bot) Moderate(channel string, moderated bool) error {
+	return b.Mode(channel, ModeChange{Add: moderated, Mode: 'm'})
+}
+
+// Kick kicks the nick from the channel with the reason
+func (b *Bot) Kick(channel, nick, reason string) error {
+	return b.SendMessage(msg.Kick(channel, nick, reason))
+}
+
+// Topic sets the topic of the channel
+func (b *Bot) Topic(channel, topic string) error {
+	return b.SendMessage(msg.Topic(channel, topic))
+}
+
+// Invite invites the nick to the channel
+func (b *Bot) Invite(nick, channel string) error {
+	return b.SendMessage(msg.Invite(nick, channel))
+}
+
+// storedBan is a timed ban persisted in the database
+type storedBan struct {
+	Channel string
+	Mask    string
+	Expires time.Time
+}
+
+// banKey returns the key used to store the timed ban
+func banKey(channel, mask string) string {
+	return channelKey(channel) + " " + mask
+}
+
+// TimedBan bans the mask from the channel and lifts the ban
+// once the duration has passed. The ban is persisted so it is
+// lifted even if the bot is restarted in the meantime.
+func (b *Bot) TimedBan(channel, mask string, duration time.Duration) error {
+	if err := b.Storage(banBucket).Put(banKey(channel, mask), storedBan{
+		Channel: channel,
+		Mask:    mask,
+		Expires: b.Now().Add(duration),
+	}); err != nil {
+		return err
+	}
+
+	if err := b.Ban(channel, mask); err != nil {
+		return err
+	}
+
+	b.After(duration, func() {
+		b.liftBan(channel, mask)
+	})
+
+	return nil
+}
+
+// TimedBans returns the timed bans of the channel that have
+// not been lifted yet
+func (b *Bot) TimedBans(channel string) ([]Ban, error) {
+	var bans []Ban
+
+	err := b.Storage(banBucket).Each(channelKey(channel)+" ", func(key string, value storage.Value) error {
+		var ban storedBan
+
+		if err := value.Decode(&ban); err != nil {
+			return err
+		}
+
+		bans = append(bans, Ban{
+			Mask:    ban.Mask,
+			Expires: ban.Expires,
+		})
+
+		return nil
+	})
+
+	return bans, err
+}
+
+// liftBan lifts the timed ban if it has expired and the bot
+// is in the channel. Otherwise it is lifted after the next
+// join or by the timer of a ban that replaced it.
+func (b *Bot) liftBan(channel, mask string) {
+	if tracked, ok := b.Channel(channel); !ok || !tracked.Joined {
+		return
+	}
+
+	// Forget the ban first so the database is not held while sending
+	expired := false
+	err := b.Storage(banBucket).Update(func(tx storage.Tx) error {
+		var ban storedBan
+		if err := storage.GetJSON(tx, banKey(channel, mask), &ban); err != nil {
+			return err
+		}
+
+		if b.Now().Before(ban.Expires) {
+			return nil
+		}
+
+		expired = true
+		return tx.Delete([]byte(banKey(channel, mask)))
+	})
+
+	if err == nil && expired {
+		err = b.Unban(channel, mask)
+	}
+
+	if err != nil && err != storage.ErrNotFound {
+		log.Errorf("[geoffrey] Could not lift the ban of '%s' in '%s': %v", mask, channel, err)
+	}
+}
+
+// trackBans schedules the timed bans of the channels we join
+func (b *Bot) trackBans(message *msg.Message) {
+	if message.Command != irc.Join || message.Prefix == nil || !b.IsMe(message.Prefix.Name) {
+		return
+	}
+
+	channel := message.Trailing
+	if len(message.Params) > 0 {
+		channel = message.Params[0]
+	}
+
+	bans, err := b.TimedBans(channel)
+	if err != nil {
+		log.Errorf("[geoffrey] Could not load the bans of '%s': %v", channel, err)
+		return
+	}
+
+	for _, ban := range bans {
+		wait := ban.Expires.Sub(b.Now())
+		if wait < banDelay {
+			wait = banDelay
+		}
+
+		mask := ban.Mask
+		b.After(wait, func() {
+			b.liftBan(channel, mask)
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jriddick/geoffrey/msg"
+	"github.com/jriddick/geoffrey/storage"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// sendingStore notes if messages are sent during an update
+type sendingStore struct {
+	storage.Store
+	writer chan *msg.Message
+	sent   bool
+}
+
+func (s *sendingStore) Update(f func(storage.Tx) error) error {
+	queued := len(s.writer)
+	err := s.Store.Update(f)
+	s.sent = s.sent || len(s.writer) > queued
+
+	return err
+}
+
+func TestModeration(t *testing.T) {
+	parse := func(raw string) *msg.Message {
+		message, err := msg.ParseMessage(raw)
+		So(err, ShouldBeNil)
+		return message
+	}
+
+	Convey("With a moderating bot", t, func() {
+		writer := make(chan *msg.Message, 10)
+		bot := &Bot{
+			writer:   writer,
+			stop:     make(chan struct{}),
+			clock:    systemClock{},
+			channels: make(map[string]*Channel),
+		}
+		bot.config.Identification.Nick = "geoffrey"
+
+		sent := func() string {
+			return (<-writer).String()
+		}
+
+		Convey("Should batch mode changes by the default limit", func() {
+			So(bot.Ban("#geoffrey", "a!*@*", "b!*@*", "c!*@*", "d!*@*"), ShouldBeNil)
+			So(sent(), ShouldEqual, "MODE #geoffrey +bbb a!*@* b!*@* c!*@*")
+			So(sent(), ShouldEqual, "MODE #geoffrey +b d!*@*")
+		})
+
+		Convey("Should batch mode changes by the advertised limit", func() {
+			bot.trackISupport(parse(":irc.example.com 005 geoffrey MODES=2 :are supported by this server"))
+
+			So(bot.Mode("#geoffrey",
+				ModeChange{Add: true, Mode: 'm'},
+				ModeChange{Add: true, Mode: 'o', Param: "jriddick"},
+				ModeChange{Add: false, Mode: 'v', Param: "jriddick"},
+				ModeChange{Add: false, Mode: 'q', Param: "*!*@spam"},
+			), ShouldBeNil)
+			So(sent(), ShouldEqual, "MODE #geoffrey +mo-v jriddick jriddick")
+			So(sent(), ShouldEqual, "MODE #geoffrey -q *!*@spam")
+		})
+
+		Convey("Should send the mode helpers", func() {
+			So(bot.Quiet("#geoffrey", "*!*@spam"), ShouldBeNil)
+			So(sent(), ShouldEqual, "MODE #geoffrey +q *!*@spam")
+
+			So(bot.Devoice("#geoffrey", "jriddick"), ShouldBeNil)
+			So(sent(), ShouldEqual, "MODE #geoffrey -v jriddick")
+
+			So(bot.Moderate("#geoffrey", false), ShouldBeNil)
+			So(sent(), ShouldEqual, "MODE #geoffrey -m")
+		})
+
+		Convey("Should send kicks, topics and invites", func() {
+			So(bot.Kick("#geoffrey", "spammer", "Spam"), ShouldBeNil)
+			So(sent(), ShouldEqual, "KICK #geoffrey spammer :Spam")
+
+			So(bot.Topic("#geoffrey", "Welcome"), ShouldBeNil)
+			So(sent(), ShouldEqual, "TOPIC #geoffrey :Welcome")
+
+			So(bot.Invite("jriddick", "#geoffrey"), ShouldBeNil)
+			So(sent(), ShouldEqual, "INVITE jriddick #geoffrey")
+		})
+
+		Convey("Should not send injected reasons", func() {
+			So(bot.Kick("#geoffrey", "spammer", "bye\r\nQUIT"), ShouldNotBeNil)
+			So(writer, ShouldBeEmpty)
+		})
+
+		Convey("With timed bans", func() {
+			store := storage.NewMemory()
+			bot.store = store
+
+			bot.trackChannels(parse(":geoffrey!bot@host JOIN #geoffrey"))
+
+			Convey("Should lift the ban once it expires", func() {
+				So(bot.TimedBan("#geoffrey", "*!*@spam", 10*time.Millisecond), ShouldBeNil)
+				So(sent(), ShouldEqual, "MODE #geoffrey +b *!*@spam")
+
+				bans, err := bot.TimedBans("#Geoffrey")
+				So(err, ShouldBeNil)
+				So(bans, ShouldHaveLength, 1)
+
+				So(sent(), ShouldEqual, "MODE #geoffrey -b *!*@spam")
+
+				bans, err = bot.TimedBans("#geoffrey")
+				So(err, ShouldBeNil)
+				So(bans, ShouldBeEmpty)
+			})
+
+			Convey("Should keep the ban while not in the channel", func() {
+				bot.trackChannels(parse(":geoffrey!bot@host PART #geoffrey"))
+
+				So(bot.TimedBan("#geoffrey", "*!*@spam", time.Millisecond), ShouldBeNil)
+				So(sent(), ShouldEqual, "MODE #geoffrey +b *!*@spam")
+
+				time.Sleep(10 * time.Millisecond)
+				bot.liftBan("#geoffrey", "*!*@spam")
+				So(writer, ShouldBeEmpty)
+
+				bans, err := bot.TimedBans("#geoffrey")
+				So(err, ShouldBeNil)
+				So(bans, ShouldHaveLength, 1)
+
+				Convey("Should lift it after joining again", func() {
+					bot.trackChannels(parse(":geoffrey!bot@host JOIN #geoffrey"))
+					bot.liftBan("#geoffrey", "*!*@spam")
+
+					So(sent(), ShouldEqual, "MODE #geoffrey -b *!*@spam")
+				})
+
+				Convey("Should not hold the database while lifting it", func() {
+					sending := &sendingStore{Store: store, writer: writer}
+					bot.store = sending
+
+					bot.trackChannels(parse(":geoffrey!bot@host JOIN #geoffrey"))
+					bot.liftBan("#geoffrey", "*!*@spam")
+
+					So(sent(), ShouldEqual, "MODE #geoffrey -b *!*@spam")
+					So(sending.sent, ShouldBeFalse)
+
+					bans, err := bot.TimedBans("#geoffrey")
+					So(err, ShouldBeNil)
+					So(bans, ShouldBeEmpty)
+				})
+			})
+		})
+	})
+}
@@ -0,0 +1,431 @@
+package bot
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jriddick/geoffrey/irc"
+	"github.com/jriddick/geoffrey/msg"
+)
+
+// QueryTimeout is the longest time a query waits for the
+// server when the context has no earlier deadline
+var QueryTimeout = 30 * time.Second
+
+// queryErrors are the error replies that fail a query
+var queryErrors = map[string]error{
+	irc.ErrNosuchnick:       ErrNoSuchNick,
+	irc.ErrNosuchchannel:    ErrNoSuchChannel,
+	irc.ErrNotonchannel:     ErrNotOnChannel,
+	irc.ErrChanoprivsneeded: ErrNoPrivileges,
+}
+
+// replyTarget is the parameter holding the nick or channel
+// a reply is about. Replies missing here use the second
+// parameter, and a negative index skips the check.
+var replyTarget = map[string]int{
+	irc.Whoreply:  -1,
+	irc.Whospcrpl: -1,
+	irc.Namreply:  2,
+}
+
+// querySpec lists the replies collected by a query and the
+// replies that end it
+type querySpec struct {
+	replies []string
+	ends    []string
+}
+
+var (
+	whoisQuery = querySpec{
+		replies: []string{
+			irc.Whoisuser, irc.Whoisserver, irc.Whoisoperator, irc.Whoisidle,
+			irc.Whoischannels, irc.Whoisaccount, irc.Whoissecure, irc.Away,
+			irc.ErrNosuchnick,
+		},
+		ends: []string{irc.Endofwhois},
+	}
+	whoQuery = querySpec{
+		replies: []string{irc.Whoreply},
+		ends:    []string{irc.Endofwho},
+	}
+	whoxQuery = querySpec{
+		replies: []string{irc.Whospcrpl},
+		ends:    []string{irc.Endofwho},
+	}
+	namesQuery = querySpec{
+		replies: []string{irc.Namreply},
+		ends:    []string{irc.Endofnames},
+	}
+	modeQuery = querySpec{
+		replies: []string{irc.Channelmodeis},
+		ends:    []string{irc.Channelmodeis, irc.ErrNosuchchannel, irc.ErrNotonchannel, irc.ErrChanoprivsneeded},
+	}
+	banQuery = querySpec{
+		replies: []string{irc.Banlist},
+		ends:    []string{irc.Endofbanlist, irc.ErrNosuchchannel, irc.ErrNotonchannel, irc.ErrChanoprivsneeded},
+	}
+)
+
+// query is a query waiting for the server to reply
+type query struct {
+	spec     querySpec
+	target   string
+	messages []*msg.Message
+	err      error
+	done     chan struct{}
+}
+
+// queries serializes the queries so that the replies from
+// the server always belong to the query in flight
+type queries struct {
+	sync.Mutex
+	turn    chan struct{}
+	current *query
+}
+
+// contains returns true if the list has the command
+func contains(list []string, command string) bool {
+	for _, other := range list {
+		if other == command {
+			return true
+		}
+	}
+
+	return false
+}
+
+// collect passes the reply to the query in flight
+func (b *Bot) collect(message *msg.Message) {
+	b.queries.Lock()
+	defer b.queries.Unlock()
+
+	q := b.queries.current
+	if q == nil {
+		return
+	}
+
+	end := contains(q.spec.ends, message.Command)
+	if !end && !contains(q.spec.replies, message.Command) {
+		return
+	}
+
+	// Skip replies about something else
+	index, ok := replyTarget[message.Command]
+	if !ok {
+		index = 1
+	}
+
+	if index >= 0 && !b.CaseMapping().Equal(message.Param(index), q.target) {
+		return
+	}
+
+	if err, ok := queryErrors[message.Command]; ok {
+		if q.err == nil {
+			q.err = err
+		}
+	} else if contains(q.spec.replies, message.Command) {
+		q.messages = append(q.messages, message)
+	}
+
+	if end {
+		close(q.done)
+		b.queries.current = nil
+	}
+}
+
+// query sends the message once no other query is in flight
+// and returns the replies collected for the target
+func (b *Bot) query(ctx context.Context, message *msg.Message, target string, spec querySpec) ([]*msg.Message, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	b.queries.Lock()
+	if b.queries.turn == nil {
+		b.queries.turn = make(chan struct{}, 1)
+	}
+	turn := b.queries.turn
+	b.queries.Unlock()
+
+	// Wait for our turn
+	select {
+	case turn <- struct{}{}:
+	case <-ctx.Done():
+		return nil, queryError(ctx.Err())
+	}
+	defer func() { <-turn }()
+
+	q := &query{
+		spec:   spec,
+		target: target,
+		done:   make(chan struct{}),
+	}
+
+	b.queries.Lock()
+	b.queries.current = q
+	b.queries.Unlock()
+
+	if err := b.SendMessage(message); err != nil {
+		b.abort(q)
+		return nil, err
+	}
+
+	select {
+	case <-q.done:
+		return q.messages, q.err
+	case <-ctx.Done():
+		b.abort(q)
+		return nil, queryError(ctx.Err())
+	}
+}
+
+// abort stops collecting replies for the query
+func (b *Bot) abort(q *query) {
+	b.queries.Lock()
+	defer b.queries.Unlock()
+
+	if b.queries.current == q {
+		b.queries.current = nil
+	}
+}
+
+// queryError returns ErrQueryTimeout when the deadline passed
+func queryError(err error) error {
+	if err == context.DeadlineExceeded {
+		return ErrQueryTimeout
+	}
+
+	return err
+}
+
+// WhoisReply is the reply to a WHOIS query
+type WhoisReply struct {
+	Nick       string
+	User       string
+	Host       string
+	Realname   string
+	Server     string
+	ServerInfo string
+	Account    string
+	Away       string
+	Channels   []string
+	Operator   bool
+	Secure     bool
+	Idle       time.Duration
+	SignOn     time.Time
+}
+
+// Whois asks the server about the user with the nick
+func (b *Bot) Whois(ctx context.Context, nick string) (*WhoisReply, error) {
+	replies, err := b.query(ctx, &msg.Message{
+		Command: irc.Whois,
+		Params:  []string{nick},
+	}, nick, whoisQuery)
+
+	if err != nil {
+		return nil, err
+	}
+
+	reply := &WhoisReply{Nick: nick}
+	for _, message := range replies {
+		switch message.Command {
+		case irc.Whoisuser:
+			// <reply> ::= '311' <me> <nick> <user> <host> '*' ':' <realname>
+			reply.Nick = message.Param(1)
+			reply.User = message.Param(2)
+			reply.Host = message.Param(3)
+			reply.Realname = message.Trailing
+		case irc.Whoisserver:
+			// <reply> ::= '312' <me> <nick> <server> ':' <info>
+			reply.Server = message.Param(2)
+			reply.ServerInfo = message.Trailing
+		case irc.Whoisoperator:
+			reply.Operator = true
+		case irc.Whoisidle:
+			// <reply> ::= '317' <me> <nick> <idle> [ <signon> ] ':seconds idle'
+			if idle, err := strconv.Atoi(message.Param(2)); err == nil {
+				reply.Idle = time.Duration(idle) * time.Second
+			}
+
+			if signon, err := strconv.ParseInt(message.Param(3), 10, 64); err == nil {
+				reply.SignOn = time.Unix(signon, 0)
+			}
+		case irc.Whoischannels:
+			// <reply> ::= '319' <me> <nick> ':' { [ <prefix> ] <channel> }
+			reply.Channels = append(reply.Channels, strings.Fields(message.Trailing)...)
+		case irc.Whoisaccount:
+			// <reply> ::= '330' <me> <nick> <account> ':is logged in as'
+			reply.Account = message.Param(2)
+		case irc.Whoissecure:
+			reply.Secure = true
+		case irc.Away:
+			reply.Away = message.Trailing
+		}
+	}
+
+	return reply, nil
+}
+
+// WhoReply is a user in the reply to a WHO query
+type WhoReply struct {
+	Channel  string
+	User     string
+	Host     string
+	Server   string
+	Nick     string
+	Flags    string
+	Hops     int
+	Realname string
+}
+
+// Away returns true if the user is marked as away
+func (r WhoReply) Away() bool {
+	return strings.HasPrefix(r.Flags, "G")
+}
+
+// Operator returns true if the user is an IRC operator
+func (r WhoReply) Operator() bool {
+	return strings.Contains(r.Flags, "*")
+}
+
+// Who asks the server about the users matching the mask
+func (b *Bot) Who(ctx context.Context, mask string) ([]WhoReply, error) {
+	replies, err := b.query(ctx, &msg.Message{
+		Command: irc.Who,
+		Params:  []string{mask},
+	}, mask, whoQuery)
+
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]WhoReply, 0, len(replies))
+	for _, message := range replies {
+		// <reply> ::= '352' <me> <channel> <user> <host> <server> <nick> <flags> ':' <hops> <realname>
+		hops, realname := message.Trailing, ""
+		if space := strings.IndexByte(hops, ' '); space > -1 {
+			hops, realname = hops[:space], hops[space+1:]
+		}
+
+		user := WhoReply{
+			Channel:  message.Param(1),
+			User:     message.Param(2),
+			Host:     message.Param(3),
+			Server:   message.Param(4),
+			Nick:     message.Param(5),
+			Flags:    message.Param(6),
+			Realname: realname,
+		}
+		user.Hops, _ = strconv.Atoi(hops)
+
+		users = append(users, user)
+	}
+
+	return users, nil
+}
+
+// Name is a user in the reply to a NAMES query with the
+// membership prefixes such as '@' for channel operators
+type Name struct {
+	Nick     string
+	Prefixes string
+}
+
+// Names asks the server about the users in the channel
+func (b *Bot) Names(ctx context.Context, channel string) ([]Name, error) {
+	replies, err := b.query(ctx, &msg.Message{
+		Command: irc.Names,
+		Params:  []string{channel},
+	}, channel, namesQuery)
+
+	if err != nil {
+		return nil, err
+	}
+
+	symbols := b.prefixSymbols()
+
+	var names []Name
+	for _, message := range replies {
+		for _, entry := range strings.Fields(message.Trailing) {
+			nick := strings.TrimLeft(entry, symbols)
+			names = append(names, Name{
+				Nick:     msg.ParsePrefix(nick).Name,
+				Prefixes: entry[:len(entry)-len(nick)],
+			})
+		}
+	}
+
+	return names, nil
+}
+
+// ModeReply is the reply to a channel MODE query
+type ModeReply struct {
+	Channel string
+	Modes   string
+	Params  []string
+}
+
+// ChannelModes asks the server about the modes of the channel
+func (b *Bot) ChannelModes(ctx context.Context, channel string) (*ModeReply, error) {
+	replies, err := b.query(ctx, &msg.Message{
+		Command: irc.Mode,
+		Params:  []string{channel},
+	}, channel, modeQuery)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// <reply> ::= '324' <me> <channel> <modes> { <param> }
+	reply := &ModeReply{Channel: channel}
+	if len(replies) > 0 {
+		if params := replies[0].AllParams(); len(params) > 2 {
+			params = params[2:]
+			reply.Modes = params[0]
+			reply.Params = params[1:]
+		}
+	}
+
+	return reply, nil
+}
+
+// Ban is an entry in the ban list of a channel. Expires is
+// only set for the timed bans of the bot.
+type Ban struct {
+	Mask    string
+	Setter  string
+	Set     time.Time
+	Expires time.Time
+}
+
+// BanList asks the server about the bans in the channel
+func (b *Bot) BanList(ctx context.Context, channel string) ([]Ban, error) {
+	replies, err := b.query(ctx, &msg.Message{
+		Command: irc.Mode,
+		Params:  []string{channel, "+b"},
+	}, channel, banQuery)
+
+	if err != nil {
+		return nil, err
+	}
+
+	bans := make([]Ban, 0, len(replies))
+	for _, message := range replies {
+		// <reply> ::= '367' <me> <channel> <mask> [ <setter> [ <time> ] ]
+		ban := Ban{
+			Mask:   message.Param(2),
+			Setter: message.Param(3),
+		}
+
+		if seconds, err := strconv.ParseInt(message.Param(4), 10, 64); err == nil {
+			ban.Set = time.Unix(seconds, 0)
+		}
+
+		bans = append(bans, ban)
+	}
+
+	return bans, nil
+}
@@ -0,0 +1,211 @@
+package bot
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jriddick/geoffrey/msg"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestQueries(t *testing.T) {
+	parse := func(raw string) *msg.Message {
+		message, err := msg.ParseMessage(raw)
+		So(err, ShouldBeNil)
+		return message
+	}
+
+	Convey("With a querying bot", t, func() {
+		writer := make(chan *msg.Message, 10)
+		bot := &Bot{
+			writer: writer,
+		}
+		bot.config.Identification.Nick = "geoffrey"
+
+		// answer runs the query and replies to it as the server
+		answer := func(query func() error, sent string, lines ...string) error {
+			done := make(chan error, 1)
+			go func() {
+				done <- query()
+			}()
+
+			So((<-writer).String(), ShouldEqual, sent)
+			for _, line := range lines {
+				bot.collect(parse(line))
+			}
+
+			return <-done
+		}
+
+		Convey("Should collect the WHOIS replies", func() {
+			var whois *WhoisReply
+			err := answer(func() (err error) {
+				whois, err = bot.Whois(context.Background(), "jriddick")
+				return
+			}, "WHOIS jriddick",
+				":irc.example.com 311 geoffrey JRiddick user host * :Real Name",
+				":irc.example.com 312 geoffrey jriddick irc.example.com :Example",
+				":irc.example.com 319 geoffrey jriddick :@#geoffrey #other",
+				":irc.example.com 401 geoffrey other :No such nick",
+				":irc.example.com 317 geoffrey jriddick 42 1590000000 :seconds idle, signon time",
+				":irc.example.com 330 geoffrey jriddick riddick :is logged in as",
+				":irc.example.com 318 geoffrey jriddick :End of /WHOIS list.",
+			)
+			So(err, ShouldBeNil)
+			So(whois.Nick, ShouldEqual, "JRiddick")
+			So(whois.Host, ShouldEqual, "host")
+			So(whois.Realname, ShouldEqual, "Real Name")
+			So(whois.Server, ShouldEqual, "irc.example.com")
+			So(whois.Channels, ShouldResemble, []string{"@#geoffrey", "#other"})
+			So(whois.Idle, ShouldEqual, 42*time.Second)
+			So(whois.SignOn.Unix(), ShouldEqual, 1590000000)
+			So(whois.Account, ShouldEqual, "riddick")
+		})
+
+		Convey("Should fail WHOIS for unknown nicks", func() {
+			err := answer(func() error {
+				_, err := bot.Whois(context.Background(), "nobody")
+				return err
+			}, "WHOIS nobody",
+				":irc.example.com 401 geoffrey nobody :No such nick",
+				":irc.example.com 318 geoffrey nobody :End of /WHOIS list.",
+			)
+			So(err, ShouldEqual, ErrNoSuchNick)
+		})
+
+		Convey("Should collect the WHO replies", func() {
+			var users []WhoReply
+			err := answer(func() (err error) {
+				users, err = bot.Who(context.Background(), "#geoffrey")
+				return
+			}, "WHO #geoffrey",
+				":irc.example.com 352 geoffrey #geoffrey user host irc.example.com jriddick G@ :0 Real Name",
+				":irc.example.com 352 geoffrey #geoffrey bot host irc.example.com geoffrey H* :1 Geoffrey",
+				":irc.example.com 315 geoffrey #geoffrey :End of /WHO list.",
+			)
+			So(err, ShouldBeNil)
+			So(users, ShouldHaveLength, 2)
+			So(users[0].Nick, ShouldEqual, "jriddick")
+			So(users[0].Realname, ShouldEqual, "Real Name")
+			So(users[0].Away(), ShouldBeTrue)
+			So(users[1].Hops, ShouldEqual, 1)
+			So(users[1].Operator(), ShouldBeTrue)
+		})
+
+		Convey("Should collect the NAMES replies of the channel", func() {
+			var names []Name
+			err := answer(func() (err error) {
+				names, err = bot.Names(context.Background(), "#geoffrey")
+				return
+			}, "NAMES #geoffrey",
+				":irc.example.com 353 geoffrey = #other :someone",
+				":irc.example.com 353 geoffrey = #geoffrey :@geoffrey +jriddick",
+				":irc.example.com 353 geoffrey = #geoffrey :other!user@host",
+				":irc.example.com 366 geoffrey #geoffrey :End of /NAMES list.",
+			)
+			So(err, ShouldBeNil)
+			So(names, ShouldResemble, []Name{
+				{Nick: "geoffrey", Prefixes: "@"},
+				{Nick: "jriddick", Prefixes: "+"},
+				{Nick: "other"},
+			})
+		})
+
+		Convey("Should collect the channel modes", func() {
+			var modes *ModeReply
+			err := answer(func() (err error) {
+				modes, err = bot.ChannelModes(context.Background(), "#geoffrey")
+				return
+			}, "MODE #geoffrey",
+				":irc.example.com 324 geoffrey #geoffrey +ntlk 10 :hunter2",
+			)
+			So(err, ShouldBeNil)
+			So(modes.Modes, ShouldEqual, "+ntlk")
+			So(modes.Params, ShouldResemble, []string{"10", "hunter2"})
+		})
+
+		Convey("Should fail for unknown channels", func() {
+			err := answer(func() error {
+				_, err := bot.ChannelModes(context.Background(), "#nowhere")
+				return err
+			}, "MODE #nowhere",
+				":irc.example.com 403 geoffrey #nowhere :No such channel",
+			)
+			So(err, ShouldEqual, ErrNoSuchChannel)
+		})
+
+		Convey("Should collect the ban list", func() {
+			var bans []Ban
+			err := answer(func() (err error) {
+				bans, err = bot.BanList(context.Background(), "#geoffrey")
+				return
+			}, "MODE #geoffrey +b",
+				":irc.example.com 367 geoffrey #geoffrey *!*@spam jriddick 1590000000",
+				":irc.example.com 367 geoffrey #geoffrey $a:troll",
+				":irc.example.com 368 geoffrey #geoffrey :End of channel ban list",
+			)
+			So(err, ShouldBeNil)
+			So(bans, ShouldHaveLength, 2)
+			So(bans[0].Setter, ShouldEqual, "jriddick")
+			So(bans[0].Set.Unix(), ShouldEqual, 1590000000)
+			So(bans[1].Mask, ShouldEqual, "$a:troll")
+		})
+
+		Convey("Should serialize queries in flight", func() {
+			done := make(chan []WhoReply, 2)
+			for _, mask := range []string{"#a", "#b"} {
+				go func(mask string) {
+					users, _ := bot.Who(context.Background(), mask)
+					done <- users
+				}(mask)
+			}
+
+			for i := 0; i < 2; i++ {
+				query := <-writer
+				So(writer, ShouldBeEmpty)
+
+				mask := query.Params[0]
+				bot.collect(parse(":irc.example.com 352 geoffrey " + mask + " user host irc.example.com nick H :0 Name"))
+				bot.collect(parse(":irc.example.com 315 geoffrey " + mask + " :End of /WHO list."))
+
+				users := <-done
+				So(users, ShouldHaveLength, 1)
+				So(users[0].Channel, ShouldEqual, mask)
+			}
+		})
+
+		Convey("Should wait for the accounts of a joined channel before querying it", func() {
+			bot.trackISupport(parse(":irc.example.com 005 geoffrey WHOX :are supported by this server"))
+			bot.trackUsers(parse(":geoffrey!bot@host JOIN #geoffrey"))
+			So((<-writer).String(), ShouldEqual, "WHO #geoffrey %tnuhraf,1")
+
+			done := make(chan []WhoReply, 1)
+			go func() {
+				users, _ := bot.Who(context.Background(), "#geoffrey")
+				done <- users
+			}()
+			time.Sleep(10 * time.Millisecond)
+
+			// The end of the accounts must not end the query
+			bot.collect(parse(":irc.example.com 354 geoffrey 1 user host jriddick H jriddick :Real Name"))
+			bot.collect(parse(":irc.example.com 315 geoffrey #geoffrey :End of /WHO list."))
+
+			So((<-writer).String(), ShouldEqual, "WHO #geoffrey")
+			bot.collect(parse(":irc.example.com 352 geoffrey #geoffrey user host irc.example.com jriddick H :0 Real Name"))
+			bot.collect(parse(":irc.example.com 352 geoffrey #geoffrey bot host irc.example.com geoffrey H :0 Geoffrey"))
+			bot.collect(parse(":irc.example.com 315 geoffrey #geoffrey :End of /WHO list."))
+			So(<-done, ShouldHaveLength, 2)
+		})
+
+		Convey("Should time out without a reply", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+
+			_, err := bot.Names(ctx, "#geoffrey")
+			So(err, ShouldEqual, ErrQueryTimeout)
+			So(bot.queries.current, ShouldBeNil)
+		})
+	})
+}
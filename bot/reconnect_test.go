@@ -0,0 +1,199 @@
+package bot
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jpillora/backoff"
+	"github.com/jriddick/geoffrey/mockd"
+	"github.com/jriddick/geoffrey/msg"
+	log "github.com/sirupsen/logrus"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// harnessNotices receives the notices seen by the harness
+var harnessNotices = make(chan string, 100)
+
+// harnessHandler registers, joins the tracked channels and
+// answers pings like the plugins would
+var harnessHandler = Handler{
+	Name:        "Harness",
+	Description: "Registers and joins for the end-to-end tests",
+	Event:       "NOTICE",
+	Run: func(bot *Bot, message *msg.Message) (bool, error) {
+		switch message.Command {
+		case "NOTICE":
+			if message.Trailing != "*** Looking up your hostname..." {
+				harnessNotices <- message.Trailing
+				return true, nil
+			}
+
+			config := bot.Config()
+			bot.Nick(config.Identification.Nick)
+			bot.User(config.Identification.User, config.Identification.Name)
+		case "001":
+			for _, channel := range bot.Channels() {
+				bot.JoinKey(channel.Name, channel.Key)
+			}
+		case "PING":
+			bot.Pong(message.LastParam())
+		}
+
+		return true, nil
+	},
+}
+
+func init() {
+	for _, event := range []string{"NOTICE", "001", "PING"} {
+		handler := harnessHandler
+		handler.Event = event
+		RegisterHandler(handler)
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	Convey("With a bot connected to a faulty server", t, func() {
+		server := mockd.NewMockd(0)
+		server.PingInterval = 50 * time.Millisecond
+		server.PingTimeout = 50 * time.Millisecond
+		server.Capabilities["message-tags"] = ""
+		server.Capabilities["server-time"] = ""
+		So(server.Listen(), ShouldBeNil)
+		go server.Handle()
+
+		dir, err := ioutil.TempDir("", "geoffrey")
+		So(err, ShouldBeNil)
+
+		config := Config{
+			BotName:  "geoffrey",
+			Hostname: "127.0.0.1",
+			Port:     server.Port,
+			Channels: []string{"#geoffrey"},
+			Plugins:  []string{"Harness"},
+			Database: dir,
+		}
+		config.Identification.Nick = "geoffrey"
+		config.Identification.User = "geoffrey"
+		config.Identification.Name = "Geoffrey"
+		config.Timings.Timeout = 300
+		config.Limits.Messages = 100
+
+		bot, err := NewBot(config)
+		So(err, ShouldBeNil)
+		bot.reconnects = backoff.Backoff{
+			Min: 10 * time.Millisecond,
+			Max: 50 * time.Millisecond,
+		}
+
+		// rejoined waits until the bot has registered on a new
+		// connection and joined the channel again
+		rejoined := func(old *mockd.Client) *mockd.Client {
+			deadline := time.Now().Add(5 * time.Second)
+
+			for {
+				client, err := server.WaitClient("geoffrey", time.Until(deadline))
+				So(err, ShouldBeNil)
+
+				if client == old {
+					time.Sleep(10 * time.Millisecond)
+					continue
+				}
+
+				join, err := client.Expect("JOIN", time.Until(deadline))
+				So(err, ShouldBeNil)
+				So(join.Params, ShouldResemble, []string{"#geoffrey"})
+
+				return client
+			}
+		}
+
+		So(bot.Connect(), ShouldBeNil)
+		bot.Run()
+
+		client := rejoined(nil)
+
+		Convey("Should negotiate the advertised capabilities", func() {
+			So(bot.Capabilities(), ShouldResemble, []string{"message-tags", "server-time"})
+			So(bot.HasCapability("sasl"), ShouldBeFalse)
+		})
+
+		Convey("Should negotiate again after reconnecting", func() {
+			client.Close()
+			rejoined(client)
+
+			So(bot.Capabilities(), ShouldResemble, []string{"message-tags", "server-time"})
+		})
+
+		Convey("Should rejoin after the connection is dropped", func() {
+			client.Close()
+			rejoined(client)
+		})
+
+		Convey("Should rejoin after the server closes the link", func() {
+			client.Kill("Killed")
+			rejoined(client)
+		})
+
+		Convey("Should rejoin after the connection goes half-open", func() {
+			client.Freeze()
+			rejoined(client)
+		})
+
+		Convey("Should keep retrying while K-lined", func() {
+			server.KLine("*!*@127.0.0.1", "Spamming")
+
+			_, err := server.WaitClient("geoffrey", 200*time.Millisecond)
+			So(err, ShouldEqual, mockd.ErrTimeout)
+
+			server.UnKLine("*!*@127.0.0.1")
+			rejoined(client)
+		})
+
+		Convey("Should keep retrying while connections are refused", func() {
+			server.Refuse(true)
+			client.Close()
+
+			_, err := server.WaitClient("geoffrey", 200*time.Millisecond)
+			So(err, ShouldEqual, mockd.ErrTimeout)
+
+			server.Refuse(false)
+			rejoined(client)
+		})
+
+		Convey("Should assemble partial lines", func() {
+			So(client.SendRaw(":geoffrey.com NOTICE geoffrey :hel"), ShouldBeNil)
+			time.Sleep(20 * time.Millisecond)
+			So(client.SendRaw("lo\r\n"), ShouldBeNil)
+
+			So(<-harnessNotices, ShouldEqual, "hello")
+		})
+
+		Convey("Should stay connected through slow reads", func() {
+			client.SetDelay(100 * time.Millisecond)
+
+			for _, text := range []string{"one", "two", "three"} {
+				So(client.Send(":geoffrey.com NOTICE geoffrey :"+text), ShouldBeNil)
+			}
+
+			So(<-harnessNotices, ShouldEqual, "one")
+			So(<-harnessNotices, ShouldEqual, "two")
+			So(<-harnessNotices, ShouldEqual, "three")
+
+			current, err := server.WaitClient("geoffrey", time.Second)
+			So(err, ShouldBeNil)
+			So(current, ShouldEqual, client)
+		})
+
+		Reset(func() {
+			bot.Close()
+			So(server.Stop(), ShouldBeNil)
+			bot.Store().Close()
+			os.RemoveAll(dir)
+		})
+	})
+}
@@ -0,0 +1,132 @@
+package bot
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jriddick/geoffrey/mockd"
+	"github.com/jriddick/geoffrey/transcript"
+	log "github.com/sirupsen/logrus"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestReplay(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	Convey("With a recorded session", t, func() {
+		dir, err := ioutil.TempDir("", "geoffrey")
+		So(err, ShouldBeNil)
+
+		config := Config{
+			BotName:    "geoffrey",
+			Hostname:   "127.0.0.1",
+			Channels:   []string{"#geoffrey"},
+			Plugins:    []string{"Harness"},
+			Database:   filepath.Join(dir, "record"),
+			Transcript: filepath.Join(dir, "session.log"),
+		}
+		config.Identification.Nick = "geoffrey"
+		config.Identification.User = "geoffrey"
+		config.Identification.Name = "Geoffrey"
+		config.Timings.Timeout = 1000
+		config.Limits.Messages = 100
+		config.Services.NickServ = "NickServ"
+		config.Services.Password = "hunter2"
+
+		server := mockd.NewMockd(0)
+		So(server.Listen(), ShouldBeNil)
+		go server.Handle()
+
+		config.Port = server.Port
+		recording, err := NewBot(config)
+		So(err, ShouldBeNil)
+		So(recording.Connect(), ShouldBeNil)
+		recording.Run()
+
+		client, err := server.WaitClient("geoffrey", 5*time.Second)
+		So(err, ShouldBeNil)
+		_, err = client.Expect("JOIN", 5*time.Second)
+		So(err, ShouldBeNil)
+
+		// Identify the way services and custom templates do
+		So(recording.Send("NickServ", "IDENTIFY geoffrey hunter2"), ShouldBeNil)
+		So(recording.Send("NickServ", "ID hunter2"), ShouldBeNil)
+		for i := 0; i < 2; i++ {
+			_, err = client.Expect("PRIVMSG", 5*time.Second)
+			So(err, ShouldBeNil)
+		}
+
+		recording.Close()
+		So(server.Stop(), ShouldBeNil)
+		recording.Store().Close()
+
+		recorded, err := ioutil.ReadFile(config.Transcript)
+		So(err, ShouldBeNil)
+		entries, err := transcript.Read(bytes.NewReader(recorded))
+		So(err, ShouldBeNil)
+
+		Convey("Should not record the password", func() {
+			So(string(recorded), ShouldNotContainSubstring, "hunter2")
+			So(string(recorded), ShouldContainSubstring, "> PRIVMSG NickServ :IDENTIFY <redacted>\n")
+			So(string(recorded), ShouldContainSubstring, "> PRIVMSG NickServ :ID <redacted>\n")
+		})
+
+		// Keep the session up to the join
+		for i, entry := range entries {
+			if entry.Direction == transcript.Outbound && entry.Line == "JOIN #geoffrey" {
+				entries = entries[:i+1]
+				break
+			}
+		}
+		So(entries[len(entries)-1].Line, ShouldEqual, "JOIN #geoffrey")
+
+		// replay runs a new bot against the entries
+		replay := func(entries []transcript.Entry) *mockd.Diff {
+			replayer := mockd.NewReplayer(0, entries)
+			replayer.Timeout = time.Second
+			So(replayer.Listen(), ShouldBeNil)
+			go replayer.Handle()
+			defer replayer.Stop()
+
+			config.Port = replayer.Port
+			config.Database = filepath.Join(dir, "replay")
+			config.Transcript = ""
+
+			bot, err := NewBot(config)
+			So(err, ShouldBeNil)
+			defer bot.Store().Close()
+			defer bot.Close()
+
+			So(bot.Connect(), ShouldBeNil)
+			bot.Run()
+
+			diff, err := replayer.Run()
+			So(err, ShouldBeNil)
+
+			return diff
+		}
+
+		Convey("Should replay without differences", func() {
+			diff := replay(entries)
+			So(diff.String(), ShouldEqual, "")
+		})
+
+		Convey("Should report the lines that changed", func() {
+			entries[len(entries)-1].Line = "JOIN #other"
+
+			diff := replay(entries)
+			So(diff.Missing, ShouldResemble, []mockd.Line{{Number: len(entries), Text: "JOIN #other"}})
+			So(diff.Unexpected, ShouldHaveLength, 1)
+			So(diff.Unexpected[0].Text, ShouldEqual, "JOIN #geoffrey")
+		})
+
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+	})
+}
@@ -0,0 +1,108 @@
+package bot
+
+import (
+	"reflect"
+	"sort"
+)
+
+// schemaFields holds the constraints of the fields in the schema
+// by their path. They follow the checks of Validate.
+var schemaFields = map[string]map[string]interface{}{
+	"name":                {"description": "Name of the bot, unique among the bots"},
+	"host":                {"description": "Hostname of the IRC server"},
+	"port":                {"minimum": 1, "maximum": 65535},
+	"secure.verify":       {"description": "Verify the certificate of the server"},
+	"services.nickserv":   {"description": "Nick of NickServ, 'NickServ' if not set"},
+	"services.chanserv":   {"description": "Nick of ChanServ, 'ChanServ' if not set"},
+	"services.timeout":    {"minimum": 0, "description": "Milliseconds to wait for the services"},
+	"channels":            {"description": "Channels to join, optionally followed by a space and the key"},
+	"joins.delay":         {"minimum": 0, "description": "Milliseconds to wait before rejoining"},
+	"joins.retry":         {"minimum": 0, "description": "Milliseconds between attempts to join"},
+	"joins.retries":       {"minimum": 0},
+	"timings.timeout":     {"minimum": 1, "description": "Milliseconds without traffic before reconnecting"},
+	"timings.compaction":  {"minimum": 0, "description": "Milliseconds between compactions of the database, 0 for every hour"},
+	"limits.rate":         {"minimum": 0, "maximum": 1000, "description": "Messages sent per second, 0 for the default"},
+	"limits.retries":      {"minimum": 0},
+	"admins":              {"description": "Masks of the administrators such as '$a:account' or 'nick!user@host'. A bare nick matches anyone using that nick"},
+	"database":            {"description": "Database such as './db', 'bolt:./db.bolt' or 'sqlite:./db.sqlite'"},
+	"transcript":          {"description": "File to record the session to"},
+	"settings":            {"description": "Settings of the plugins by their name"},
+	"identification.nick": {"minLength": 1},
+	"identification.user": {"minLength": 1},
+}
+
+// schemaRequired holds the required fields by the path of their struct
+var schemaRequired = map[string][]string{
+	"":               {"name", "host", "port", "identification", "database", "timings"},
+	"identification": {"nick", "user"},
+	"timings":        {"timeout"},
+}
+
+// Schema returns the JSON Schema of the configuration of a bot.
+// The plugins are limited to those registered.
+func Schema() map[string]interface{} {
+	schema := typeSchema("", reflect.TypeOf(Config{}))
+
+	plugins := make([]string, 0, len(HandlerList))
+	for name := range HandlerList {
+		plugins = append(plugins, name)
+	}
+	sort.Strings(plugins)
+
+	properties := schema["properties"].(map[string]interface{})
+	properties["plugins"] = map[string]interface{}{
+		"type":        "array",
+		"uniqueItems": true,
+		"items":       map[string]interface{}{"enum": plugins},
+	}
+
+	return schema
+}
+
+// typeSchema returns the schema of the type at the path
+func typeSchema(path string, kind reflect.Type) map[string]interface{} {
+	schema := make(map[string]interface{})
+
+	switch kind.Kind() {
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		for i := 0; i < kind.NumField(); i++ {
+			field := kind.Field(i)
+
+			key := configKey(field)
+			if path != "" {
+				key = path + "." + key
+			}
+
+			properties[configKey(field)] = typeSchema(key, field.Type)
+		}
+
+		schema["type"] = "object"
+		schema["properties"] = properties
+		schema["additionalProperties"] = false
+
+		if required, ok := schemaRequired[path]; ok {
+			schema["required"] = required
+		}
+	case reflect.Map:
+		schema["type"] = "object"
+		if kind.Elem().Kind() != reflect.Interface {
+			schema["additionalProperties"] = typeSchema(path+".*", kind.Elem())
+		}
+	case reflect.Slice:
+		schema["type"] = "array"
+		schema["items"] = typeSchema(path+"[]", kind.Elem())
+	case reflect.String:
+		schema["type"] = "string"
+	case reflect.Int:
+		schema["type"] = "integer"
+	case reflect.Bool:
+		schema["type"] = "boolean"
+	}
+
+	for key, value := range schemaFields[path] {
+		schema[key] = value
+	}
+
+	return schema
+}
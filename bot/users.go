@@ -0,0 +1,321 @@
+package bot
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jriddick/geoffrey/irc"
+	"github.com/jriddick/geoffrey/msg"
+)
+
+// whoxToken marks the WHOX replies to our own account queries
+const whoxToken = "1"
+
+// whoxFields are the fields requested with WHOX, replied in
+// the order token, user, host, nick, flags, account and realname
+const whoxFields = "%tnuhraf"
+
+// User is a user sharing a channel with the bot. Account is
+// empty when the user is not logged in to services or when
+// the account is not known yet.
+type User struct {
+	Nick     string
+	User     string
+	Host     string
+	Account  string
+	Realname string
+	Channels []string
+}
+
+// member is a tracked user and the channels it is in
+type member struct {
+	User
+	channels map[string]string
+}
+
+// users holds the users sharing a channel with the bot
+type users struct {
+	sync.RWMutex
+	members map[string]*member
+}
+
+// user returns a copy of the tracked user with its channels
+func (m *member) user() User {
+	user := m.User
+	user.Channels = make([]string, 0, len(m.channels))
+	for _, channel := range m.channels {
+		user.Channels = append(user.Channels, channel)
+	}
+	sort.Strings(user.Channels)
+
+	return user
+}
+
+// LookupUser returns the tracked user with the nick
+func (b *Bot) LookupUser(nick string) (User, bool) {
+	mapping := b.CaseMapping()
+
+	b.users.RLock()
+	defer b.users.RUnlock()
+
+	if member, ok := b.users.members[mapping.Fold(nick)]; ok {
+		return member.user(), true
+	}
+
+	return User{}, false
+}
+
+// Account returns the services account of the user with the
+// nick, or an empty string if the user is not logged in or
+// not tracked by the bot
+func (b *Bot) Account(nick string) string {
+	mapping := b.CaseMapping()
+
+	b.users.RLock()
+	defer b.users.RUnlock()
+
+	if member, ok := b.users.members[mapping.Fold(nick)]; ok {
+		return member.Account
+	}
+
+	return ""
+}
+
+// Members returns the tracked users in the channel sorted by nick
+func (b *Bot) Members(channel string) []User {
+	mapping := b.CaseMapping()
+	key := mapping.Fold(channel)
+
+	b.users.RLock()
+	defer b.users.RUnlock()
+
+	var members []User
+	for _, member := range b.users.members {
+		if _, ok := member.channels[key]; ok {
+			members = append(members, member.user())
+		}
+	}
+
+	sort.Slice(members, func(i, j int) bool {
+		return mapping.Fold(members[i].Nick) < mapping.Fold(members[j].Nick)
+	})
+
+	return members
+}
+
+// account returns the account name sent by the server where
+// '*' and '0' mean that the user is not logged in
+func account(name string) string {
+	if name == "*" || name == "0" {
+		return ""
+	}
+
+	return name
+}
+
+// trackUsers updates the tracked users and their accounts from
+// the messages received by the bot and attaches the account of
+// the sender to the message.
+func (b *Bot) trackUsers(message *msg.Message) {
+	// Look up the accounts of everyone in the channels we join. It
+	// waits for its turn as the end of its replies would otherwise
+	// end a query about the same channel.
+	if channel := b.updateUsers(message); channel != "" {
+		if _, ok := b.ISupport("WHOX"); ok {
+			go b.query(context.Background(), &msg.Message{
+				Command: irc.Who,
+				Params:  []string{channel, whoxFields + "," + whoxToken},
+			}, channel, whoxQuery)
+		}
+	}
+}
+
+// updateUsers updates the tracked users from the message and
+// returns the channel if it was joined by the bot
+func (b *Bot) updateUsers(message *msg.Message) string {
+	mapping := b.CaseMapping()
+	prefixes := b.prefixSymbols()
+
+	b.users.Lock()
+	defer b.users.Unlock()
+
+	if b.users.members == nil {
+		b.users.members = make(map[string]*member)
+	}
+
+	var sender *member
+	if message.Prefix != nil && !message.Prefix.IsServer() {
+		sender = b.users.members[mapping.Fold(message.Prefix.Name)]
+	}
+
+	// Attach the account from the tag or our own tracking
+	if _, ok := message.Tags[msg.AccountTag]; ok {
+		message.Account = account(message.Tags[msg.AccountTag])
+		if sender != nil {
+			sender.Account = message.Account
+		}
+	} else if sender != nil {
+		message.Account = sender.Account
+	}
+
+	switch message.Command {
+	case irc.Welcome:
+		// Nobody shares a channel with us after registration
+		b.users.members = make(map[string]*member)
+	case irc.Join:
+		if message.Prefix == nil {
+			return ""
+		}
+
+		channel := message.Trailing
+		if len(message.Params) > 0 {
+			channel = message.Params[0]
+		}
+
+		if sender == nil {
+			sender = b.addMember(message.Prefix.Name, mapping)
+		}
+		sender.User.User = message.Prefix.User
+		sender.Host = message.Prefix.Host
+		sender.channels[mapping.Fold(channel)] = channel
+
+		// Extended joins carry the account and the realname
+		if len(message.Params) > 1 {
+			sender.Account = account(message.Params[1])
+			sender.Realname = message.Trailing
+			message.Account = sender.Account
+		}
+
+		if b.IsMe(message.Prefix.Name) {
+			return channel
+		}
+	case irc.Part:
+		if message.Prefix != nil && len(message.Params) > 0 {
+			b.removeMember(message.Prefix.Name, message.Params[0], mapping)
+		}
+	case irc.Kick:
+		if len(message.Params) > 1 {
+			b.removeMember(message.Params[1], message.Params[0], mapping)
+		}
+	case irc.Quit:
+		if sender != nil {
+			delete(b.users.members, mapping.Fold(sender.Nick))
+		}
+	case irc.Nick:
+		nick := message.Trailing
+		if len(message.Params) > 0 {
+			nick = message.Params[0]
+		}
+
+		if sender != nil && nick != "" {
+			delete(b.users.members, mapping.Fold(sender.Nick))
+			sender.Nick = nick
+			b.users.members[mapping.Fold(nick)] = sender
+		}
+	case irc.Account:
+		name := message.Trailing
+		if len(message.Params) > 0 {
+			name = message.Params[0]
+		}
+
+		if sender != nil {
+			sender.Account = account(name)
+			message.Account = sender.Account
+		}
+	case irc.Namreply:
+		// <reply> ::= '353' <nick> <type> <channel> ':' <prefixed nick> { ' ' <prefixed nick> }
+		if len(message.Params) < 3 {
+			return ""
+		}
+
+		channel := message.Params[2]
+		for _, name := range strings.Fields(message.Trailing) {
+			prefix := msg.ParsePrefix(strings.TrimLeft(name, prefixes))
+			if prefix.Name == "" {
+				continue
+			}
+
+			user, ok := b.users.members[mapping.Fold(prefix.Name)]
+			if !ok {
+				user = b.addMember(prefix.Name, mapping)
+			}
+
+			// Names may include the user and host with userhost-in-names
+			if prefix.User != "" {
+				user.User.User = prefix.User
+				user.Host = prefix.Host
+			}
+
+			user.channels[mapping.Fold(channel)] = channel
+		}
+	case irc.Whospcrpl:
+		// <reply> ::= '354' <nick> <token> <user> <host> <nick> <flags> <account> ':' <realname>
+		if message.Param(1) != whoxToken || len(message.Params) < 7 {
+			return ""
+		}
+
+		if user, ok := b.users.members[mapping.Fold(message.Params[4])]; ok {
+			user.User.User = message.Params[2]
+			user.Host = message.Params[3]
+			user.Account = account(message.Params[6])
+			user.Realname = message.Trailing
+		}
+	}
+
+	return ""
+}
+
+// addMember starts tracking the user with the nick
+func (b *Bot) addMember(nick string, mapping msg.CaseMapping) *member {
+	user := &member{
+		User:     User{Nick: nick},
+		channels: make(map[string]string),
+	}
+	b.users.members[mapping.Fold(nick)] = user
+
+	return user
+}
+
+// removeMember removes the user from the channel and stops
+// tracking it once it no longer shares a channel with us. When
+// we leave the channel ourselves everyone is removed from it.
+func (b *Bot) removeMember(nick, channel string, mapping msg.CaseMapping) {
+	key := mapping.Fold(channel)
+
+	remove := func(name string, user *member) {
+		delete(user.channels, key)
+		if len(user.channels) == 0 {
+			delete(b.users.members, name)
+		}
+	}
+
+	if !b.IsMe(nick) {
+		if user, ok := b.users.members[mapping.Fold(nick)]; ok {
+			remove(mapping.Fold(nick), user)
+		}
+		return
+	}
+
+	for name, user := range b.users.members {
+		remove(name, user)
+	}
+}
+
+// prefixSymbols returns the channel membership prefixes
+// advertised by the server.
+//
+// <PREFIX> ::= '(' <modes> ')' <symbols>
+func (b *Bot) prefixSymbols() string {
+	b.isupport.RLock()
+	defer b.isupport.RUnlock()
+
+	if value, ok := b.isupport.tokens["PREFIX"]; ok {
+		if end := strings.IndexByte(value, ')'); end > -1 {
+			return value[end+1:]
+		}
+	}
+
+	return "~&@%+"
+}
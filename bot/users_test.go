@@ -0,0 +1,107 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/jriddick/geoffrey/msg"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUsers(t *testing.T) {
+	parse := func(raw string) *msg.Message {
+		message, err := msg.ParseMessage(raw)
+		So(err, ShouldBeNil)
+		return message
+	}
+
+	Convey("With a tracking bot", t, func() {
+		writer := make(chan *msg.Message, 10)
+		bot := &Bot{
+			writer: writer,
+		}
+		bot.config.Identification.Nick = "geoffrey"
+
+		bot.trackISupport(parse(":irc.example.com 005 geoffrey WHOX CASEMAPPING=rfc1459 PREFIX=(ov)@+ :are supported by this server"))
+		bot.trackUsers(parse(":geoffrey!bot@host JOIN #geoffrey"))
+		So((<-writer).String(), ShouldEqual, "WHO #geoffrey %tnuhraf,1")
+		bot.collect(parse(":irc.example.com 315 geoffrey #geoffrey :End of /WHO list."))
+
+		bot.trackUsers(parse(":irc.example.com 353 geoffrey = #geoffrey :@geoffrey +jriddick other"))
+		bot.trackUsers(parse(":irc.example.com 354 geoffrey 1 user host JRiddick H@ jriddick :Name"))
+		bot.trackUsers(parse(":irc.example.com 354 geoffrey 1 user host other H 0 :Other"))
+
+		Convey("Should track the users from the names", func() {
+			members := bot.Members("#Geoffrey")
+			So(members, ShouldHaveLength, 3)
+			So(members[1].Nick, ShouldEqual, "jriddick")
+			So(members[1].Channels, ShouldResemble, []string{"#geoffrey"})
+		})
+
+		Convey("Should track the accounts from WHOX", func() {
+			user, ok := bot.LookupUser("JRIDDICK")
+			So(ok, ShouldBeTrue)
+			So(user.Account, ShouldEqual, "jriddick")
+			So(user.Host, ShouldEqual, "host")
+			So(user.Realname, ShouldEqual, "Name")
+
+			So(bot.Account("other"), ShouldBeEmpty)
+		})
+
+		Convey("Should track accounts from account-notify", func() {
+			bot.trackUsers(parse(":other!user@host ACCOUNT other"))
+			So(bot.Account("other"), ShouldEqual, "other")
+
+			bot.trackUsers(parse(":other!user@host ACCOUNT *"))
+			So(bot.Account("other"), ShouldBeEmpty)
+		})
+
+		Convey("Should track accounts from extended-join", func() {
+			message := parse(":new!user@host JOIN #geoffrey new :New User")
+			bot.trackUsers(message)
+
+			So(message.Account, ShouldEqual, "new")
+			So(bot.Account("new"), ShouldEqual, "new")
+		})
+
+		Convey("Should track accounts from the account tag", func() {
+			bot.trackUsers(parse("@account=other :other!user@host PRIVMSG #geoffrey :hello"))
+			So(bot.Account("other"), ShouldEqual, "other")
+		})
+
+		Convey("Should attach the tracked account to messages", func() {
+			message := parse(":jriddick!user@host PRIVMSG #geoffrey :hello")
+			bot.trackUsers(message)
+
+			So(message.Account, ShouldEqual, "jriddick")
+		})
+
+		Convey("Should follow nick changes", func() {
+			bot.trackUsers(parse(":jriddick!user@host NICK :riddick"))
+
+			_, ok := bot.LookupUser("jriddick")
+			So(ok, ShouldBeFalse)
+			So(bot.Account("riddick"), ShouldEqual, "jriddick")
+		})
+
+		Convey("Should forget users that leave", func() {
+			bot.trackUsers(parse(":jriddick!user@host PART #geoffrey"))
+			bot.trackUsers(parse(":other!user@host QUIT :bye"))
+
+			So(bot.Members("#geoffrey"), ShouldHaveLength, 1)
+		})
+
+		Convey("Should forget everyone when we leave", func() {
+			bot.trackUsers(parse(":op!user@host KICK #geoffrey geoffrey :bye"))
+
+			So(bot.Members("#geoffrey"), ShouldBeEmpty)
+		})
+
+		Convey("Should trust administrators by account", func() {
+			bot.admins, _ = msg.NewMaskSet(msg.RFC1459, "$a:jriddick")
+
+			So(bot.IsAdmin(msg.ParsePrefix("jriddick!user@host")), ShouldBeTrue)
+			So(bot.IsAdmin(msg.ParsePrefix("other!user@host")), ShouldBeFalse)
+		})
+	})
+}
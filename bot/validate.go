@@ -0,0 +1,285 @@
+package bot
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jriddick/geoffrey/irc"
+	"github.com/jriddick/geoffrey/msg"
+)
+
+// FieldError is a problem with a field of the configuration
+type FieldError struct {
+	// Field is the path of the field such as 'limits.rate'
+	Field string
+	// Problem describes what is wrong with the field
+	Problem string
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Problem
+}
+
+// ConfigErrors holds all problems found in a configuration
+type ConfigErrors []*FieldError
+
+func (e ConfigErrors) Error() string {
+	problems := make([]string, len(e))
+	for i, err := range e {
+		problems[i] = err.Error()
+	}
+
+	return strings.Join(problems, "\n")
+}
+
+// prefixed returns the errors with the prefix added to the fields
+func (e ConfigErrors) prefixed(prefix string) ConfigErrors {
+	errs := make(ConfigErrors, len(e))
+	for i, err := range e {
+		errs[i] = &FieldError{Field: prefix + err.Field, Problem: err.Problem}
+	}
+
+	return errs
+}
+
+// validator collects the problems of a configuration
+type validator struct {
+	errs ConfigErrors
+}
+
+func (v *validator) fail(field, format string, args ...interface{}) {
+	v.errs = append(v.errs, &FieldError{Field: field, Problem: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) required(field, value string) {
+	if strings.TrimSpace(value) == "" {
+		v.fail(field, "is required")
+	}
+}
+
+func (v *validator) between(field string, value, min, max int) {
+	if value < min || value > max {
+		v.fail(field, "must be between %d and %d, got %d", min, max, value)
+	}
+}
+
+func (v *validator) positive(field string, value int) {
+	if value < 0 {
+		v.fail(field, "must not be negative, got %d", value)
+	}
+}
+
+func (v *validator) pattern(field, pattern string) {
+	if _, err := regexp.Compile(pattern); err != nil {
+		v.fail(field, "%v", err)
+	}
+}
+
+func (v *validator) encoding(field, name string) {
+	if _, err := irc.LookupEncoding(name); err != nil {
+		v.fail(field, "unknown encoding '%s'", name)
+	}
+}
+
+// Validate checks the configuration of a bot before it is used
+// and returns ConfigErrors with every problem found
+func (c Config) Validate() error {
+	v := &validator{}
+
+	v.required("name", c.BotName)
+	v.required("host", c.Hostname)
+	v.between("port", c.Port, 1, 65535)
+	v.required("identification.nick", c.Identification.Nick)
+	v.required("identification.user", c.Identification.User)
+	v.required("database", c.Database)
+
+	v.positive("services.timeout", c.Services.Timeout)
+	v.pattern("services.success", c.Services.Success)
+	v.pattern("services.failure", c.Services.Failure)
+
+	for i, channel := range c.Channels {
+		v.required(fmt.Sprintf("channels[%d]", i), channel)
+	}
+
+	v.encoding("encoding.default", c.Encoding.Default)
+	v.encoding("encoding.fallback", c.Encoding.Fallback)
+	for _, channel := range sortedKeys(c.Encoding.Channels) {
+		v.encoding("encoding.channels."+channel, c.Encoding.Channels[channel])
+	}
+
+	v.positive("joins.delay", c.Joins.Delay)
+	v.positive("joins.retry", c.Joins.Retry)
+	v.positive("joins.retries", c.Joins.Retries)
+
+	// The connection times out immediately without a timeout
+	if c.Timings.Timeout <= 0 {
+		v.fail("timings.timeout", "must be at least 1 millisecond, got %d", c.Timings.Timeout)
+	}
+	v.positive("timings.compaction", c.Timings.Compaction)
+
+	// A rate of 0 uses the default of the client
+	v.between("limits.rate", c.Limits.Messages, 0, 1000)
+	v.positive("limits.retries", c.Limits.Timeout)
+
+	for i, admin := range c.Admins {
+		if _, err := msg.NewMaskSet(msg.RFC1459, admin); err != nil {
+			v.fail(fmt.Sprintf("admins[%d]", i), "%v", err)
+		}
+	}
+
+	plugins := make(map[string]bool)
+	for i, plugin := range c.Plugins {
+		field := fmt.Sprintf("plugins[%d]", i)
+
+		if _, ok := HandlerList[plugin]; !ok {
+			v.fail(field, "unknown plugin '%s'", plugin)
+		} else if plugins[plugin] {
+			v.fail(field, "plugin '%s' is enabled twice", plugin)
+		}
+
+		plugins[plugin] = true
+	}
+
+	if len(v.errs) > 0 {
+		return v.errs
+	}
+
+	return nil
+}
+
+// ValidateConfigs checks the configurations of all bots and that
+// their names are unique. The fields in the returned ConfigErrors
+// start with the index of the bot such as 'bots[0].port'.
+func ValidateConfigs(configs []Config) error {
+	var errs ConfigErrors
+
+	if len(configs) == 0 {
+		errs = append(errs, &FieldError{Field: "bots", Problem: "at least one bot is required"})
+	}
+
+	names := make(map[string]int)
+	for i, config := range configs {
+		prefix := fmt.Sprintf("bots[%d].", i)
+
+		if err, ok := config.Validate().(ConfigErrors); ok {
+			errs = append(errs, err.prefixed(prefix)...)
+		}
+
+		if first, ok := names[config.BotName]; ok && config.BotName != "" {
+			errs = append(errs, &FieldError{
+				Field:   prefix + "name",
+				Problem: fmt.Sprintf("'%s' is already the name of bots[%d]", config.BotName, first),
+			})
+		} else {
+			names[config.BotName] = i
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// CheckKeys returns ConfigErrors for the keys in the raw bot
+// configurations, as read from the configuration file, that do
+// not match any field of Config and would be ignored
+func CheckKeys(bots interface{}) error {
+	var errs ConfigErrors
+
+	if list, ok := bots.([]interface{}); ok {
+		for i, raw := range list {
+			errs = append(errs, checkKeys(fmt.Sprintf("bots[%d]", i), reflect.TypeOf(Config{}), raw)...)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// checkKeys walks the raw value alongside the type and returns
+// the keys without a matching field
+func checkKeys(path string, kind reflect.Type, raw interface{}) ConfigErrors {
+	var errs ConfigErrors
+
+	switch kind.Kind() {
+	case reflect.Struct:
+		values := rawMap(raw)
+
+		for _, key := range sortedKeys(values) {
+			field, ok := configField(kind, key)
+			if !ok {
+				errs = append(errs, &FieldError{Field: path + "." + key, Problem: "unknown key"})
+				continue
+			}
+
+			errs = append(errs, checkKeys(path+"."+key, field.Type, values[key])...)
+		}
+	case reflect.Slice:
+		if list, ok := raw.([]interface{}); ok {
+			for i, item := range list {
+				errs = append(errs, checkKeys(fmt.Sprintf("%s[%d]", path, i), kind.Elem(), item)...)
+			}
+		}
+	}
+
+	return errs
+}
+
+// rawMap returns the map read by viper or the YAML decoder
+func rawMap(raw interface{}) map[string]interface{} {
+	values := make(map[string]interface{})
+
+	switch raw := raw.(type) {
+	case map[string]interface{}:
+		for key, value := range raw {
+			values[key] = value
+		}
+	case map[interface{}]interface{}:
+		for key, value := range raw {
+			values[fmt.Sprint(key)] = value
+		}
+	}
+
+	return values
+}
+
+// configKey returns the key of the field in the configuration
+// file, which is matched without regard to case
+func configKey(field reflect.StructField) string {
+	if tag := field.Tag.Get("mapstructure"); tag != "" {
+		return strings.Split(tag, ",")[0]
+	}
+
+	return strings.ToLower(field.Name)
+}
+
+// configField returns the field of the struct with the key
+func configField(kind reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < kind.NumField(); i++ {
+		if field := kind.Field(i); strings.EqualFold(configKey(field), key) {
+			return field, true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
+
+// sortedKeys returns the keys of the map in order
+func sortedKeys(values interface{}) []string {
+	var keys []string
+
+	for _, key := range reflect.ValueOf(values).MapKeys() {
+		keys = append(keys, key.String())
+	}
+
+	sort.Strings(keys)
+	return keys
+}
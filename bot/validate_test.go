@@ -0,0 +1,171 @@
+package bot
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// validConfig returns a configuration without problems
+func validConfig() Config {
+	RegisterHandler(Handler{Name: "Validated", Event: "PING"})
+
+	config := Config{
+		BotName:  "geoffrey",
+		Hostname: "irc.oftc.net",
+		Port:     6697,
+		Channels: []string{"#geoffrey", "#secret key"},
+		Admins:   []string{"jriddick", "$a:jriddick"},
+		Plugins:  []string{"Validated"},
+		Database: "memory:",
+	}
+	config.Identification.Nick = "geoffrey"
+	config.Identification.User = "geoffrey"
+	config.Timings.Timeout = 300000
+	config.Encoding.Channels = map[string]string{"#latin": "latin1"}
+
+	return config
+}
+
+// fields returns the fields of the configuration errors
+func fields(err error) []string {
+	var fields []string
+
+	if errs, ok := err.(ConfigErrors); ok {
+		for _, err := range errs {
+			fields = append(fields, err.Field)
+		}
+	}
+
+	return fields
+}
+
+func TestValidate(t *testing.T) {
+	Convey("With the configuration of a bot", t, func() {
+		config := validConfig()
+
+		Convey("Should accept a valid configuration", func() {
+			So(config.Validate(), ShouldBeNil)
+		})
+
+		Convey("Should report every missing field", func() {
+			So(fields(Config{}.Validate()), ShouldResemble, []string{
+				"name", "host", "port", "identification.nick",
+				"identification.user", "database", "timings.timeout",
+			})
+		})
+
+		Convey("Should refuse values out of range", func() {
+			config.Port = 70000
+			config.Limits.Messages = -1
+			config.Joins.Delay = -5
+
+			err := config.Validate()
+			So(fields(err), ShouldResemble, []string{"port", "joins.delay", "limits.rate"})
+			So(err.Error(), ShouldContainSubstring, "port: must be between 1 and 65535, got 70000")
+		})
+
+		Convey("Should accept a services password with the default NickServ", func() {
+			config.Services.Password = "hunter2"
+			So(config.Validate(), ShouldBeNil)
+		})
+
+		Convey("Should accept a rate of 0 for the default", func() {
+			config.Limits.Messages = 0
+			So(config.Validate(), ShouldBeNil)
+		})
+
+		Convey("Should refuse unknown and repeated plugins", func() {
+			config.Plugins = []string{"Validated", "Missing", "Validated"}
+
+			err := config.Validate()
+			So(fields(err), ShouldResemble, []string{"plugins[1]", "plugins[2]"})
+			So(err.Error(), ShouldContainSubstring, "unknown plugin 'Missing'")
+		})
+
+		Convey("Should refuse unknown encodings and broken patterns", func() {
+			config.Encoding.Channels["#broken"] = "ebcdic"
+			config.Services.Success = "(unclosed"
+
+			So(fields(config.Validate()), ShouldResemble, []string{
+				"services.success", "encoding.channels.#broken",
+			})
+		})
+	})
+
+	Convey("With the configurations of several bots", t, func() {
+		first, second := validConfig(), validConfig()
+
+		Convey("Should refuse bots with the same name", func() {
+			err := ValidateConfigs([]Config{first, second})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "bots[1].name: 'geoffrey' is already the name of bots[0]")
+		})
+
+		Convey("Should prefix the fields with the bot", func() {
+			second.BotName = "other"
+			second.Port = 0
+
+			So(fields(ValidateConfigs([]Config{first, second})), ShouldResemble, []string{"bots[1].port"})
+		})
+
+		Convey("Should require a bot", func() {
+			So(fields(ValidateConfigs(nil)), ShouldResemble, []string{"bots"})
+		})
+	})
+}
+
+func TestCheckKeys(t *testing.T) {
+	Convey("With the raw configurations of the bots", t, func() {
+		bots := []interface{}{
+			map[interface{}]interface{}{
+				"name": "geoffrey",
+				"Host": "irc.oftc.net",
+				"timings": map[interface{}]interface{}{
+					"timeout": 300000,
+					"message": 500,
+				},
+				"limits":   map[interface{}]interface{}{"rate": 2},
+				"encoding": map[interface{}]interface{}{"channels": map[interface{}]interface{}{"#any": "latin1"}},
+				"settings": map[interface{}]interface{}{"title": map[interface{}]interface{}{"anything": true}},
+				"plugin":   []interface{}{"Ping"},
+			},
+		}
+
+		Convey("Should report the keys without a field", func() {
+			err := CheckKeys(bots)
+			So(fields(err), ShouldResemble, []string{"bots[0].plugin", "bots[0].timings.message"})
+			So(err.Error(), ShouldContainSubstring, "bots[0].timings.message: unknown key")
+		})
+
+		Convey("Should accept known keys", func() {
+			So(CheckKeys([]interface{}{map[string]interface{}{"name": "geoffrey"}}), ShouldBeNil)
+		})
+	})
+}
+
+func TestSchema(t *testing.T) {
+	Convey("With the schema of the configuration", t, func() {
+		validConfig()
+		schema := Schema()
+
+		Convey("Should encode to JSON", func() {
+			_, err := json.Marshal(schema)
+			So(err, ShouldBeNil)
+		})
+
+		Convey("Should describe the fields by their keys", func() {
+			properties := schema["properties"].(map[string]interface{})
+			So(properties, ShouldContainKey, "name")
+			So(properties["services"].(map[string]interface{})["properties"], ShouldContainKey, "nickserv")
+			So(properties["limits"].(map[string]interface{})["properties"], ShouldContainKey, "rate")
+			So(properties["port"].(map[string]interface{})["maximum"], ShouldEqual, 65535)
+		})
+
+		Convey("Should list the registered plugins", func() {
+			plugins := schema["properties"].(map[string]interface{})["plugins"].(map[string]interface{})
+			So(plugins["items"].(map[string]interface{})["enum"], ShouldContain, "Validated")
+		})
+	})
+}
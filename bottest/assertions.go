@@ -0,0 +1,105 @@
+package bottest
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ShouldHaveReplied receives a *Bot, a target and a regular
+// expression and passes if the bot sent a message or notice to
+// the target matching the expression. It can be used with So.
+func ShouldHaveReplied(actual interface{}, expected ...interface{}) string {
+	fake, target, pattern, failure := replyArguments(actual, expected)
+	if failure != "" {
+		return failure
+	}
+
+	if fake.Replied(target, pattern) {
+		return ""
+	}
+
+	return fmt.Sprintf("Expected a reply to '%s' matching '%s' but the bot sent:\n%s", target, pattern, sentLines(fake))
+}
+
+// ShouldNotHaveReplied is the opposite of ShouldHaveReplied
+func ShouldNotHaveReplied(actual interface{}, expected ...interface{}) string {
+	fake, target, pattern, failure := replyArguments(actual, expected)
+	if failure != "" {
+		return failure
+	}
+
+	if !fake.Replied(target, pattern) {
+		return ""
+	}
+
+	return fmt.Sprintf("Expected no reply to '%s' matching '%s' but the bot sent:\n%s", target, pattern, sentLines(fake))
+}
+
+// ShouldHaveSent receives a *Bot and a raw line and passes if
+// the bot sent the line
+func ShouldHaveSent(actual interface{}, expected ...interface{}) string {
+	fake, ok := actual.(*Bot)
+	if !ok {
+		return fmt.Sprintf("Expected a *bottest.Bot but got %T", actual)
+	}
+
+	if len(expected) != 1 {
+		return fmt.Sprintf("Expected a line but got %d arguments", len(expected))
+	}
+
+	line, ok := expected[0].(string)
+	if !ok {
+		return fmt.Sprintf("Expected the line to be a string but got %T", expected[0])
+	}
+
+	for _, message := range fake.Sent() {
+		if message.String() == line {
+			return ""
+		}
+	}
+
+	return fmt.Sprintf("Expected the bot to send '%s' but it sent:\n%s", line, sentLines(fake))
+}
+
+// replyArguments checks the arguments of the reply assertions
+func replyArguments(actual interface{}, expected []interface{}) (*Bot, string, string, string) {
+	fake, ok := actual.(*Bot)
+	if !ok {
+		return nil, "", "", fmt.Sprintf("Expected a *bottest.Bot but got %T", actual)
+	}
+
+	if len(expected) != 2 {
+		return nil, "", "", fmt.Sprintf("Expected a target and a pattern but got %d arguments", len(expected))
+	}
+
+	target, ok := expected[0].(string)
+	if !ok {
+		return nil, "", "", fmt.Sprintf("Expected the target to be a string but got %T", expected[0])
+	}
+
+	pattern, ok := expected[1].(string)
+	if !ok {
+		return nil, "", "", fmt.Sprintf("Expected the pattern to be a string but got %T", expected[1])
+	}
+
+	if _, err := regexp.Compile(pattern); err != nil {
+		return nil, "", "", fmt.Sprintf("Expected a valid pattern but got: %v", err)
+	}
+
+	return fake, target, pattern, ""
+}
+
+// sentLines returns the lines sent by the bot, one per line
+func sentLines(fake *Bot) string {
+	var lines []string
+	for _, message := range fake.Sent() {
+		lines = append(lines, "  "+message.String())
+	}
+
+	if len(lines) == 0 {
+		return "  (nothing)"
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,205 @@
+// Package bottest provides a bot for testing plugins without
+// a server. The bot is a real bot.Bot that keeps its data in
+// memory, runs its timers on a fake clock and captures the
+// messages it sends:
+//
+//	fake, err := bottest.New(config)
+//	defer fake.Close()
+//
+//	fake.FeedLine(":jriddick!jr@geoffrey.com PRIVMSG #geoffrey :!hello")
+//	So(fake, bottest.ShouldHaveReplied, "#geoffrey", "^Hello")
+package bottest
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/jriddick/geoffrey/bot"
+	"github.com/jriddick/geoffrey/msg"
+	"github.com/jriddick/geoffrey/storage"
+)
+
+// outbox is how many messages can be sent between two reads
+// of the sent messages
+const outbox = 1024
+
+// Bot is a bot that is not connected to a server
+type Bot struct {
+	*bot.Bot
+
+	// Clock drives the timers of the bot and its plugins
+	Clock *Clock
+
+	// Memory keeps the data of the bot
+	Memory *storage.Memory
+
+	writer chan *msg.Message
+	lock   sync.Mutex
+	sent   []*msg.Message
+}
+
+// New creates a bot with an in-memory store and a clock
+// stopped at Epoch, and initializes the configured plugins
+func New(config bot.Config) (*Bot, error) {
+	clock := NewClock(Epoch)
+	writer := make(chan *msg.Message, outbox)
+
+	// Expire the keys by the fake clock
+	store := storage.NewMemory()
+	store.Now = clock.Now
+
+	offline, err := bot.NewOfflineBot(config, store, clock, writer)
+	if err != nil {
+		return nil, err
+	}
+
+	fake := &Bot{
+		Bot:    offline,
+		Clock:  clock,
+		Memory: store,
+		writer: writer,
+	}
+
+	for _, name := range config.Plugins {
+		handler, ok := bot.HandlerList[name]
+		if !ok {
+			fake.Close()
+			return nil, fmt.Errorf("%w: %s", ErrUnknownPlugin, name)
+		}
+
+		if handler.Init == nil {
+			continue
+		}
+
+		if _, err := handler.Init(offline); err != nil {
+			fake.Close()
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	return fake, nil
+}
+
+// Close stops the bot and its timers and drops the stored data
+func (b *Bot) Close() {
+	b.Bot.Close()
+	b.Memory.Close()
+}
+
+// Feed passes the message to the bot as if it had been read
+// from the server and waits until the handlers have returned.
+// Handlers waiting for replies from the server, like queries,
+// block until they time out.
+func (b *Bot) Feed(message *msg.Message) {
+	b.Handle(message)
+}
+
+// FeedLine parses the raw line and feeds it to the bot
+func (b *Bot) FeedLine(raw string) error {
+	message, err := msg.ParseMessage(raw)
+	if err != nil {
+		return err
+	}
+
+	b.Feed(message)
+	return nil
+}
+
+// Enter feeds the bot joining the channel and then the users
+// with the prefixes joining it, so that plugins see a joined
+// channel and its tracked users
+func (b *Bot) Enter(channel string, users ...string) error {
+	nick := b.Config().Identification.Nick
+
+	for _, prefix := range append([]string{nick + "!" + nick + "@bottest"}, users...) {
+		if err := b.FeedLine(":" + prefix + " JOIN " + channel); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Login feeds the user with the prefix logging in to the
+// services account. The user has to share a channel with the
+// bot for the account to be tracked.
+func (b *Bot) Login(prefix, account string) error {
+	return b.FeedLine(":" + prefix + " ACCOUNT " + account)
+}
+
+// Sent returns the messages sent by the bot so far
+func (b *Bot) Sent() []*msg.Message {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for {
+		select {
+		case message := <-b.writer:
+			b.sent = append(b.sent, message)
+		default:
+			sent := make([]*msg.Message, len(b.sent))
+			copy(sent, b.sent)
+			return sent
+		}
+	}
+}
+
+// Clear forgets the messages sent by the bot so far
+func (b *Bot) Clear() {
+	b.Sent()
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.sent = nil
+}
+
+// Commands returns the messages sent by the bot with the
+// command
+func (b *Bot) Commands(command string) []*msg.Message {
+	var messages []*msg.Message
+
+	for _, message := range b.Sent() {
+		if strings.EqualFold(message.Command, command) {
+			messages = append(messages, message)
+		}
+	}
+
+	return messages
+}
+
+// Replies returns the text of the messages and notices sent
+// by the bot to the target
+func (b *Bot) Replies(target string) []string {
+	var replies []string
+	mapping := b.CaseMapping()
+
+	for _, message := range b.Sent() {
+		if message.Command != "PRIVMSG" && message.Command != "NOTICE" {
+			continue
+		}
+
+		if mapping.Equal(message.Param(0), target) {
+			replies = append(replies, message.LastParam())
+		}
+	}
+
+	return replies
+}
+
+// Replied returns true if the bot sent a message or notice to
+// the target matching the regular expression. It panics if the
+// expression is invalid.
+func (b *Bot) Replied(target, pattern string) bool {
+	expression := regexp.MustCompile(pattern)
+
+	for _, reply := range b.Replies(target) {
+		if expression.MatchString(reply) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,151 @@
+package bottest
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/jriddick/geoffrey/bot"
+	"github.com/jriddick/geoffrey/msg"
+	_ "github.com/jriddick/geoffrey/plugins"
+	log "github.com/sirupsen/logrus"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// greeterHandler greets the users saying hello
+var greeterHandler = bot.Handler{
+	Name:        "Greeter",
+	Description: "Greets the users saying hello",
+	Event:       "PRIVMSG",
+	Run: func(bot *bot.Bot, message *msg.Message) (bool, error) {
+		if message.Trailing != "!hello" || message.Prefix == nil {
+			return false, nil
+		}
+
+		bot.Send(message.Params[0], "Hello "+message.Prefix.Name)
+		return true, nil
+	},
+}
+
+func init() {
+	bot.RegisterHandler(greeterHandler)
+}
+
+func TestBot(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	Convey("With a fake bot", t, func() {
+		config := bot.Config{
+			Channels: []string{"#geoffrey"},
+			Plugins:  []string{"Ping", "Join", "Greeter"},
+		}
+		config.Identification.Nick = "geoffrey"
+		config.Joins.Rejoin = true
+
+		fake, err := New(config)
+		So(err, ShouldBeNil)
+
+		Convey("Should reply through the plugins", func() {
+			So(fake.FeedLine(":jriddick!jr@geoffrey.com PRIVMSG #geoffrey :!hello"), ShouldBeNil)
+
+			So(fake, ShouldHaveReplied, "#GEOFFREY", "^Hello jriddick$")
+			So(fake, ShouldNotHaveReplied, "#geoffrey", "stranger")
+			So(fake.Replies("#geoffrey"), ShouldResemble, []string{"Hello jriddick"})
+		})
+
+		Convey("Should capture the sent messages", func() {
+			ping, err := msg.Build("PING").Trailing("geoffrey.com").Message()
+			So(err, ShouldBeNil)
+
+			fake.Feed(ping)
+
+			So(fake, ShouldHaveSent, "PONG :geoffrey.com")
+			So(fake.Commands("pong"), ShouldHaveLength, 1)
+
+			fake.Clear()
+			So(fake.Sent(), ShouldBeEmpty)
+		})
+
+		Convey("Should run the timers when the clock is advanced", func() {
+			So(fake.FeedLine(":jriddick!jr@geoffrey.com KICK #geoffrey geoffrey :Bye"), ShouldBeNil)
+			So(fake.Commands("JOIN"), ShouldBeEmpty)
+
+			fake.Clock.Advance(4 * time.Second)
+			So(fake.Commands("JOIN"), ShouldBeEmpty)
+
+			fake.Clock.Advance(time.Second)
+			So(fake, ShouldHaveSent, "JOIN #geoffrey")
+			So(fake.Now(), ShouldResemble, Epoch.Add(5*time.Second))
+		})
+
+		Convey("Should keep the data in memory", func() {
+			So(fake.TimedBan("#geoffrey", "*!*@spam.com", time.Minute), ShouldBeNil)
+
+			bans, err := fake.TimedBans("#geoffrey")
+			So(err, ShouldBeNil)
+			So(bans, ShouldHaveLength, 1)
+			So(bans[0].Expires, ShouldResemble, Epoch.Add(time.Minute))
+		})
+
+		Convey("Should join channels with users logged in", func() {
+			So(fake.Enter("#geoffrey", "jriddick!jr@geoffrey.com", "other!o@geoffrey.com"), ShouldBeNil)
+			So(fake.Login("jriddick!jr@geoffrey.com", "riddick"), ShouldBeNil)
+
+			channel, ok := fake.Channel("#geoffrey")
+			So(ok, ShouldBeTrue)
+			So(channel.Joined, ShouldBeTrue)
+
+			So(fake.Members("#geoffrey"), ShouldHaveLength, 3)
+			So(fake.Account("jriddick"), ShouldEqual, "riddick")
+		})
+
+		Convey("Should explain the failed assertions", func() {
+			So(ShouldHaveReplied(fake, "#geoffrey", "^Hello"), ShouldContainSubstring, "(nothing)")
+			So(ShouldHaveReplied(fake, "#geoffrey", "("), ShouldStartWith, "Expected a valid pattern")
+			So(ShouldHaveSent(nil, "PING"), ShouldEqual, "Expected a *bottest.Bot but got <nil>")
+		})
+
+		Reset(func() {
+			fake.Close()
+		})
+	})
+
+	Convey("With a plugin that does not exist", t, func() {
+		_, err := New(bot.Config{Plugins: []string{"Missing"}})
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestClock(t *testing.T) {
+	Convey("With a fake clock", t, func() {
+		clock := NewClock(Epoch)
+
+		var fired []string
+		clock.AfterFunc(2*time.Second, func() { fired = append(fired, "second") })
+		clock.AfterFunc(time.Second, func() {
+			fired = append(fired, "first")
+			clock.AfterFunc(500*time.Millisecond, func() { fired = append(fired, "nested") })
+		})
+
+		Convey("Should not move by itself", func() {
+			So(clock.Now(), ShouldResemble, Epoch)
+			So(clock.Pending(), ShouldEqual, 2)
+		})
+
+		Convey("Should run the timers in order", func() {
+			clock.Advance(3 * time.Second)
+
+			So(fired, ShouldResemble, []string{"first", "nested", "second"})
+			So(clock.Now(), ShouldResemble, Epoch.Add(3*time.Second))
+			So(clock.Pending(), ShouldEqual, 0)
+		})
+
+		Convey("Should only run the expired timers", func() {
+			clock.Advance(time.Second)
+
+			So(fired, ShouldResemble, []string{"first"})
+			So(clock.Pending(), ShouldEqual, 2)
+		})
+	})
+}
@@ -0,0 +1,88 @@
+package bottest
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Epoch is the time a new Clock starts at
+var Epoch = time.Date(2020, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+// timer is a function waiting for the clock to reach its time
+type timer struct {
+	at time.Time
+	f  func()
+}
+
+// Clock is a fake clock that only moves when advanced. The
+// timers run in the goroutine advancing the clock.
+type Clock struct {
+	lock   sync.Mutex
+	now    time.Time
+	timers []timer
+}
+
+// NewClock returns a clock stopped at the time
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now returns the time of the clock
+func (c *Clock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.now
+}
+
+// AfterFunc runs the function once the clock has been
+// advanced by the duration
+func (c *Clock) AfterFunc(duration time.Duration, f func()) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.timers = append(c.timers, timer{at: c.now.Add(duration), f: f})
+}
+
+// Pending returns the number of timers that have not run
+func (c *Clock) Pending() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return len(c.timers)
+}
+
+// Advance moves the clock forward by the duration and runs
+// the timers that expire on the way in order. Timers created
+// by those timers run as well if they expire in time.
+func (c *Clock) Advance(duration time.Duration) {
+	c.lock.Lock()
+	end := c.now.Add(duration)
+
+	for {
+		// Find the next timer to expire, keeping the order
+		// in which timers for the same time were created
+		sort.SliceStable(c.timers, func(i, j int) bool {
+			return c.timers[i].at.Before(c.timers[j].at)
+		})
+
+		if len(c.timers) == 0 || c.timers[0].at.After(end) {
+			break
+		}
+
+		next := c.timers[0]
+		c.timers = c.timers[1:]
+		if next.at.After(c.now) {
+			c.now = next.at
+		}
+
+		// Run the timer without the lock so it can use the clock
+		c.lock.Unlock()
+		next.f()
+		c.lock.Lock()
+	}
+
+	c.now = end
+	c.lock.Unlock()
+}
@@ -0,0 +1,9 @@
+package bottest
+
+import "errors"
+
+var (
+	// ErrUnknownPlugin occurs when the configuration enables
+	// a plugin that has not been registered
+	ErrUnknownPlugin = errors.New("bottest: Plugin has not been registered")
+)
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jriddick/geoffrey/bot"
+	log "github.com/sirupsen/logrus"
+)
+
+// runCommand connects the configured bots and runs them until
+// the process is signalled to stop
+func runCommand(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	path := flags.String("config", "", "configuration file (default ./config.yaml)")
+
+	if err := flags.Parse(args); err != nil {
+		return exitCode(err)
+	}
+
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+
+	log.Infoln("[geoffrey] Running")
+
+	// Load the configuration
+	bots, err := loadConfig(*path)
+	if err != nil {
+		log.Errorf("[geoffrey] %v", err)
+		return 1
+	}
+
+	// Refuse to start with any problem in the configuration
+	if err := validateConfig(bots); err != nil {
+		for _, problem := range err.(bot.ConfigErrors) {
+			log.Errorf("[geoffrey] Invalid configuration: %v", problem)
+		}
+		return 1
+	}
+
+	// Configure the logger level
+	level, err := logLevel()
+	if err != nil {
+		log.Errorf("[geoffrey] %v", err)
+		return 1
+	}
+	log.SetLevel(level)
+
+	// Create the manager
+	manager := bot.NewManager()
+
+	// Add all bots to the manager
+	for _, config := range bots {
+		instance, err := bot.NewBot(config)
+		if err != nil {
+			log.Errorf("[%s] %v", config.BotName, err)
+			return 1
+		}
+		if err := manager.Add(config.BotName, instance); err != nil {
+			log.Errorf("[%s] %v", config.BotName, err)
+			return 1
+		}
+
+		log.Infof("[geoffrey] Added bot '%s'", config.BotName)
+	}
+
+	log.Infof("[geoffrey] Started")
+
+	// Listen and run
+	if err := manager.Run(); err != nil {
+		log.Errorf("[geoffrey] %v", err)
+		return 1
+	}
+
+	return 0
+}
+
+// checkConfigCommand reads the configuration without connecting
+// and reports if it is usable
+func checkConfigCommand(args []string) int {
+	flags := flag.NewFlagSet("check-config", flag.ContinueOnError)
+	path := flags.String("config", "", "configuration file (default ./config.yaml)")
+
+	if err := flags.Parse(args); err != nil {
+		return exitCode(err)
+	}
+
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+
+	bots, err := loadConfig(*path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "geoffrey: %v\n", err)
+		return 1
+	}
+
+	if err := validateConfig(bots); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Configuration is valid with %d bots\n", len(bots))
+	return 0
+}
+
+// pluginsCommand lists the registered plugins with the events
+// they handle
+func pluginsCommand(args []string) int {
+	flags := flag.NewFlagSet("plugins", flag.ContinueOnError)
+
+	if err := flags.Parse(args); err != nil {
+		return exitCode(err)
+	}
+
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+
+	// A plugin can register handlers for several events
+	events := make(map[string][]string)
+	for event, handlers := range bot.Handlers {
+		for name := range handlers {
+			if event != "" {
+				events[name] = append(events[name], event)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(bot.HandlerList))
+	for name := range bot.HandlerList {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(writer, "NAME\tEVENTS\tDESCRIPTION")
+
+	for _, name := range names {
+		sort.Strings(events[name])
+
+		list := strings.Join(events[name], ",")
+		if list == "" {
+			list = "-"
+		}
+
+		fmt.Fprintf(writer, "%s\t%s\t%s\n", name, list, bot.HandlerList[name].Description)
+	}
+
+	if err := writer.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "geoffrey: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+// schemaCommand writes the JSON Schema of the configuration
+func schemaCommand(args []string) int {
+	flags := flag.NewFlagSet("schema", flag.ContinueOnError)
+	output := flags.String("o", "-", "file to write the schema to")
+
+	if err := flags.Parse(args); err != nil {
+		return exitCode(err)
+	}
+
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+
+	data, err := json.MarshalIndent(configSchema(), "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "geoffrey: %v\n", err)
+		return 1
+	}
+	data = append(data, '\n')
+
+	if *output == "-" {
+		_, err = os.Stdout.Write(data)
+	} else {
+		err = ioutil.WriteFile(*output, data, 0644)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "geoffrey: %v\n", err)
+		return 1
+	}
+
+	return 0
+}
+
+// versionCommand prints the version
+func versionCommand(args []string) int {
+	flags := flag.NewFlagSet("version", flag.ContinueOnError)
+
+	if err := flags.Parse(args); err != nil {
+		return exitCode(err)
+	}
+
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+
+	fmt.Printf("geoffrey %s (%s %s/%s)\n", version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	return 0
+}
+
+// exitCode returns the exit code for an error parsing the flags
+func exitCode(err error) int {
+	if err == flag.ErrHelp {
+		return 0
+	}
+
+	return 2
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jriddick/geoffrey/bot"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// logLevels are the log levels in the configuration
+var logLevels = []string{"DEBUG", "INFO", "WARN", "WARNING", "ERROR", "FATAL", "PANIC"}
+
+// configKeys are the keys of the configuration outside of the bots
+var configKeys = map[string]bool{
+	"logs":          true,
+	"logs.location": true,
+	"logs.level":    true,
+	"bots":          true,
+}
+
+// loadConfig reads the configuration from the file, or from
+// config.yaml in the current directory if the path is empty,
+// and returns the configured bots
+func loadConfig(path string) ([]bot.Config, error) {
+	if path != "" {
+		viper.SetConfigFile(path)
+	}
+
+	if err := viper.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("Could not read configuration: %v", err)
+	}
+
+	// Get the bot configurations
+	var bots []bot.Config
+
+	// Unmarshal the bots
+	if err := viper.UnmarshalKey("bots", &bots); err != nil {
+		return nil, fmt.Errorf("Could not read configuration: %v", err)
+	}
+
+	return bots, nil
+}
+
+// validateConfig checks the loaded configuration and returns
+// bot.ConfigErrors with every problem found
+func validateConfig(bots []bot.Config) error {
+	var errs bot.ConfigErrors
+
+	for _, key := range viper.AllKeys() {
+		if !configKeys[key] && !strings.HasPrefix(key, "bots.") {
+			errs = append(errs, &bot.FieldError{Field: key, Problem: "unknown key"})
+		}
+	}
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].Field < errs[j].Field
+	})
+
+	if _, err := logLevel(); err != nil {
+		errs = append(errs, &bot.FieldError{
+			Field:   "logs.level",
+			Problem: fmt.Sprintf("unknown level '%s'", viper.GetString("logs.level")),
+		})
+	}
+
+	if err, ok := bot.CheckKeys(viper.Get("bots")).(bot.ConfigErrors); ok {
+		errs = append(errs, err...)
+	}
+
+	if err, ok := bot.ValidateConfigs(bots).(bot.ConfigErrors); ok {
+		errs = append(errs, err...)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// logLevel returns the configured log level
+func logLevel() (log.Level, error) {
+	switch level := viper.GetString("logs.level"); strings.ToUpper(level) {
+	case "DEBUG":
+		return log.DebugLevel, nil
+	case "INFO":
+		return log.InfoLevel, nil
+	case "WARN", "WARNING":
+		return log.WarnLevel, nil
+	case "ERROR":
+		return log.ErrorLevel, nil
+	case "FATAL":
+		return log.FatalLevel, nil
+	case "PANIC":
+		return log.PanicLevel, nil
+	default:
+		return 0, fmt.Errorf("Tried to set log level to '%s'", level)
+	}
+}
+
+// configSchema returns the JSON Schema of the configuration file
+func configSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"$schema":              "http://json-schema.org/draft-07/schema#",
+		"title":                "Geoffrey configuration",
+		"type":                 "object",
+		"additionalProperties": false,
+		"required":             []string{"bots"},
+		"properties": map[string]interface{}{
+			"logs": map[string]interface{}{
+				"type":                 "object",
+				"additionalProperties": false,
+				"properties": map[string]interface{}{
+					"location": map[string]interface{}{"type": "string"},
+					"level":    map[string]interface{}{"enum": logLevels},
+				},
+			},
+			"bots": map[string]interface{}{
+				"type":     "array",
+				"minItems": 1,
+				"items":    bot.Schema(),
+			},
+		},
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/jriddick/geoffrey/storage"
+)
+
+// dbUsage is printed for the db command
+const dbUsage = `Usage: geoffrey db [flags] <command> [arguments]
+
+Maintains the database of a bot. The bot has to be stopped as
+the database can only be opened by one process at a time.
+
+Commands:
+  backup [-o file] [-prefix prefix]  dump the keys as JSON lines
+  restore [-i file]                  restore the keys of a dump
+  compact                            reclaim the space of deleted keys
+  inspect                            list the namespaces and their keys
+  delete <prefix>                    delete the keys with the prefix
+
+Flags:
+`
+
+// dbCommand runs the database maintenance commands and returns
+// the exit code
+func dbCommand(args []string) int {
+	flags := flag.NewFlagSet("db", flag.ContinueOnError)
+	database := flags.String("database", "", "database source, e.g. bolt:./db.bolt")
+	name := flags.String("bot", "", "bot in the configuration whose database to use")
+	path := flags.String("config", "", "configuration file (default ./config.yaml)")
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), dbUsage)
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return exitCode(err)
+	}
+
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return 2
+	}
+
+	source := *database
+	if source == "" {
+		var err error
+		if source, err = configDatabase(*path, *name); err != nil {
+			fmt.Fprintf(os.Stderr, "geoffrey: %v\n", err)
+			return 1
+		}
+	}
+
+	command, args := flags.Arg(0), flags.Args()[1:]
+
+	var action func(storage.Store, []string) error
+	switch command {
+	case "backup":
+		action = dbBackup
+	case "restore":
+		action = dbRestore
+	case "compact":
+		action = dbCompact
+	case "inspect":
+		action = dbInspect
+	case "delete":
+		action = dbDelete
+	default:
+		fmt.Fprintf(os.Stderr, "geoffrey: Unknown db command '%s'\n", command)
+		flags.Usage()
+		return 2
+	}
+
+	store, err := storage.Open(source)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "geoffrey: Could not open database '%s': %v\n", source, err)
+		return 1
+	}
+
+	err = action(store, args)
+	if closeErr := store.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == flag.ErrHelp {
+		return 0
+	} else if err == errUsage {
+		return 2
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "geoffrey: %s: %v\n", command, err)
+		return 1
+	}
+
+	return 0
+}
+
+// configDatabase returns the database of the named bot in the
+// configuration, or of the only bot if no name is given
+func configDatabase(path, name string) (string, error) {
+	bots, err := loadConfig(path)
+	if err != nil {
+		return "", err
+	}
+
+	if name == "" {
+		if len(bots) != 1 {
+			return "", fmt.Errorf("The configuration has %d bots, choose one with -bot", len(bots))
+		}
+
+		return bots[0].Database, nil
+	}
+
+	for _, config := range bots {
+		if config.BotName == name {
+			return config.Database, nil
+		}
+	}
+
+	return "", fmt.Errorf("There is no bot named '%s' in the configuration", name)
+}
+
+// dbBackup writes the keys to standard output or a file
+func dbBackup(store storage.Store, args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	output := flags.String("o", "-", "file to write the dump to")
+	prefix := flags.String("prefix", "", "only dump the keys with the prefix")
+
+	if err := flags.Parse(args); err != nil {
+		return usageError(err)
+	}
+
+	var writer io.Writer = os.Stdout
+	if *output != "-" {
+		file, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		writer = file
+	}
+
+	buffered := bufio.NewWriter(writer)
+
+	count, err := storage.Dump(store, *prefix, buffered)
+	if err != nil {
+		return err
+	}
+
+	if err := buffered.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Dumped %d keys\n", count)
+	return nil
+}
+
+// dbRestore reads the keys from standard input or a file
+func dbRestore(store storage.Store, args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ContinueOnError)
+	input := flags.String("i", "-", "file to read the dump from")
+
+	if err := flags.Parse(args); err != nil {
+		return usageError(err)
+	}
+
+	var reader io.Reader = os.Stdin
+	if *input != "-" {
+		file, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		reader = file
+	}
+
+	count, err := storage.Restore(store, reader)
+	fmt.Fprintf(os.Stderr, "Restored %d keys\n", count)
+	return err
+}
+
+// dbCompact reclaims the space of deleted and expired keys
+func dbCompact(store storage.Store, args []string) error {
+	if len(args) > 0 {
+		return errUsage
+	}
+
+	return storage.Compact(store)
+}
+
+// dbInspect lists the namespaces with the number of keys
+func dbInspect(store storage.Store, args []string) error {
+	if len(args) > 0 {
+		return errUsage
+	}
+
+	namespaces, err := storage.Inspect(store)
+	if err != nil {
+		return err
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(writer, "NAMESPACE\tKEYS")
+
+	for _, namespace := range namespaces {
+		name := namespace.Name
+		if name == "" {
+			name = "(none)"
+		}
+
+		fmt.Fprintf(writer, "%s\t%d\n", name, namespace.Keys)
+	}
+
+	return writer.Flush()
+}
+
+// dbDelete deletes the keys with the prefix
+func dbDelete(store storage.Store, args []string) error {
+	if len(args) != 1 || args[0] == "" {
+		fmt.Fprintln(os.Stderr, "Usage: geoffrey db delete <prefix>")
+		return errUsage
+	}
+
+	count, err := storage.DeletePrefix(store, args[0])
+	fmt.Fprintf(os.Stderr, "Deleted %d keys\n", count)
+	return err
+}
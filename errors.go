@@ -0,0 +1,20 @@
+package main
+
+import (
+	"errors"
+	"flag"
+)
+
+var (
+	errUsage = errors.New("geoffrey: Invalid usage")
+)
+
+// usageError returns the error to exit with when parsing the
+// flags of a command failed
+func usageError(err error) error {
+	if err == flag.ErrHelp {
+		return err
+	}
+
+	return errUsage
+}
@@ -1,15 +1,49 @@
+//go:generate go run . schema -o config.schema.json
+
 package main
 
 import (
+	"fmt"
 	"os"
-	"strings"
 
-	"github.com/jriddick/geoffrey/bot"
 	_ "github.com/jriddick/geoffrey/plugins"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
+// version is set at build time with
+// -ldflags "-X main.version=..."
+var version = "dev"
+
+// usage is printed for help and unknown commands
+const usage = `Usage: geoffrey <command> [flags]
+
+Commands:
+  run           connect the configured bots (the default)
+  check-config  validate the configuration and exit
+  plugins       list the available plugins
+  schema        print the JSON Schema of the configuration
+  db            maintain the database of a bot
+  version       print the version
+
+Run 'geoffrey <command> -h' for the flags of a command.
+
+Exit codes:
+  0  success
+  1  the command failed, e.g. the configuration is invalid
+  2  the command line is invalid
+`
+
+// commands maps the command names to their functions
+var commands = map[string]func(args []string) int{
+	"run":          runCommand,
+	"check-config": checkConfigCommand,
+	"plugins":      pluginsCommand,
+	"schema":       schemaCommand,
+	"db":           dbCommand,
+	"version":      versionCommand,
+}
+
 func init() {
 	// Output to stderr
 	log.SetOutput(os.Stderr)
@@ -27,64 +61,27 @@ func init() {
 }
 
 func main() {
-	log.Infoln("[geoffrey] Running")
-
-	// Load the configuration
-	if err := viper.ReadInConfig(); err != nil {
-		log.Fatalf("Could not read configuration: %s\n", err)
-	}
-
-	// Configure the logger level
-	switch strings.ToUpper(viper.GetString("logs.level")) {
-	case "DEBUG":
-		log.SetLevel(log.DebugLevel)
-	case "INFO":
-		log.SetLevel(log.InfoLevel)
-	case "WARN", "WARNING":
-		log.SetLevel(log.WarnLevel)
-	case "ERROR":
-		log.SetLevel(log.ErrorLevel)
-	case "FATAL":
-		log.SetLevel(log.FatalLevel)
-	case "PANIC":
-		log.SetLevel(log.PanicLevel)
-	default:
-		log.Fatalf("[geoffrey] Tried to set log level to '%s'", viper.GetString("logs.level"))
-	}
-
-	// Create the manager
-	manager := bot.NewManager()
-
-	// Get the bot configurations
-	var bots []bot.Config
+	os.Exit(run(os.Args[1:]))
+}
 
-	// Unmarshal the bots
-	if err := viper.UnmarshalKey("bots", &bots); err != nil {
-		log.Fatalf("Could not read configuration: %s\n", err)
+// run runs the command and returns the exit code
+func run(args []string) int {
+	// Run the bots if no command is given
+	if len(args) == 0 {
+		return runCommand(args)
 	}
 
-	// Add all bots to the manager
-	for _, config := range bots {
-		bot, err := bot.NewBot(config)
-		if err != nil {
-			log.Fatalf("[%s] %v", config.BotName, err)
-		}
-		if err := manager.Add(config.BotName, bot); err != nil {
-			log.Fatalf("[%s] %v", config.BotName, err)
-		} else {
-			log.Infof("[geoffrey] Added bot '%s'", config.BotName)
-		}
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(os.Stdout, usage)
+		return 0
 	}
 
-	// Make sure we actaully have a bot registered
-	if len(bots) < 1 {
-		log.Fatalf("[geoffrey] You need a minimum of one configured bot")
+	command, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "geoffrey: Unknown command '%s'\n\n%s", args[0], usage)
+		return 2
 	}
 
-	log.Infof("[geoffrey] Started")
-
-	// Listen and run
-	if err := manager.Run(); err != nil {
-		log.Fatalf("Error: %v", err)
-	}
+	return command(args[1:])
 }
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// validConfig is a configuration with a single usable bot
+const validConfig = `bots:
+  - name: geoffrey
+    host: irc.example.com
+    port: 6697
+    identification:
+      nick: geoffrey
+      user: geoffrey
+      name: Geoffrey
+    database: "memory:"
+    timings:
+      timeout: 300000
+`
+
+func TestCommands(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	Convey("With the command line", t, func() {
+		dir, err := ioutil.TempDir("", "geoffrey")
+		So(err, ShouldBeNil)
+
+		// execute runs the command line and returns the exit code
+		// and everything it printed
+		execute := func(args ...string) (int, string) {
+			output, err := os.Create(filepath.Join(dir, "output"))
+			So(err, ShouldBeNil)
+			defer output.Close()
+
+			stdout, stderr := os.Stdout, os.Stderr
+			os.Stdout, os.Stderr = output, output
+			defer func() {
+				os.Stdout, os.Stderr = stdout, stderr
+			}()
+
+			code := run(args)
+
+			printed, err := ioutil.ReadFile(output.Name())
+			So(err, ShouldBeNil)
+
+			return code, string(printed)
+		}
+
+		// config writes the configuration and returns its path
+		config := func(name, content string) string {
+			path := filepath.Join(dir, name)
+			So(ioutil.WriteFile(path, []byte(content), 0644), ShouldBeNil)
+			return path
+		}
+
+		Convey("Should print the usage for help", func() {
+			code, output := execute("help")
+			So(code, ShouldEqual, 0)
+			So(output, ShouldEqual, usage)
+
+			code, _ = execute("check-config", "-h")
+			So(code, ShouldEqual, 0)
+		})
+
+		Convey("Should reject unknown commands and flags", func() {
+			code, output := execute("start")
+			So(code, ShouldEqual, 2)
+			So(output, ShouldStartWith, "geoffrey: Unknown command 'start'")
+
+			code, _ = execute("plugins", "-verbose")
+			So(code, ShouldEqual, 2)
+		})
+
+		Convey("Should reject extra arguments", func() {
+			for _, args := range [][]string{
+				{"run", "config.yaml"},
+				{"check-config", "config.yaml"},
+				{"plugins", "all"},
+				{"schema", "config.schema.json"},
+				{"version", "now"},
+			} {
+				code, _ := execute(args...)
+				So(code, ShouldEqual, 2)
+			}
+		})
+
+		Convey("Should print the version", func() {
+			code, output := execute("version")
+			So(code, ShouldEqual, 0)
+			So(output, ShouldStartWith, "geoffrey dev (")
+		})
+
+		Convey("Should list the plugins", func() {
+			code, output := execute("plugins")
+			So(code, ShouldEqual, 0)
+			So(output, ShouldStartWith, "NAME")
+			So(output, ShouldContainSubstring, "Channels")
+		})
+
+		Convey("Should write the schema", func() {
+			path := filepath.Join(dir, "config.schema.json")
+			code, _ := execute("schema", "-o", path)
+			So(code, ShouldEqual, 0)
+
+			schema, err := ioutil.ReadFile(path)
+			So(err, ShouldBeNil)
+			So(string(schema), ShouldContainSubstring, `"$schema"`)
+		})
+
+		Convey("Should check the configuration", func() {
+			code, output := execute("check-config", "-config", config("valid.yaml", validConfig))
+			So(code, ShouldEqual, 0)
+			So(output, ShouldEqual, "Configuration is valid with 1 bots\n")
+
+			code, output = execute("check-config", "-config", config("invalid.yaml", validConfig+"    port: 0\n"))
+			So(code, ShouldEqual, 1)
+			So(output, ShouldContainSubstring, "bots[0].port")
+
+			code, _ = execute("check-config", "-config", filepath.Join(dir, "missing.yaml"))
+			So(code, ShouldEqual, 1)
+		})
+
+		Convey("Should not run with an invalid configuration", func() {
+			code, _ := execute("run", "-config", config("invalid.yaml", "bots:\n  - name: geoffrey\n"))
+			So(code, ShouldEqual, 1)
+		})
+
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+	})
+}
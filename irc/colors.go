@@ -1,8 +1,12 @@
 package irc
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+)
 
-// Color codes for IRC messages
+// Color codes for IRC messages. Codes 16 to 98 are the
+// extended palette and 99 is the default color.
 const (
 	White = iota
 	Black
@@ -20,15 +24,467 @@ const (
 	Pink
 	Grey
 	LightGrey
-	Default
+	Default = 99
+)
+
+// Formatting control codes for IRC messages
+const (
+	BoldCode          = '\x02'
+	ColorCode         = '\x03'
+	HexColorCode      = '\x04'
+	ResetCode         = '\x0f'
+	MonospaceCode     = '\x11'
+	ReverseCode       = '\x16'
+	ItalicCode        = '\x1d'
+	StrikethroughCode = '\x1e'
+	UnderlineCode     = '\x1f'
 )
 
 // Foreground sets foreground color of the text to the given color
 func Foreground(text string, code int) string {
-	return fmt.Sprintf("\x03%d​%s\x03", code, text)
+	return Span(text).Fg(code).String()
+}
+
+// Background sets background color of the text to the given color
+func Background(text string, code int) string {
+	return Span(text).Bg(code).String()
+}
+
+// Colorize sets both the foreground and background color of the text
+func Colorize(text string, foreground, background int) string {
+	return Span(text).Fg(foreground).Bg(background).String()
+}
+
+// HexForeground sets the foreground color of the text to the
+// given RGB color such as 0xFF0000
+func HexForeground(text string, rgb int) string {
+	return Span(text).HexFg(rgb).String()
+}
+
+// HexBackground sets the background color of the text to the
+// given RGB color such as 0xFF0000. The foreground is black as
+// hex colors cannot be given without a foreground.
+func HexBackground(text string, rgb int) string {
+	return Span(text).HexBg(rgb).String()
 }
 
 // Bold makes the text bold
 func Bold(text string) string {
-	return fmt.Sprintf("\x02%s\x02", text)
+	return Span(text).Bold().String()
+}
+
+// Italic makes the text italic
+func Italic(text string) string {
+	return Span(text).Italic().String()
+}
+
+// Underline makes the text underlined
+func Underline(text string) string {
+	return Span(text).Underline().String()
+}
+
+// Strikethrough strikes through the text
+func Strikethrough(text string) string {
+	return Span(text).Strikethrough().String()
+}
+
+// Monospace makes the text monospaced
+func Monospace(text string) string {
+	return Span(text).Monospace().String()
+}
+
+// Reverse swaps the foreground and background color of the text
+func Reverse(text string) string {
+	return Span(text).Reverse().String()
+}
+
+// Color is either a palette or hex color. The zero
+// value is no color.
+type Color struct {
+	value int
+	kind  uint8
+}
+
+const (
+	noColor uint8 = iota
+	paletteColor
+	hexColor
+)
+
+// Palette returns the palette color with the code from 0 to 99
+func Palette(code int) Color {
+	if code < 0 || code > Default {
+		code = Default
+	}
+
+	return Color{
+		value: code,
+		kind:  paletteColor,
+	}
+}
+
+// Hex returns the RGB color such as 0xFF0000
+func Hex(rgb int) Color {
+	return Color{
+		value: rgb & 0xFFFFFF,
+		kind:  hexColor,
+	}
+}
+
+// IsSet returns true if the color is set
+func (c Color) IsSet() bool {
+	return c.kind != noColor
+}
+
+// IsHex returns true if the color is a hex color
+func (c Color) IsHex() bool {
+	return c.kind == hexColor
+}
+
+// Value returns the palette code or the RGB value
+func (c Color) Value() int {
+	return c.value
+}
+
+// Style is the formatting of text
+type Style struct {
+	Bold          bool
+	Italic        bool
+	Underline     bool
+	Strikethrough bool
+	Monospace     bool
+	Reverse       bool
+	Foreground    Color
+	Background    Color
+}
+
+// inherit returns the style nested inside the parent style
+func (s Style) inherit(parent Style) Style {
+	s.Bold = s.Bold || parent.Bold
+	s.Italic = s.Italic || parent.Italic
+	s.Underline = s.Underline || parent.Underline
+	s.Strikethrough = s.Strikethrough || parent.Strikethrough
+	s.Monospace = s.Monospace || parent.Monospace
+	s.Reverse = s.Reverse || parent.Reverse
+
+	if !s.Foreground.IsSet() {
+		s.Foreground = parent.Foreground
+	}
+
+	if !s.Background.IsSet() {
+		s.Background = parent.Background
+	}
+
+	return s
+}
+
+// Text is styled text that can contain nested text.
+// Nested text inherits the style of its parent and
+// can override the colors.
+//
+//	irc.Span("[", irc.Span("GitHub").Fg(irc.Green), "] ", irc.Span(name).Bold()).String()
+type Text struct {
+	Style    Style
+	Value    string
+	Children []Text
+}
+
+// Span creates unstyled text from the parts which can
+// be strings or nested Text.
+func Span(parts ...interface{}) Text {
+	if len(parts) == 1 {
+		if value, ok := parts[0].(string); ok {
+			return Text{Value: value}
+		}
+	}
+
+	text := Text{}
+	for _, part := range parts {
+		switch part := part.(type) {
+		case Text:
+			text.Children = append(text.Children, part)
+		case string:
+			text.Children = append(text.Children, Text{Value: part})
+		default:
+			text.Children = append(text.Children, Text{Value: fmt.Sprint(part)})
+		}
+	}
+
+	return text
+}
+
+// Bold makes the text bold
+func (t Text) Bold() Text {
+	t.Style.Bold = true
+	return t
+}
+
+// Italic makes the text italic
+func (t Text) Italic() Text {
+	t.Style.Italic = true
+	return t
+}
+
+// Underline makes the text underlined
+func (t Text) Underline() Text {
+	t.Style.Underline = true
+	return t
+}
+
+// Strikethrough strikes through the text
+func (t Text) Strikethrough() Text {
+	t.Style.Strikethrough = true
+	return t
+}
+
+// Monospace makes the text monospaced
+func (t Text) Monospace() Text {
+	t.Style.Monospace = true
+	return t
+}
+
+// Reverse swaps the foreground and background color
+func (t Text) Reverse() Text {
+	t.Style.Reverse = true
+	return t
+}
+
+// Fg sets the foreground to the palette color
+func (t Text) Fg(code int) Text {
+	t.Style.Foreground = Palette(code)
+	return t
+}
+
+// Bg sets the background to the palette color
+func (t Text) Bg(code int) Text {
+	t.Style.Background = Palette(code)
+	return t
+}
+
+// HexFg sets the foreground to the RGB color
+func (t Text) HexFg(rgb int) Text {
+	t.Style.Foreground = Hex(rgb)
+	return t
+}
+
+// HexBg sets the background to the RGB color
+func (t Text) HexBg(rgb int) Text {
+	t.Style.Background = Hex(rgb)
+	return t
+}
+
+// run is text with the resolved style
+type run struct {
+	style Style
+	text  string
+}
+
+// runs flattens the text into runs with resolved styles
+// and merges adjacent runs with the same style
+func (t Text) runs(runs []run, parent Style) []run {
+	style := t.Style.inherit(parent)
+
+	if t.Value != "" {
+		if last := len(runs) - 1; last >= 0 && runs[last].style == style {
+			runs[last].text += t.Value
+		} else {
+			runs = append(runs, run{style, t.Value})
+		}
+	}
+
+	for _, child := range t.Children {
+		runs = child.runs(runs, style)
+	}
+
+	return runs
+}
+
+// Plain returns the text without any formatting
+func (t Text) Plain() string {
+	text := t.Value
+	for _, child := range t.Children {
+		text += child.Plain()
+	}
+
+	return text
+}
+
+// String returns the text with the control codes needed
+// to format it. Formatting is always closed at the end
+// so the text can be embedded in other text.
+func (t Text) String() string {
+	var buf []byte
+	current := Style{}
+
+	for _, run := range t.runs(nil, Style{}) {
+		buf = appendTransition(buf, current, run.style, run.text)
+		buf = append(buf, run.text...)
+		current = run.style
+	}
+
+	return string(appendTransition(buf, current, Style{}, ""))
+}
+
+// appendTransition appends the shortest control codes that
+// changes the formatting from one style to the other
+func appendTransition(buf []byte, from, to Style, next string) []byte {
+	if from == to {
+		return buf
+	}
+
+	changes := appendChanges(nil, from, to, next)
+
+	// Resetting and applying the style again can be shorter
+	if from != (Style{}) {
+		reset := appendChanges([]byte{ResetCode}, Style{}, to, next)
+		if len(reset) < len(changes) {
+			changes = reset
+		}
+	}
+
+	return append(buf, changes...)
+}
+
+// appendChanges appends the toggles and colors that changes
+// the formatting from one style to the other
+func appendChanges(buf []byte, from, to Style, next string) []byte {
+	for _, toggle := range [...]struct {
+		from, to bool
+		code     byte
+	}{
+		{from.Bold, to.Bold, BoldCode},
+		{from.Italic, to.Italic, ItalicCode},
+		{from.Underline, to.Underline, UnderlineCode},
+		{from.Strikethrough, to.Strikethrough, StrikethroughCode},
+		{from.Monospace, to.Monospace, MonospaceCode},
+		{from.Reverse, to.Reverse, ReverseCode},
+	} {
+		if toggle.from != toggle.to {
+			buf = append(buf, toggle.code)
+		}
+	}
+
+	// The hex colors are written last so the palette
+	// colors have to know what follows them
+	hex := appendHexColors(nil, colorOf(from.Foreground, hexColor), colorOf(from.Background, hexColor),
+		colorOf(to.Foreground, hexColor), colorOf(to.Background, hexColor), next)
+
+	if len(hex) > 0 {
+		next = string(hex)
+	}
+
+	buf = appendPaletteColors(buf, colorOf(from.Foreground, paletteColor), colorOf(from.Background, paletteColor),
+		colorOf(to.Foreground, paletteColor), colorOf(to.Background, paletteColor), next)
+
+	return append(buf, hex...)
+}
+
+// colorOf returns the color value if it is of the kind or -1
+func colorOf(color Color, kind uint8) int {
+	if color.kind != kind {
+		return -1
+	}
+
+	return color.value
+}
+
+// startsWithDigit returns true if the text starts with a digit
+func startsWithDigit(text string) bool {
+	return len(text) > 0 && text[0] >= '0' && text[0] <= '9'
+}
+
+// appendPaletteColors appends the palette color code that changes
+// the colors where -1 is no color. Codes are padded to two digits
+// when the text following them starts with a digit.
+func appendPaletteColors(buf []byte, fromFg, fromBg, toFg, toBg int, next string) []byte {
+	if fromFg == toFg && fromBg == toBg {
+		return buf
+	}
+
+	buf = append(buf, ColorCode)
+
+	// A bare color code resets the colors
+	if toFg == -1 && toBg == -1 {
+		if startsWithDigit(next) {
+			// Separate the digit with an empty toggle
+			buf = append(buf, BoldCode, BoldCode)
+		}
+
+		return buf
+	}
+
+	// The background has to be given when it changes or
+	// when the text could be mistaken for a background
+	withBg := fromBg != toBg || (len(next) > 1 && next[0] == ',' && startsWithDigit(next[1:]))
+
+	if toFg == -1 {
+		toFg = Default
+	}
+
+	if toBg == -1 {
+		toBg = Default
+	}
+
+	buf = appendCode(buf, toFg, !withBg && startsWithDigit(next))
+	if withBg {
+		buf = append(buf, ',')
+		buf = appendCode(buf, toBg, startsWithDigit(next))
+	}
+
+	return buf
+}
+
+// appendCode appends the color code optionally padded to two digits
+func appendCode(buf []byte, code int, pad bool) []byte {
+	if pad && code < 10 {
+		buf = append(buf, '0')
+	}
+
+	return strconv.AppendInt(buf, int64(code), 10)
+}
+
+// isHexDigit returns true if the byte is a hex digit
+func isHexDigit(b byte) bool {
+	return b >= '0' && b <= '9' || b >= 'a' && b <= 'f' || b >= 'A' && b <= 'F'
+}
+
+// appendHexColors appends the hex color code that changes the
+// colors where -1 is no color
+func appendHexColors(buf []byte, fromFg, fromBg, toFg, toBg int, next string) []byte {
+	if fromFg == toFg && fromBg == toBg {
+		return buf
+	}
+
+	buf = append(buf, HexColorCode)
+
+	// A bare hex color code resets the colors, and hex colors
+	// cannot be padded so ambiguous text is separated
+	if toFg == -1 && toBg == -1 {
+		if len(next) > 0 && isHexDigit(next[0]) {
+			buf = append(buf, BoldCode, BoldCode)
+		}
+
+		return buf
+	}
+
+	// The hex background cannot be cleared by itself
+	if toBg == -1 && fromBg != -1 {
+		buf = append(buf, HexColorCode)
+	}
+
+	// Hex colors always need a foreground so black is used
+	// when only the background is given
+	if toFg == -1 {
+		toFg = 0x000000
+	}
+
+	buf = append(buf, fmt.Sprintf("%06X", toFg)...)
+
+	if toBg != -1 {
+		buf = append(buf, fmt.Sprintf(",%06X", toBg)...)
+	} else if len(next) > 0 && next[0] == ',' {
+		buf = append(buf, BoldCode, BoldCode)
+	}
+
+	return buf
 }
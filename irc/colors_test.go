@@ -17,5 +17,80 @@ func TestColors(t *testing.T) {
 			result := Bold("bold")
 			So(result, ShouldEqual, "\x02bold\x02")
 		})
+
+		Convey("It should pad colors followed by digits", func() {
+			So(Foreground("123", Brown), ShouldEqual, "\x0305123\x03")
+			So(Colorize("5", Red, Black), ShouldEqual, "\x034,015\x03")
+		})
+
+		Convey("It should not mistake text for a background", func() {
+			So(Foreground(",5", Red), ShouldEqual, "\x034,99,5\x03")
+			So(Foreground(",a", Red), ShouldEqual, "\x034,a\x03")
+		})
+
+		Convey("It should be able to set the background", func() {
+			So(Background("text", Red), ShouldEqual, "\x0399,4text\x03")
+			So(Colorize("text", Red, Blue), ShouldEqual, "\x034,2text\x03")
+		})
+
+		Convey("It should support the extended palette", func() {
+			So(Foreground("text", 52), ShouldEqual, "\x0352text\x03")
+			So(Foreground("text", Default), ShouldEqual, "\x0399text\x03")
+		})
+
+		Convey("It should support hex colors", func() {
+			So(HexForeground("text", 0xFF8000), ShouldEqual, "\x04FF8000text\x04")
+			So(HexBackground("text", 0x0000FF), ShouldEqual, "\x04000000,0000FFtext\x04")
+		})
+
+		Convey("It should support the other formatting", func() {
+			So(Italic("text"), ShouldEqual, "\x1dtext\x1d")
+			So(Underline("text"), ShouldEqual, "\x1ftext\x1f")
+			So(Strikethrough("text"), ShouldEqual, "\x1etext\x1e")
+			So(Monospace("text"), ShouldEqual, "\x11text\x11")
+			So(Reverse("text"), ShouldEqual, "\x16text\x16")
+		})
+	})
+
+	Convey("With styled text", t, func() {
+		Convey("It should nest formatting", func() {
+			text := Span("a", Span("b", Span("c").Italic()).Bold(), "d")
+
+			So(text.String(), ShouldEqual, "a\x02b\x1dc\x0fd")
+			So(text.Plain(), ShouldEqual, "abcd")
+		})
+
+		Convey("It should restore the parent color", func() {
+			text := Span("a", Span("b").Fg(Blue), "c").Fg(Red)
+
+			So(text.String(), ShouldEqual, "\x034a\x032b\x034c\x03")
+		})
+
+		Convey("It should clear the background", func() {
+			text := Span(Span("a").Fg(Red).Bg(Blue), Span("b").Fg(Red))
+
+			So(text.String(), ShouldEqual, "\x034,2a\x0f\x034b\x03")
+		})
+
+		Convey("It should merge runs with the same style", func() {
+			text := Span(Span("a").Bold(), Span("b").Bold(), Span("").Italic())
+
+			So(text.String(), ShouldEqual, "\x02ab\x02")
+		})
+
+		Convey("It should reset when it is shorter", func() {
+			text := Span(Span("a").Bold().Italic().Underline(), "b")
+
+			So(text.String(), ShouldEqual, "\x02\x1d\x1fa\x0fb")
+		})
+
+		Convey("It should separate color resets from digits", func() {
+			So(Span(Span("a").Fg(Red), "1").String(), ShouldEqual, "\x034a\x0f1")
+			So(Span(Span("a").HexFg(0xFF0000), "cafe").String(), ShouldEqual, "\x04FF0000a\x0fcafe")
+		})
+
+		Convey("It should format other values", func() {
+			So(Span("stars: ", Span(42).Fg(Brown)).String(), ShouldEqual, "stars: \x030542\x03")
+		})
 	})
 }
@@ -3,8 +3,14 @@ package irc
 import (
 	"fmt"
 	"time"
+
+	"github.com/jriddick/geoffrey/transcript"
 )
 
+// DefaultMessagesPerSecond is the rate messages are sent at
+// when no other rate has been configured
+const DefaultMessagesPerSecond = 2
+
 // Config is the client configuration
 type Config struct {
 	Hostname           string
@@ -13,7 +19,19 @@ type Config struct {
 	InsecureSkipVerify bool
 	Timeout            time.Duration
 	TimeoutLimit       int
-	MessagesPerSecond  int
+	// MessagesPerSecond limits the rate messages are sent at,
+	// defaults to DefaultMessagesPerSecond
+	MessagesPerSecond int
+
+	// Encoding of the network where empty is UTF-8
+	Encoding string
+	// Fallback decodes invalid UTF-8, defaults to DefaultFallback
+	Fallback string
+	// ChannelEncodings overrides the encoding for channels
+	ChannelEncodings map[string]string
+
+	// Recorder writes every raw line to a transcript when set
+	Recorder *transcript.Recorder
 }
 
 // GetHostname retuns the full hostname with port
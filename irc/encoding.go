@@ -0,0 +1,166 @@
+package irc
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jriddick/geoffrey/msg"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// DefaultFallback is the encoding used for invalid UTF-8
+// when no other encoding has been configured
+const DefaultFallback = "cp1252"
+
+// encodingAliases maps common names to the normalized
+// names of the charmap encodings
+var encodingAliases = map[string]string{
+	"latin1": "iso88591",
+	"latin2": "iso88592",
+	"latin9": "iso885915",
+	"cp437":  "ibmcodepage437",
+	"cp850":  "ibmcodepage850",
+	"cp866":  "ibmcodepage866",
+	"cp1250": "windows1250",
+	"cp1251": "windows1251",
+	"cp1252": "windows1252",
+}
+
+// normalizeEncoding returns the name in lowercase without separators
+func normalizeEncoding(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' || r == '_' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(name))
+}
+
+// LookupEncoding returns the encoding with the name such as
+// 'latin1', 'cp1252' or 'iso-8859-15'. UTF-8 and an empty name
+// return a nil encoding as no transcoding is needed.
+func LookupEncoding(name string) (encoding.Encoding, error) {
+	normalized := normalizeEncoding(name)
+	if alias, ok := encodingAliases[normalized]; ok {
+		normalized = alias
+	}
+
+	if normalized == "" || normalized == "utf8" {
+		return nil, nil
+	}
+
+	for _, enc := range charmap.All {
+		if normalizeEncoding(fmt.Sprint(enc)) == normalized {
+			return enc, nil
+		}
+	}
+
+	return nil, fmt.Errorf("[geoffrey] Unknown encoding '%s'", name)
+}
+
+// codec decodes incoming lines that are not valid UTF-8 and
+// encodes outgoing lines for servers and channels that do not
+// use UTF-8
+type codec struct {
+	network  encoding.Encoding
+	fallback encoding.Encoding
+	channels map[string]encoding.Encoding
+}
+
+// newCodec creates the codec from the configured encodings
+func newCodec(config Config) (*codec, error) {
+	network, err := LookupEncoding(config.Encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	fallback := config.Fallback
+	if fallback == "" {
+		fallback = DefaultFallback
+	}
+
+	c := &codec{
+		network:  network,
+		channels: make(map[string]encoding.Encoding),
+	}
+
+	if c.fallback, err = LookupEncoding(fallback); err != nil {
+		return nil, err
+	}
+
+	for channel, name := range config.ChannelEncodings {
+		enc, err := LookupEncoding(name)
+		if err != nil {
+			return nil, err
+		}
+
+		c.channels[strings.ToLower(channel)] = enc
+	}
+
+	return c, nil
+}
+
+// channel returns the encoding for the target of the message
+// and whether the target has its own encoding
+func (c *codec) channel(message *msg.Message) (encoding.Encoding, bool) {
+	if len(message.Params) == 0 {
+		return nil, false
+	}
+
+	enc, ok := c.channels[strings.ToLower(message.Params[0])]
+	return enc, ok
+}
+
+// decode parses the raw line and decodes it with the encoding
+// of the channel, the network or the fallback if it is not
+// valid UTF-8
+func (c *codec) decode(raw []byte) (*msg.Message, error) {
+	message, err := msg.ParseMessageBytes(raw)
+	if err != nil || utf8.Valid(raw) {
+		return message, err
+	}
+
+	enc, ok := c.channel(message)
+	if !ok || enc == nil {
+		enc = c.network
+	}
+
+	if enc == nil {
+		enc = c.fallback
+	}
+
+	if enc == nil {
+		return message, nil
+	}
+
+	decoded, err := enc.NewDecoder().Bytes(raw)
+	if err != nil {
+		return message, nil
+	}
+
+	// The length of the line was checked before decoding
+	return msg.ParseDecodedBytes(decoded)
+}
+
+// encode returns the message encoded for its target
+func (c *codec) encode(message *msg.Message) []byte {
+	raw := message.Bytes()
+
+	enc, ok := c.channel(message)
+	if !ok {
+		enc = c.network
+	}
+
+	if enc == nil {
+		return raw
+	}
+
+	encoded, err := encoding.ReplaceUnsupported(enc.NewEncoder()).Bytes(raw)
+	if err != nil {
+		return raw
+	}
+
+	return encoded
+}
@@ -0,0 +1,114 @@
+package irc
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jriddick/geoffrey/msg"
+	"golang.org/x/text/encoding/charmap"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEncoding(t *testing.T) {
+	Convey("With encoding names", t, func() {
+		Convey("It should find the legacy encodings", func() {
+			for name, expected := range map[string]interface{}{
+				"latin1":       charmap.ISO8859_1,
+				"ISO-8859-1":   charmap.ISO8859_1,
+				"iso-8859-15":  charmap.ISO8859_15,
+				"cp1252":       charmap.Windows1252,
+				"Windows-1252": charmap.Windows1252,
+				"koi8-r":       charmap.KOI8R,
+			} {
+				enc, err := LookupEncoding(name)
+				So(err, ShouldBeNil)
+				So(enc, ShouldEqual, expected)
+			}
+		})
+
+		Convey("It should not transcode UTF-8", func() {
+			for _, name := range []string{"", "utf-8", "UTF8"} {
+				enc, err := LookupEncoding(name)
+				So(err, ShouldBeNil)
+				So(enc, ShouldBeNil)
+			}
+		})
+
+		Convey("It should reject unknown encodings", func() {
+			_, err := LookupEncoding("klingon")
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("With a codec", t, func() {
+		codec, err := newCodec(Config{
+			ChannelEncodings: map[string]string{
+				"#Latin": "latin1",
+			},
+		})
+		So(err, ShouldBeNil)
+
+		Convey("It should keep valid UTF-8", func() {
+			message, err := codec.decode([]byte(":nick!user@host PRIVMSG #latin :smörgåsbord\r\n"))
+			So(err, ShouldBeNil)
+			So(message.Trailing, ShouldEqual, "smörgåsbord")
+		})
+
+		Convey("It should decode invalid UTF-8 with the fallback", func() {
+			message, err := codec.decode([]byte(":nick!user@host PRIVMSG #other :\x93quoted\x94 caf\xe9\r\n"))
+			So(err, ShouldBeNil)
+			So(message.Trailing, ShouldEqual, "“quoted” café")
+		})
+
+		Convey("It should decode invalid UTF-8 with the channel encoding", func() {
+			message, err := codec.decode([]byte(":nick!user@host PRIVMSG #latin :caf\xe9 \x93\r\n"))
+			So(err, ShouldBeNil)
+			So(message.Trailing, ShouldEqual, "café \u0093")
+		})
+
+		Convey("It should check the length before decoding", func() {
+			// Every character grows to two bytes when decoded
+			for _, length := range []int{421, 1000} {
+				raw := "PRIVMSG #x :" + strings.Repeat("\xe9", length-14) + "\r\n"
+				So(raw, ShouldHaveLength, length)
+
+				message, err := codec.decode([]byte(raw))
+				So(err, ShouldBeNil)
+				So(message.Trailing, ShouldEqual, strings.Repeat("é", length-14))
+			}
+
+			_, err := codec.decode([]byte("PRIVMSG #x :" + strings.Repeat("\xe9", 1100) + "\r\n"))
+			So(errors.Is(err, msg.ErrTooLong), ShouldBeTrue)
+		})
+
+		Convey("It should encode for legacy channels", func() {
+			So(string(codec.encode(msg.Privmsg("#LATIN", "café ☃"))), ShouldEqual, "PRIVMSG #LATIN :caf\xe9 \x1a\r\n")
+		})
+
+		Convey("It should not encode for other targets", func() {
+			So(string(codec.encode(msg.Privmsg("#other", "café"))), ShouldEqual, "PRIVMSG #other :café\r\n")
+		})
+	})
+
+	Convey("With a legacy network", t, func() {
+		codec, err := newCodec(Config{
+			Encoding: "cp1252",
+			ChannelEncodings: map[string]string{
+				"#modern": "utf-8",
+			},
+		})
+		So(err, ShouldBeNil)
+
+		Convey("It should encode everything except UTF-8 channels", func() {
+			So(string(codec.encode(msg.Privmsg("nick", "café"))), ShouldEqual, "PRIVMSG nick :caf\xe9\r\n")
+			So(string(codec.encode(msg.Privmsg("#modern", "café"))), ShouldEqual, "PRIVMSG #modern :café\r\n")
+		})
+
+		Convey("It should fail with unknown encodings", func() {
+			_, err := newCodec(Config{Fallback: "klingon"})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,16 @@
+package irc
+
+// ConnectionError is sent on the error channel when the
+// connection to the server has been lost
+type ConnectionError struct {
+	Err error
+}
+
+func (e *ConnectionError) Error() string {
+	return "[geoffrey] Lost connection: " + e.Err.Error()
+}
+
+// Unwrap returns the error that ended the connection
+func (e *ConnectionError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,388 @@
+package irc
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+)
+
+// paletteRGB is the RGB value of the palette colors 0 to 98
+var paletteRGB = [...]int{
+	0xFFFFFF, 0x000000, 0x00007F, 0x009300, 0xFF0000, 0x7F0000, 0x9C009C, 0xFC7F00,
+	0xFFFF00, 0x00FC00, 0x009393, 0x00FFFF, 0x0000FC, 0xFF00FF, 0x7F7F7F, 0xD2D2D2,
+	0x470000, 0x472100, 0x474700, 0x324700, 0x004700, 0x00472C, 0x004747, 0x002747, 0x000047, 0x2E0047, 0x470047, 0x47002A,
+	0x740000, 0x743A00, 0x747400, 0x517400, 0x007400, 0x007449, 0x007474, 0x004074, 0x000074, 0x4B0074, 0x740074, 0x740045,
+	0xB50000, 0xB56300, 0xB5B500, 0x7DB500, 0x00B500, 0x00B571, 0x00B5B5, 0x0063B5, 0x0000B5, 0x7500B5, 0xB500B5, 0xB5006B,
+	0xFF0000, 0xFF8C00, 0xFFFF00, 0xB2FF00, 0x00FF00, 0x00FFA0, 0x00FFFF, 0x008CFF, 0x0000FF, 0xA500FF, 0xFF00FF, 0xFF0098,
+	0xFF5959, 0xFFB459, 0xFFFF71, 0xCFFF60, 0x6FFF6F, 0x65FFC9, 0x6DFFFF, 0x59B4FF, 0x5959FF, 0xC459FF, 0xFF66FF, 0xFF59BC,
+	0xFF9C9C, 0xFFD39C, 0xFFFF9C, 0xE2FF9C, 0x9CFF9C, 0x9CFFDB, 0x9CFFFF, 0x9CD3FF, 0x9C9CFF, 0xDC9CFF, 0xFF9CFF, 0xFF94D3,
+	0x000000, 0x131313, 0x282828, 0x363636, 0x4D4D4D, 0x656565, 0x818181, 0x9F9F9F, 0xBCBCBC, 0xE2E2E2, 0xFFFFFF,
+}
+
+// paletteANSI is the ANSI foreground code of the palette colors 0 to 15
+var paletteANSI = [...]int{97, 30, 34, 32, 91, 31, 35, 33, 93, 92, 36, 96, 94, 95, 90, 37}
+
+// palette256 is the 256 color code of the palette colors 16 to 98
+var palette256 = [...]int{
+	52, 94, 100, 58, 22, 29, 23, 24, 17, 54, 53, 89,
+	88, 130, 142, 64, 28, 35, 30, 25, 18, 91, 90, 125,
+	124, 166, 184, 106, 34, 49, 37, 33, 19, 129, 127, 161,
+	196, 208, 226, 154, 46, 86, 51, 75, 21, 171, 201, 198,
+	203, 215, 227, 191, 83, 122, 87, 111, 63, 177, 207, 205,
+	217, 223, 229, 193, 157, 158, 159, 153, 147, 183, 219, 212,
+	16, 233, 235, 237, 239, 241, 244, 247, 250, 254, 231,
+}
+
+// visible returns true if the color is set to anything
+// other than the default color
+func (c Color) visible() bool {
+	return c.IsSet() && !(c.kind == paletteColor && c.value == Default)
+}
+
+// RGB returns the RGB value of the color
+func (c Color) RGB() int {
+	if c.kind == paletteColor && c.value < len(paletteRGB) {
+		return paletteRGB[c.value]
+	}
+
+	return c.value
+}
+
+// ParseFormatting parses the formatted text into styled text
+// where each child has the style of the control codes before it.
+func ParseFormatting(text string) Text {
+	root := Text{}
+	style := Style{}
+	value := make([]byte, 0, len(text))
+
+	// flush adds the value with the current style
+	flush := func() {
+		if len(value) == 0 {
+			return
+		}
+
+		if last := len(root.Children) - 1; last >= 0 && root.Children[last].Style == style {
+			root.Children[last].Value += string(value)
+		} else {
+			root.Children = append(root.Children, Text{Style: style, Value: string(value)})
+		}
+
+		value = value[:0]
+	}
+
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; c {
+		case BoldCode, ItalicCode, UnderlineCode, StrikethroughCode, MonospaceCode, ReverseCode:
+			flush()
+			style.toggle(c)
+		case ResetCode:
+			flush()
+			style = Style{}
+		case ColorCode:
+			flush()
+			fg, bg, n := parseColors(text[i+1:], 2, isDigit, paletteColor)
+			style.setColors(fg, bg, n > 0)
+			i += n
+		case HexColorCode:
+			flush()
+			fg, bg, n := parseColors(text[i+1:], 6, isHexDigit, hexColor)
+			style.setColors(fg, bg, n > 0)
+			i += n
+		default:
+			value = append(value, c)
+		}
+	}
+
+	flush()
+
+	return root
+}
+
+// StripFormatting returns the text without any control codes
+func StripFormatting(text string) string {
+	return ParseFormatting(text).Plain()
+}
+
+// toggle flips the formatting of the control code
+func (s *Style) toggle(code byte) {
+	switch code {
+	case BoldCode:
+		s.Bold = !s.Bold
+	case ItalicCode:
+		s.Italic = !s.Italic
+	case UnderlineCode:
+		s.Underline = !s.Underline
+	case StrikethroughCode:
+		s.Strikethrough = !s.Strikethrough
+	case MonospaceCode:
+		s.Monospace = !s.Monospace
+	case ReverseCode:
+		s.Reverse = !s.Reverse
+	}
+}
+
+// setColors sets the parsed colors or resets them if the
+// color code had no colors
+func (s *Style) setColors(fg, bg *Color, ok bool) {
+	if !ok {
+		s.Foreground = Color{}
+		s.Background = Color{}
+		return
+	}
+
+	s.Foreground = *fg
+	if bg != nil {
+		s.Background = *bg
+	}
+}
+
+// isDigit returns true if the byte is a digit
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+// parseColors parses the foreground and optional background after
+// a color code and returns the number of bytes used. Palette codes
+// are up to two digits while hex codes are exactly six.
+func parseColors(text string, size int, valid func(byte) bool, kind uint8) (*Color, *Color, int) {
+	fg, n := parseColor(text, size, valid, kind)
+	if n == 0 {
+		return nil, nil, 0
+	}
+
+	// The comma belongs to the text unless a color follows
+	if n < len(text) && text[n] == ',' {
+		if bg, m := parseColor(text[n+1:], size, valid, kind); m > 0 {
+			return fg, bg, n + 1 + m
+		}
+	}
+
+	return fg, nil, n
+}
+
+// parseColor parses a single color at the start of the text
+func parseColor(text string, size int, valid func(byte) bool, kind uint8) (*Color, int) {
+	n := 0
+	for n < size && n < len(text) && valid(text[n]) {
+		n++
+	}
+
+	if n == 0 || (kind == hexColor && n != size) {
+		return nil, 0
+	}
+
+	base := 10
+	if kind == hexColor {
+		base = 16
+	}
+
+	value, _ := strconv.ParseInt(text[:n], base, 32)
+
+	color := Color{value: int(value), kind: kind}
+
+	// The default color is the same as no color
+	if kind == paletteColor && value == Default {
+		color = Color{}
+	}
+
+	return &color, n
+}
+
+// ANSI returns the text with ANSI terminal escapes
+func (t Text) ANSI() string {
+	var buf strings.Builder
+	current := Style{}
+
+	for _, run := range t.runs(nil, Style{}) {
+		if run.style != current {
+			buf.WriteString(ansiStyle(run.style))
+			current = run.style
+		}
+
+		buf.WriteString(run.text)
+	}
+
+	if current != (Style{}) {
+		buf.WriteString("\x1b[0m")
+	}
+
+	return buf.String()
+}
+
+// ansiStyle returns the escape sequence that resets the
+// terminal and applies the style
+func ansiStyle(style Style) string {
+	codes := []string{"0"}
+
+	for _, attribute := range [...]struct {
+		set  bool
+		code string
+	}{
+		{style.Bold, "1"},
+		{style.Italic, "3"},
+		{style.Underline, "4"},
+		{style.Reverse, "7"},
+		{style.Strikethrough, "9"},
+	} {
+		if attribute.set {
+			codes = append(codes, attribute.code)
+		}
+	}
+
+	if style.Foreground.visible() {
+		codes = append(codes, ansiColor(style.Foreground, false))
+	}
+
+	if style.Background.visible() {
+		codes = append(codes, ansiColor(style.Background, true))
+	}
+
+	return "\x1b[" + strings.Join(codes, ";") + "m"
+}
+
+// ansiColor returns the ANSI parameters for the color
+func ansiColor(color Color, background bool) string {
+	switch {
+	case color.IsHex():
+		rgb := color.RGB()
+		mode := 38
+		if background {
+			mode = 48
+		}
+		return fmt.Sprintf("%d;2;%d;%d;%d", mode, rgb>>16&0xFF, rgb>>8&0xFF, rgb&0xFF)
+	case color.value < len(paletteANSI):
+		code := paletteANSI[color.value]
+		if background {
+			code += 10
+		}
+		return strconv.Itoa(code)
+	default:
+		mode := 38
+		if background {
+			mode = 48
+		}
+		return fmt.Sprintf("%d;5;%d", mode, palette256[color.value-len(paletteANSI)])
+	}
+}
+
+// HTML returns the text as escaped HTML
+func (t Text) HTML() string {
+	var buf strings.Builder
+
+	for _, run := range t.runs(nil, Style{}) {
+		style := run.style
+		fg, bg := style.Foreground, style.Background
+		if style.Reverse {
+			fg, bg = bg, fg
+		}
+
+		var tags []string
+		if fg.visible() || bg.visible() {
+			var css []string
+			if fg.visible() {
+				css = append(css, fmt.Sprintf("color:#%06x", fg.RGB()))
+			}
+			if bg.visible() {
+				css = append(css, fmt.Sprintf("background-color:#%06x", bg.RGB()))
+			}
+			buf.WriteString(`<span style="` + strings.Join(css, ";") + `">`)
+			tags = append(tags, "span")
+		}
+
+		for _, tag := range [...]struct {
+			set  bool
+			name string
+		}{
+			{style.Bold, "b"},
+			{style.Italic, "i"},
+			{style.Underline, "u"},
+			{style.Strikethrough, "s"},
+			{style.Monospace, "code"},
+		} {
+			if tag.set {
+				buf.WriteString("<" + tag.name + ">")
+				tags = append(tags, tag.name)
+			}
+		}
+
+		buf.WriteString(html.EscapeString(run.text))
+
+		for i := len(tags) - 1; i >= 0; i-- {
+			buf.WriteString("</" + tags[i] + ">")
+		}
+	}
+
+	return buf.String()
+}
+
+// markdownEscaper escapes the characters with meaning in Markdown
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "~", `\~`,
+	"[", `\[`, "]", `\]`, "<", `\<`, ">", `\>`, "#", `\#`,
+)
+
+// Markdown returns the text as Markdown. Colors, underline
+// and reverse have no Markdown equivalent and are dropped.
+func (t Text) Markdown() string {
+	var buf strings.Builder
+
+	for _, run := range t.runs(nil, Style{}) {
+		style := run.style
+
+		// Emphasis cannot start or end with whitespace so
+		// it is moved outside of the markers
+		text := strings.TrimSpace(run.text)
+		if text == "" || !(style.Bold || style.Italic || style.Strikethrough || style.Monospace) {
+			buf.WriteString(markdownText(run.text, style.Monospace))
+			continue
+		}
+
+		start := strings.Index(run.text, text)
+		buf.WriteString(run.text[:start])
+
+		var open []string
+		if style.Bold {
+			open = append(open, "**")
+		}
+		if style.Italic {
+			open = append(open, "_")
+		}
+		if style.Strikethrough {
+			open = append(open, "~~")
+		}
+
+		for _, marker := range open {
+			buf.WriteString(marker)
+		}
+
+		buf.WriteString(markdownText(text, style.Monospace))
+
+		for i := len(open) - 1; i >= 0; i-- {
+			buf.WriteString(open[i])
+		}
+
+		buf.WriteString(run.text[start+len(text):])
+	}
+
+	return buf.String()
+}
+
+// markdownText escapes the text or wraps it in a code span
+func markdownText(text string, code bool) string {
+	if !code || strings.TrimSpace(text) == "" {
+		return markdownEscaper.Replace(text)
+	}
+
+	// Code spans are delimited by more backticks than they contain
+	fence := "`"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+
+	if strings.HasPrefix(text, "`") || strings.HasSuffix(text, "`") {
+		return fence + " " + text + " " + fence
+	}
+
+	return fence + text + fence
+}
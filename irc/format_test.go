@@ -0,0 +1,91 @@
+package irc
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// RoundTripTests are formatted with the helpers from colors_test.go
+var RoundTripTests = [...]struct {
+	Formatted string
+	Plain     string
+}{
+	{Foreground("red", Red), "red"},
+	{Bold("bold"), "bold"},
+	{Foreground("123", Brown), "123"},
+	{Colorize("5", Red, Black), "5"},
+	{Foreground(",5", Red), ",5"},
+	{Background("text", Red), "text"},
+	{Colorize("text", Red, Blue), "text"},
+	{Foreground("text", 52), "text"},
+	{HexForeground("text", 0xFF8000), "text"},
+	{HexBackground("text", 0x0000FF), "text"},
+	{Italic("text"), "text"},
+	{Underline("text"), "text"},
+	{Strikethrough("text"), "text"},
+	{Monospace("text"), "text"},
+	{Reverse("text"), "text"},
+	{Span("a", Span("b", Span("c").Italic()).Bold(), "d").String(), "abcd"},
+	{Span("a", Span("b").Fg(Blue), "c").Fg(Red).String(), "abc"},
+	{Span(Span("a").Fg(Red).Bg(Blue), Span("b").Fg(Red)).String(), "ab"},
+	{Span(Span("a").Bold().Italic().Underline(), "b").String(), "ab"},
+	{Span(Span("a").Fg(Red), "1").String(), "a1"},
+	{Span(Span("a").HexFg(0xFF0000), "cafe").String(), "acafe"},
+}
+
+func TestFormatting(t *testing.T) {
+	Convey("With the formatting parser", t, func() {
+		Convey("It should round-trip formatted text", func() {
+			for _, test := range RoundTripTests {
+				text := ParseFormatting(test.Formatted)
+
+				So(text.String(), ShouldEqual, test.Formatted)
+				So(text.Plain(), ShouldEqual, test.Plain)
+			}
+		})
+
+		Convey("It should strip formatting", func() {
+			So(StripFormatting("\x02bold\x02 \x0304,12color\x03 \x1ditalic\x0f"), ShouldEqual, "bold color italic")
+			So(StripFormatting("\x03,5text"), ShouldEqual, ",5text")
+			So(StripFormatting("\x0312,text"), ShouldEqual, ",text")
+			So(StripFormatting("\x04FF0000,00FF00text\x04"), ShouldEqual, "text")
+			So(StripFormatting("\x04FFtext"), ShouldEqual, "FFtext")
+			So(StripFormatting("plain"), ShouldEqual, "plain")
+		})
+
+		Convey("It should parse the style of each span", func() {
+			text := ParseFormatting("a\x02b\x0304,12c\x0399d")
+
+			So(text.Children, ShouldHaveLength, 4)
+			So(text.Children[0].Style, ShouldResemble, Style{})
+			So(text.Children[1].Style, ShouldResemble, Style{Bold: true})
+			So(text.Children[2].Style, ShouldResemble, Style{Bold: true, Foreground: Palette(Red), Background: Palette(LightBlue)})
+			So(text.Children[3].Style, ShouldResemble, Style{Bold: true, Background: Palette(LightBlue)})
+		})
+	})
+
+	Convey("With the ANSI renderer", t, func() {
+		So(ParseFormatting(Foreground("red", Red)).ANSI(), ShouldEqual, "\x1b[0;91mred\x1b[0m")
+		So(ParseFormatting("a"+Bold("b")+"c").ANSI(), ShouldEqual, "a\x1b[0;1mb\x1b[0mc")
+		So(ParseFormatting(Colorize("x", White, Blue)).ANSI(), ShouldEqual, "\x1b[0;97;44mx\x1b[0m")
+		So(ParseFormatting(Foreground("x", 52)).ANSI(), ShouldEqual, "\x1b[0;38;5;196mx\x1b[0m")
+		So(ParseFormatting(HexForeground("x", 0xFF8000)).ANSI(), ShouldEqual, "\x1b[0;38;2;255;128;0mx\x1b[0m")
+		So(Span("x").Fg(Default).ANSI(), ShouldEqual, "\x1b[0mx\x1b[0m")
+	})
+
+	Convey("With the HTML renderer", t, func() {
+		So(ParseFormatting(Colorize("a<b", Red, Blue)).HTML(), ShouldEqual, `<span style="color:#ff0000;background-color:#00007f">a&lt;b</span>`)
+		So(ParseFormatting(Span("x").Bold().Italic().String()).HTML(), ShouldEqual, "<b><i>x</i></b>")
+		So(ParseFormatting(Span("x").Fg(Red).Reverse().String()).HTML(), ShouldEqual, `<span style="background-color:#ff0000">x</span>`)
+		So(ParseFormatting("a"+Monospace("b")).HTML(), ShouldEqual, "a<code>b</code>")
+	})
+
+	Convey("With the Markdown renderer", t, func() {
+		So(Span("a ", Span("bold text ").Bold(), "x_y").Markdown(), ShouldEqual, "a **bold text** x\\_y")
+		So(ParseFormatting(Span("x").Bold().Italic().String()).Markdown(), ShouldEqual, "**_x_**")
+		So(ParseFormatting(Strikethrough("gone")).Markdown(), ShouldEqual, "~~gone~~")
+		So(ParseFormatting(Monospace("a`b")).Markdown(), ShouldEqual, "``a`b``")
+		So(ParseFormatting(Foreground("*red*", Red)).Markdown(), ShouldEqual, "\\*red\\*")
+	})
+}
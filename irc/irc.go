@@ -5,24 +5,25 @@ import (
 	"crypto/tls"
 	"fmt"
 	"net"
-	"strings"
 	"sync"
 	"time"
 
 	"github.com/jriddick/geoffrey/msg"
+	"github.com/jriddick/geoffrey/transcript"
 )
 
 // IRC client
 type IRC struct {
 	sync.WaitGroup
-	conn         net.Conn
-	get          chan *msg.Message
-	put          chan string
-	end          chan struct{}
-	err          chan error
-	config       Config
-	reconnecting bool
-	connected    bool
+	lock   sync.Mutex
+	conn   net.Conn
+	get    chan *msg.Message
+	put    chan *msg.Message
+	end    chan struct{}
+	err    chan error
+	config Config
+	codec  *codec
+	closed bool
 }
 
 // NewIRC returns a new IRC client
@@ -30,134 +31,200 @@ func NewIRC(config Config) *IRC {
 	return &IRC{
 		config: config,
 		get:    make(chan *msg.Message),
-		put:    make(chan string, 100),
-		end:    make(chan struct{}),
+		put:    make(chan *msg.Message, 100),
 		err:    make(chan error, 100),
 	}
 }
 
-func (m *IRC) loopPut() {
+func (m *IRC) loopPut(conn net.Conn, end chan struct{}, failed *sync.Once) {
 	defer m.Done()
 
+	rate := m.config.MessagesPerSecond
+	if rate <= 0 {
+		rate = DefaultMessagesPerSecond
+	}
+
 	// Calculate the duration we have to wait to honor MessagesPerSecond
-	wait := time.Duration(1000/m.config.MessagesPerSecond) * time.Millisecond
+	wait := time.Duration(1000/rate) * time.Millisecond
 
 	for {
 		select {
-		case <-m.end:
+		case <-end:
 			return
 		case msg := <-m.put:
 			// Wait for the pre-determined time before sending
 			time.Sleep(wait)
 
 			// We do not send any empty values
-			if msg == "" {
+			if msg == nil || msg.Command == "" {
 				m.err <- fmt.Errorf("[geoffrey] Tried to send empty message")
 				continue
 			}
 
-			// Make sure the suffix is correct
-			if !strings.HasSuffix(msg, "\r\n") {
-				msg = msg + "\r\n"
+			// We do not send anything that could inject commands
+			if err := msg.Validate(); err != nil {
+				m.err <- fmt.Errorf("[geoffrey] Tried to send invalid message: %v", err)
+				continue
 			}
 
+			// Encode and record the message
+			raw := m.codec.encode(msg)
+			m.record(transcript.Outbound, raw)
+
 			// Set the timeout
-			m.conn.SetWriteDeadline(time.Now().Add(m.config.Timeout))
+			conn.SetWriteDeadline(time.Now().Add(m.config.Timeout))
 
 			// Send the message to the server
-			_, err := m.conn.Write([]byte(msg))
+			_, err := conn.Write(raw)
 
 			// Reset the timeout
-			m.conn.SetWriteDeadline(time.Time{})
+			conn.SetWriteDeadline(time.Time{})
 
 			// Make sure we did not get any errors
 			if err != nil {
-				m.err <- err
+				m.fail(end, failed, err)
 				return
 			}
 		}
 	}
 }
 
-func (m *IRC) loopGet() {
+func (m *IRC) loopGet(conn net.Conn, end chan struct{}, failed *sync.Once) {
 	defer m.Done()
 
-	// Reader for the connection
-	reader := bufio.NewReaderSize(m.conn, 1024)
+	// Reader for the connection large enough for a full message
+	reader := bufio.NewReaderSize(conn, msg.MaxMessageLength)
 
 	for {
 		select {
-		case <-m.end:
+		case <-end:
 			return
 		default:
 			// Set the read timeout
-			m.conn.SetReadDeadline(time.Now().Add(m.config.Timeout))
+			conn.SetReadDeadline(time.Now().Add(m.config.Timeout))
 
 			// Fetch the message from the server
-			raw, err := reader.ReadString('\n')
+			raw, err := reader.ReadSlice('\n')
 
-			// Make sure we don't have any reading errors
-			if err != nil {
-				// Send the error that occured if we aren't currently in the process of connecting
-				if !m.reconnecting {
-					m.err <- err
+			// Skip the rest of lines that do not fit the buffer
+			if err == bufio.ErrBufferFull {
+				for err == bufio.ErrBufferFull {
+					_, err = reader.ReadSlice('\n')
 				}
 
+				if err == nil {
+					m.err <- fmt.Errorf("[parse] Skipped message exceeding %d bytes", msg.MaxMessageLength)
+					continue
+				}
+			}
+
+			// Make sure we don't have any reading errors
+			if err != nil {
+				m.fail(end, failed, err)
 				return
 			}
 
 			// Reset the timeout
-			m.conn.SetReadDeadline(time.Time{})
+			conn.SetReadDeadline(time.Time{})
+
+			// Record the message as it was received
+			m.record(transcript.Inbound, raw)
 
-			// Parse the message
-			msg, err := msg.ParseMessage(raw)
+			// Parse and decode the message
+			msg, err := m.codec.decode(raw)
 
+			// Skip the lines we can not parse
 			if err != nil {
 				m.err <- fmt.Errorf("[parse] Could not parse '%s': %v", raw, err)
-				return
+				continue
 			}
 
 			// Send the parsed message
-			m.get <- msg
+			select {
+			case m.get <- msg:
+			case <-end:
+				return
+			}
 		}
 	}
 }
 
+// record writes the raw line to the transcript if recording
+func (m *IRC) record(direction transcript.Direction, raw []byte) {
+	if m.config.Recorder == nil {
+		return
+	}
+
+	if err := m.config.Recorder.Record(direction, raw); err != nil {
+		// The error must not leak what the transcript redacts
+		line := m.config.Recorder.Redact(transcript.Redact(string(raw)))
+		m.err <- fmt.Errorf("[record] Could not record '%s': %v", line, err)
+	}
+}
+
+// fail sends the error that ended the connection, once for
+// every connection and only if it was not closed on purpose
+func (m *IRC) fail(end chan struct{}, failed *sync.Once, err error) {
+	select {
+	case <-end:
+		return
+	default:
+	}
+
+	failed.Do(func() {
+		select {
+		case m.err <- &ConnectionError{Err: err}:
+		case <-end:
+		}
+	})
+}
+
 // Disconnect will disconnect the client
 func (m *IRC) Disconnect(message string) {
-	// Close the channels
-	if m.end != nil {
-		close(m.end)
-	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
 
-	// Wait for loops
-	m.Wait()
+	// Only disconnect once
+	if m.closed {
+		return
+	}
+	m.closed = true
 
 	// Send quit message to the connection
-	m.conn.Write([]byte("QUIT :" + message + "\r\n"))
-
-	// Close the connection
 	if m.conn != nil {
-		m.conn.Close()
+		quit := msg.Quit(message)
+		if quit.Validate() != nil {
+			quit = msg.Quit("")
+		}
+		m.conn.Write(quit.Bytes())
 	}
 
-	// Reset the connection
-	m.conn = nil
+	// Stop the loops and close the connection
+	m.stop()
 
 	// Close the put channel
-	if m.put != nil {
-		close(m.put)
-	}
+	close(m.put)
 
 	// Close the get channel
-	if m.get != nil {
-		close(m.get)
-	}
+	close(m.get)
 }
 
 // Connect will connect the client, create new channels if needed
 // and start the handler loops.
 func (m *IRC) Connect() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.connect()
+}
+
+// connect opens the connection and starts the loops
+func (m *IRC) connect() error {
+	// Don't connect after we have disconnected
+	if m.closed {
+		return fmt.Errorf("[geoffrey] Connection has been closed")
+	}
+
 	// Don't connect if we already are connected
 	if m.conn != nil {
 		return fmt.Errorf("[geoffrey] Connection already active")
@@ -173,6 +240,11 @@ func (m *IRC) Connect() error {
 		return fmt.Errorf("[geoffrey] Need hostname and port to connect")
 	}
 
+	// Setup the encodings
+	if m.codec, err = newCodec(m.config); err != nil {
+		return err
+	}
+
 	// Create the connection
 	if m.config.Secure {
 		m.conn, err = tls.Dial("tcp", hostname, &tls.Config{
@@ -184,49 +256,49 @@ func (m *IRC) Connect() error {
 
 	// Check for errors
 	if err != nil {
+		m.conn = nil
 		return err
 	}
 
+	// Every connection has its own end channel so that
+	// the loops of an old connection never touch a new one
+	m.end = make(chan struct{})
+
 	// Start the loops
 	m.Add(2)
-	go m.loopGet()
-	go m.loopPut()
+	failed := &sync.Once{}
+	go m.loopGet(m.conn, m.end, failed)
+	go m.loopPut(m.conn, m.end, failed)
 
 	return nil
 }
 
-// Reconnect will disconnect, stop the loops and then call Connect()
-func (m *IRC) Reconnect() error {
-	// Only reconnect if we are connected
-	if m.reconnecting {
-		return nil
-	}
-
-	// Flag as reconnecting
-	m.reconnecting = true
-
-	// Close the connection
-	if m.conn != nil {
-		m.conn.Close()
+// stop ends the loops and closes the connection
+func (m *IRC) stop() {
+	if m.conn == nil {
+		return
 	}
 
-	// Reset the connection
-	m.conn = nil
-
-	// Close the channel
+	// End the loops before closing the connection so
+	// that closing it is not reported as an error
 	close(m.end)
+	m.conn.Close()
 
 	// Wait until loops complete
 	m.Wait()
 
-	// Create the end channel
-	m.end = make(chan struct{})
+	// Reset the connection
+	m.conn = nil
+}
+
+// Reconnect will disconnect, stop the loops and then connect again
+func (m *IRC) Reconnect() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
 
-	// Remove the flag
-	m.reconnecting = false
+	m.stop()
 
-	// Connect to the server again
-	return m.Connect()
+	return m.connect()
 }
 
 // Reader returns channel for reading messages
@@ -235,7 +307,7 @@ func (m *IRC) Reader() <-chan *msg.Message {
 }
 
 // Writer returns channel for sending messages
-func (m *IRC) Writer() chan<- string {
+func (m *IRC) Writer() chan<- *msg.Message {
 	return m.put
 }
 
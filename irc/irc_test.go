@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/jriddick/geoffrey/mockd"
+	"github.com/jriddick/geoffrey/msg"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -22,13 +23,13 @@ var (
 
 func TestClient(t *testing.T) {
 	// Create the mockd server
-	mockd := mockd.NewMockd(5000)
+	server := mockd.NewMockd(5000)
 
 	// Start listening
-	mockd.Listen()
+	server.Listen()
 
 	// Start accepting connections
-	go mockd.Handle()
+	go server.Handle()
 
 	Convey("With the default IRC client", t, func() {
 		Convey("It should be able to connect", func() {
@@ -60,15 +61,15 @@ func TestClient(t *testing.T) {
 			So(<-reader, ShouldNotBeNil)
 
 			// Send our registration
-			writer <- "NICK geoffrey"
-			writer <- "USER geoffrey 0 * :geoffrey"
+			writer <- msg.Nick("geoffrey")
+			writer <- msg.User("geoffrey", "geoffrey")
 
 			// Wait for our verification
 			result := <-reader
 
 			// Verify that we got what we needed
 			So(result, ShouldNotBeNil)
-			So(result.String(), ShouldEqual, ":geoffrey.com 001 Geoffrey :Welcome to the Geoffrey IRC Network!")
+			So(result.String(), ShouldEqual, ":geoffrey.com 001 geoffrey :Welcome to the Geoffrey IRC Network!")
 		})
 
 		Convey("It should be able to reconnect", func() {
@@ -91,6 +92,58 @@ func TestClient(t *testing.T) {
 			So(<-reader, ShouldNotBeNil)
 		})
 
+		Convey("It should report the lost connection once", func() {
+			// Open client
+			client := NewIRC(defaultConfig)
+
+			// Connect and register
+			So(client.Connect(), ShouldBeNil)
+			So(<-client.Reader(), ShouldNotBeNil)
+			client.Writer() <- msg.Nick("lost")
+			client.Writer() <- msg.User("lost", "lost")
+
+			// Keep reading the replies
+			go func() {
+				for range client.Reader() {
+				}
+			}()
+
+			// Drop the connection from the server
+			conn, err := server.WaitClient("lost", time.Second)
+			So(err, ShouldBeNil)
+			conn.Close()
+
+			// We should receive a single connection error
+			err = <-client.Errors()
+			So(err, ShouldHaveSameTypeAs, &ConnectionError{})
+
+			select {
+			case err := <-client.Errors():
+				So(err, ShouldBeNil)
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			// Reconnecting should work again
+			So(client.Reconnect(), ShouldBeNil)
+			client.Disconnect("Leaving")
+		})
+
+		Convey("It should send at the default rate without a configured rate", func() {
+			client := NewIRC(Config{
+				Hostname: defaultConfig.Hostname,
+				Port:     defaultConfig.Port,
+				Timeout:  defaultConfig.Timeout,
+			})
+
+			So(client.Connect(), ShouldBeNil)
+			client.Writer() <- msg.Nick("unlimited")
+			client.Writer() <- msg.User("unlimited", "unlimited")
+
+			_, err := server.WaitClient("unlimited", 5*time.Second)
+			So(err, ShouldBeNil)
+			client.Disconnect("Leaving")
+		})
+
 		Convey("It should reject empty hostname", func() {
 			// Open client
 			client := NewIRC(Config{
@@ -123,6 +176,32 @@ func TestClient(t *testing.T) {
 			So(client.Connect(), ShouldNotBeNil)
 		})
 
+		Convey("It should connect securely to ssl server", func() {
+			// Create the secure server
+			secure := mockd.NewMockd(0)
+			secure.Secure = true
+			So(secure.Listen(), ShouldBeNil)
+			go secure.Handle()
+			defer secure.Stop()
+
+			// Create the client trusting any certificate
+			client := NewIRC(Config{
+				Hostname:           defaultConfig.Hostname,
+				Port:               secure.Port,
+				Secure:             true,
+				InsecureSkipVerify: true,
+				Timeout:            defaultConfig.Timeout,
+				TimeoutLimit:       defaultConfig.TimeoutLimit,
+				MessagesPerSecond:  defaultConfig.MessagesPerSecond,
+			})
+
+			// Should connect and read the opening
+			So(client.Connect(), ShouldBeNil)
+			So((<-client.Reader()).Trailing, ShouldEqual, "*** Looking up your hostname...")
+
+			client.Disconnect("Leaving")
+		})
+
 		Convey("It should not be able to connect twice", func() {
 			// Create the client
 			client := NewIRC(defaultConfig)
@@ -145,7 +224,7 @@ func TestClient(t *testing.T) {
 			writer := client.Writer()
 
 			// Send empty message
-			writer <- ""
+			writer <- &msg.Message{}
 
 			// Get error channel
 			errors := client.Errors()
@@ -158,6 +237,24 @@ func TestClient(t *testing.T) {
 			So(err.Error(), ShouldEqual, "[geoffrey] Tried to send empty message")
 		})
 
+		Convey("It should not be able to send invalid messages", func() {
+			// Create the client
+			client := NewIRC(defaultConfig)
+
+			// Should succeed to connect
+			So(client.Connect(), ShouldBeNil)
+
+			// Try to inject a second command
+			client.Writer() <- msg.Privmsg("#test", "Title\r\nQUIT :injected")
+
+			// We should receive error
+			err := <-client.Errors()
+
+			// Check the error
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "[geoffrey] Tried to send invalid message: message contains NUL, CR or LF")
+		})
+
 		Convey("It should be able to disconnect", func() {
 			// Create the client
 			client := NewIRC(Config{
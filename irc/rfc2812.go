@@ -52,6 +52,7 @@ const (
 	List            = "322"
 	Listend         = "323"
 	Channelmodeis   = "324"
+	Whoisaccount    = "330"
 	Uniqopis        = "325"
 	Notopic         = "331"
 	Topic           = "332"
@@ -64,6 +65,7 @@ const (
 	Version         = "351"
 	Whoreply        = "352"
 	Namreply        = "353"
+	Whospcrpl       = "354"
 	Links           = "364"
 	Endoflinks      = "365"
 	Endofnames      = "366"
@@ -83,13 +85,26 @@ const (
 	Users           = "393"
 	Endofusers      = "394"
 	Nousers         = "395"
+	Whoissecure     = "671"
 	Join            = "JOIN"
+	Kick            = "KICK"
+	Invite          = "INVITE"
 	Message         = "PRIVMSG"
 	Part            = "PART"
 	Ping            = "PING"
 	Quit            = "QUIT"
 	Custom          = "999"
 	Notice          = "NOTICE"
+	Loggedin        = "900"
+	Cap             = "CAP"
+	Batch           = "BATCH"
+	Ack             = "ACK"
+	Nick            = "NICK"
+	Who             = "WHO"
+	Whois           = "WHOIS"
+	Names           = "NAMES"
+	Mode            = "MODE"
+	Account         = "ACCOUNT"
 
 	ErrNosuchnick        = "401"
 	ErrNosuchserver      = "402"
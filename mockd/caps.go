@@ -0,0 +1,203 @@
+package mockd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultCapabilities are the capabilities advertised by default
+var DefaultCapabilities = map[string]string{
+	"sasl": "PLAIN,EXTERNAL",
+}
+
+// mechanisms are the supported SASL mechanisms
+var mechanisms = []string{"PLAIN", "EXTERNAL"}
+
+// capabilityList returns the advertised capabilities sorted
+// by name, with their values for CAP LS 302
+func (m *Mockd) capabilityList(values bool) []string {
+	var caps []string
+	for name, value := range m.Capabilities {
+		if values && value != "" {
+			name += "=" + value
+		}
+		caps = append(caps, name)
+	}
+	sort.Strings(caps)
+
+	return caps
+}
+
+// capability replies to the CAP subcommands. Registration is
+// held from the first CAP command until CAP END.
+func (m *Mockd) capability(client *Client, params []string) {
+	if len(params) == 0 {
+		m.reply(client, "461", "CAP", "Not enough parameters")
+		return
+	}
+
+	if !client.registered {
+		client.negotiating = true
+	}
+
+	reply := func(params ...string) {
+		m.reply(client, "CAP", params...)
+	}
+
+	switch strings.ToUpper(params[0]) {
+	case "LS":
+		if len(params) > 1 {
+			client.capVersion, _ = strconv.Atoi(params[1])
+		}
+
+		// Only CAP 302 clients understand multiline replies
+		caps := m.capabilityList(client.capVersion >= 302)
+		for client.capVersion >= 302 && len(strings.Join(caps, " ")) > 400 {
+			n := 1
+			for n < len(caps) && len(strings.Join(caps[:n+1], " ")) <= 400 {
+				n++
+			}
+
+			reply("LS", "*", strings.Join(caps[:n], " "))
+			caps = caps[n:]
+		}
+
+		reply("LS", strings.Join(caps, " "))
+	case "LIST":
+		var enabled []string
+		for name := range client.caps {
+			enabled = append(enabled, name)
+		}
+		sort.Strings(enabled)
+
+		reply("LIST", strings.Join(enabled, " "))
+	case "REQ":
+		requested := ""
+		if len(params) > 1 {
+			requested = params[1]
+		}
+
+		// The request is acknowledged or refused as a whole
+		for _, name := range strings.Fields(requested) {
+			if _, ok := m.Capabilities[strings.TrimPrefix(name, "-")]; !ok {
+				reply("NAK", requested)
+				return
+			}
+		}
+
+		for _, name := range strings.Fields(requested) {
+			if strings.HasPrefix(name, "-") {
+				delete(client.caps, name[1:])
+			} else {
+				client.caps[name] = true
+			}
+		}
+
+		reply("ACK", requested)
+	case "END":
+		client.negotiating = false
+		m.register(client)
+	default:
+		m.reply(client, "410", params[0], "Invalid CAP command")
+	}
+}
+
+// authenticate runs the SASL PLAIN and EXTERNAL exchanges
+func (m *Mockd) authenticate(client *Client, params []string) {
+	if len(params) == 0 {
+		m.reply(client, "461", "AUTHENTICATE", "Not enough parameters")
+		return
+	}
+
+	if !client.caps["sasl"] {
+		m.reply(client, "904", "SASL authentication failed")
+		return
+	}
+
+	if client.account != "" {
+		m.reply(client, "907", "You have already authenticated using SASL")
+		return
+	}
+
+	data := params[0]
+
+	if data == "*" {
+		client.mechanism, client.response = "", ""
+		m.reply(client, "906", "SASL authentication aborted")
+		return
+	}
+
+	// Start a new exchange with the mechanism
+	if client.mechanism == "" {
+		mechanism := strings.ToUpper(data)
+
+		supported := false
+		for _, name := range mechanisms {
+			supported = supported || name == mechanism
+		}
+
+		if !supported {
+			m.reply(client, "908", strings.Join(mechanisms, ","), "are available SASL mechanisms")
+			m.reply(client, "904", "SASL authentication failed")
+			return
+		}
+
+		client.mechanism = mechanism
+		client.Send("AUTHENTICATE +")
+		return
+	}
+
+	// Responses are sent in chunks of 400 bytes where a
+	// shorter chunk or '+' ends the response
+	if data != "+" {
+		client.response += data
+	}
+	if len(data) == 400 {
+		return
+	}
+
+	mechanism, response := client.mechanism, client.response
+	client.mechanism, client.response = "", ""
+
+	account, ok := "", false
+	switch mechanism {
+	case "PLAIN":
+		account, ok = m.plain(response)
+	case "EXTERNAL":
+		account, ok = m.Fingerprints[client.peerFingerprint()]
+	}
+
+	if !ok {
+		m.reply(client, "904", "SASL authentication failed")
+		return
+	}
+
+	client.account = account
+	m.reply(client, "900", client.prefix().String(), account, "You are now logged in as "+account)
+	m.reply(client, "903", "SASL authentication successful")
+}
+
+// plain returns the account if the PLAIN response carries
+// the password of the account
+func (m *Mockd) plain(response string) (string, bool) {
+	decoded, err := base64.StdEncoding.DecodeString(response)
+	if err != nil {
+		return "", false
+	}
+
+	// <authzid> NUL <authcid> NUL <passwd>
+	fields := bytes.Split(decoded, []byte{0})
+	if len(fields) != 3 {
+		return "", false
+	}
+
+	account, password := string(fields[1]), string(fields[2])
+	if expected, ok := m.Accounts[account]; !ok || expected != password {
+		return "", false
+	}
+
+	return account, true
+}
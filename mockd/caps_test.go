@@ -0,0 +1,183 @@
+package mockd
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMockdSecure(t *testing.T) {
+	client, err := SelfSigned("geoffrey")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("With a secure Mockd server", t, func() {
+		mockd := NewMockd(0)
+		mockd.Secure = true
+		mockd.ClientAuth = tls.RequestClientCert
+		mockd.Accounts["geoffrey"] = "hunter2"
+		mockd.Fingerprints[Fingerprint(client.Leaf)] = "geoffrey"
+		So(mockd.Listen(), ShouldBeNil)
+		go mockd.Handle()
+
+		// connect opens a verified connection with the certificates
+		connect := func(certificates ...tls.Certificate) *testConn {
+			conn, err := tls.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", mockd.Port), &tls.Config{
+				RootCAs:      mockd.RootCAs(),
+				Certificates: certificates,
+			})
+			So(err, ShouldBeNil)
+
+			return &testConn{Conn: conn, reader: bufio.NewReader(conn)}
+		}
+
+		// negotiate requests SASL and starts the registration
+		negotiate := func(conn *testConn) {
+			conn.send("CAP LS 302")
+			So(conn.expect("CAP").Params, ShouldResemble, []string{"*", "LS"})
+
+			conn.send("NICK geoffrey")
+			conn.send("USER geoffrey * 0 :Geoffrey")
+			conn.send("CAP REQ :sasl")
+			So(conn.expect("CAP").Trailing, ShouldEqual, "sasl")
+		}
+
+		Convey("It should verify against the generated certificate", func() {
+			conn := connect()
+			defer conn.Close()
+
+			So(conn.expect("NOTICE").Trailing, ShouldEqual, "*** Looking up your hostname...")
+		})
+
+		Convey("It should hold the registration until CAP END", func() {
+			conn := connect()
+			defer conn.Close()
+
+			conn.send("CAP LS")
+			So(conn.expect("CAP").Trailing, ShouldEqual, "sasl")
+
+			conn.send("NICK geoffrey")
+			conn.send("USER geoffrey * 0 :Geoffrey")
+			conn.send("CAP REQ :sasl unknown")
+			So(conn.expect("CAP").Params, ShouldResemble, []string{"geoffrey", "NAK"})
+
+			conn.send("CAP LIST")
+			So(conn.expect("CAP").Trailing, ShouldEqual, "")
+
+			conn.send("CAP END")
+			So(conn.expect("001").Params, ShouldResemble, []string{"geoffrey"})
+		})
+
+		Convey("It should accept SASL PLAIN with the password", func() {
+			conn := connect()
+			defer conn.Close()
+			negotiate(conn)
+
+			conn.send("AUTHENTICATE PLAIN")
+			So(conn.expect("AUTHENTICATE").Params, ShouldResemble, []string{"+"})
+
+			conn.send("AUTHENTICATE " + base64.StdEncoding.EncodeToString([]byte("\x00geoffrey\x00hunter2")))
+			So(conn.expect("900").Params, ShouldResemble, []string{"geoffrey", "geoffrey!geoffrey@127.0.0.1", "geoffrey"})
+			So(conn.expect("903"), ShouldNotBeNil)
+
+			conn.send("CAP END")
+			conn.expect("376")
+
+			conn.send("WHOIS geoffrey")
+			So(conn.expect("330").Params, ShouldResemble, []string{"geoffrey", "geoffrey", "geoffrey"})
+		})
+
+		Convey("It should reject SASL PLAIN with the wrong password", func() {
+			conn := connect()
+			defer conn.Close()
+			negotiate(conn)
+
+			conn.send("AUTHENTICATE PLAIN")
+			conn.expect("AUTHENTICATE")
+
+			conn.send("AUTHENTICATE " + base64.StdEncoding.EncodeToString([]byte("\x00geoffrey\x00wrong")))
+			So(conn.expect("904").Trailing, ShouldEqual, "SASL authentication failed")
+		})
+
+		Convey("It should accept SASL EXTERNAL with the certificate", func() {
+			conn := connect(client)
+			defer conn.Close()
+			negotiate(conn)
+
+			conn.send("AUTHENTICATE EXTERNAL")
+			conn.expect("AUTHENTICATE")
+
+			conn.send("AUTHENTICATE +")
+			So(conn.expect("903"), ShouldNotBeNil)
+		})
+
+		Convey("It should reject SASL EXTERNAL without a certificate", func() {
+			conn := connect()
+			defer conn.Close()
+			negotiate(conn)
+
+			conn.send("AUTHENTICATE EXTERNAL")
+			conn.expect("AUTHENTICATE")
+
+			conn.send("AUTHENTICATE +")
+			So(conn.expect("904"), ShouldNotBeNil)
+		})
+
+		Convey("It should list the mechanisms when unsupported", func() {
+			conn := connect()
+			defer conn.Close()
+			negotiate(conn)
+
+			conn.send("AUTHENTICATE SCRAM-SHA-256")
+			So(conn.expect("908").Params, ShouldResemble, []string{"geoffrey", "PLAIN,EXTERNAL"})
+			So(conn.expect("904"), ShouldNotBeNil)
+		})
+
+		Reset(func() {
+			So(mockd.Stop(), ShouldBeNil)
+		})
+	})
+
+	Convey("With a Mockd server requiring client certificates", t, func() {
+		mockd := NewMockd(0)
+		mockd.Secure = true
+		mockd.ClientAuth = tls.RequireAnyClientCert
+		So(mockd.Listen(), ShouldBeNil)
+		go mockd.Handle()
+
+		Convey("It should refuse clients without a certificate", func() {
+			conn, err := tls.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", mockd.Port), &tls.Config{
+				RootCAs: mockd.RootCAs(),
+			})
+
+			// The handshake fails on the first read with TLS 1.3
+			if err == nil {
+				defer conn.Close()
+				_, err = bufio.NewReader(conn).ReadString('\n')
+			}
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("It should accept clients with a certificate", func() {
+			conn, err := tls.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", mockd.Port), &tls.Config{
+				RootCAs:      mockd.RootCAs(),
+				Certificates: []tls.Certificate{client},
+			})
+			So(err, ShouldBeNil)
+			defer conn.Close()
+
+			line, err := bufio.NewReader(conn).ReadString('\n')
+			So(err, ShouldBeNil)
+			So(line, ShouldEqual, ":geoffrey.com NOTICE Auth :*** Looking up your hostname...\r\n")
+		})
+
+		Reset(func() {
+			So(mockd.Stop(), ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,721 @@
+package mockd
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jriddick/geoffrey/msg"
+)
+
+// Channel is a snapshot of a channel on the mocked server
+type Channel struct {
+	Name  string
+	Topic string
+	Key   string
+	Limit int
+	// Modes are the set flag modes like 'imnt'
+	Modes string
+	// Members maps the nicks to their prefixes like '@'
+	Members map[string]string
+	Bans    []string
+	Quiets  []string
+}
+
+// channel is the state of a channel guarded by the server lock
+type channel struct {
+	name    string
+	topic   string
+	key     string
+	limit   int
+	modes   map[byte]bool
+	members []*member
+	bans    []string
+	quiets  []string
+	invites map[*Client]bool
+}
+
+// member is a client in a channel
+type member struct {
+	client *Client
+	op     bool
+	voice  bool
+}
+
+// prefix returns the highest prefix of the member
+func (m *member) prefix() string {
+	switch {
+	case m.op:
+		return "@"
+	case m.voice:
+		return "+"
+	}
+
+	return ""
+}
+
+// newChannel creates the channel with the default modes
+func newChannel(name string) *channel {
+	return &channel{
+		name:    name,
+		modes:   map[byte]bool{'n': true, 't': true},
+		invites: make(map[*Client]bool),
+	}
+}
+
+// member returns the member for the client if it is in the channel
+func (c *channel) member(client *Client) *member {
+	for _, member := range c.members {
+		if member.client == client {
+			return member
+		}
+	}
+
+	return nil
+}
+
+// find returns the member with the nick
+func (c *channel) find(nick string) *member {
+	for _, member := range c.members {
+		if fold(member.client.nick) == fold(nick) {
+			return member
+		}
+	}
+
+	return nil
+}
+
+// remove removes the client from the channel
+func (c *channel) remove(client *Client) {
+	for i, member := range c.members {
+		if member.client == client {
+			c.members = append(c.members[:i], c.members[i+1:]...)
+			break
+		}
+	}
+
+	delete(c.invites, client)
+}
+
+// sorted returns the members sorted by nick
+func (c *channel) sorted() []*member {
+	members := append([]*member(nil), c.members...)
+	sort.Slice(members, func(i, j int) bool {
+		return fold(members[i].client.nick) < fold(members[j].client.nick)
+	})
+
+	return members
+}
+
+// matches returns true if the client matches any of the masks
+func (c *channel) matches(client *Client, masks []string) bool {
+	for _, raw := range masks {
+		mask, err := msg.ParseMask(raw, msg.RFC1459)
+		if err == nil && mask.Match(client.prefix(), "") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// canSend returns true if the client may talk in the channel
+func (c *channel) canSend(client *Client) bool {
+	member := c.member(client)
+	if member == nil {
+		return !c.modes['n'] && !c.matches(client, c.bans)
+	}
+
+	if member.op || member.voice {
+		return true
+	}
+
+	return !c.modes['m'] && !c.matches(client, c.bans) && !c.matches(client, c.quiets)
+}
+
+// broadcast sends the message to every member but the sender
+func (c *channel) broadcast(message *msg.Message, sender *Client) {
+	for _, member := range c.members {
+		if member.client != sender {
+			member.client.send(message)
+		}
+	}
+}
+
+// flags returns the set flag modes sorted
+func (c *channel) flags() string {
+	var flags []byte
+	for mode, set := range c.modes {
+		if set {
+			flags = append(flags, mode)
+		}
+	}
+	sort.Slice(flags, func(i, j int) bool { return flags[i] < flags[j] })
+
+	return string(flags)
+}
+
+// snapshot returns the exported copy of the channel
+func (c *channel) snapshot() Channel {
+	members := make(map[string]string)
+	for _, member := range c.members {
+		members[member.client.nick] = member.prefix()
+	}
+
+	return Channel{
+		Name:    c.name,
+		Topic:   c.topic,
+		Key:     c.key,
+		Limit:   c.limit,
+		Modes:   c.flags(),
+		Members: members,
+		Bans:    append([]string(nil), c.bans...),
+		Quiets:  append([]string(nil), c.quiets...),
+	}
+}
+
+// Channel returns a snapshot of the channel if it exists
+func (m *Mockd) Channel(name string) (Channel, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	channel, ok := m.channels[fold(name)]
+	if !ok {
+		return Channel{}, false
+	}
+
+	return channel.snapshot(), true
+}
+
+// channelName returns true if the name is a channel name
+func channelName(name string) bool {
+	return len(name) > 1 && strings.IndexByte("#&", name[0]) > -1 && !strings.ContainsAny(name, " ,\a")
+}
+
+// join adds the client to the channels
+func (m *Mockd) join(client *Client, params []string) {
+	if len(params) == 0 {
+		m.reply(client, "461", "JOIN", "Not enough parameters")
+		return
+	}
+
+	var keys []string
+	if len(params) > 1 {
+		keys = strings.Split(params[1], ",")
+	}
+
+	for i, name := range strings.Split(params[0], ",") {
+		if !channelName(name) {
+			m.reply(client, "403", name, "No such channel")
+			continue
+		}
+
+		key := ""
+		if i < len(keys) {
+			key = keys[i]
+		}
+
+		channel, ok := m.channels[fold(name)]
+		if !ok {
+			channel = newChannel(name)
+			m.channels[fold(name)] = channel
+		}
+
+		if channel.member(client) != nil {
+			continue
+		}
+
+		if len(channel.members) > 0 {
+			invited := channel.invites[client]
+
+			switch {
+			case channel.key != "" && channel.key != key:
+				m.reply(client, "475", channel.name, "Cannot join channel (+k)")
+				continue
+			case channel.limit > 0 && len(channel.members) >= channel.limit:
+				m.reply(client, "471", channel.name, "Cannot join channel (+l)")
+				continue
+			case channel.modes['i'] && !invited:
+				m.reply(client, "473", channel.name, "Cannot join channel (+i)")
+				continue
+			case channel.matches(client, channel.bans) && !invited:
+				m.reply(client, "474", channel.name, "Cannot join channel (+b)")
+				continue
+			}
+		}
+
+		// The first member becomes the operator
+		channel.members = append(channel.members, &member{
+			client: client,
+			op:     len(channel.members) == 0,
+		})
+		delete(channel.invites, client)
+
+		join := &msg.Message{
+			Prefix:  client.prefix(),
+			Command: "JOIN",
+			Params:  []string{channel.name},
+		}
+		client.send(join)
+		channel.broadcast(join, client)
+
+		if channel.topic != "" {
+			m.reply(client, "332", channel.name, channel.topic)
+		}
+		m.namesReply(client, channel)
+	}
+}
+
+// part removes the client from the channels
+func (m *Mockd) part(client *Client, params []string) {
+	if len(params) == 0 {
+		m.reply(client, "461", "PART", "Not enough parameters")
+		return
+	}
+
+	reason := ""
+	if len(params) > 1 {
+		reason = params[1]
+	}
+
+	for _, name := range strings.Split(params[0], ",") {
+		channel, ok := m.channels[fold(name)]
+		if !ok {
+			m.reply(client, "403", name, "No such channel")
+			continue
+		}
+
+		if channel.member(client) == nil {
+			m.reply(client, "442", channel.name, "You're not on that channel")
+			continue
+		}
+
+		part := &msg.Message{
+			Prefix:   client.prefix(),
+			Command:  "PART",
+			Params:   []string{channel.name},
+			Trailing: reason,
+		}
+		client.send(part)
+		channel.broadcast(part, client)
+
+		m.leave(channel, client)
+	}
+}
+
+// leave removes the client and drops the channel once empty
+func (m *Mockd) leave(channel *channel, client *Client) {
+	channel.remove(client)
+
+	if len(channel.members) == 0 {
+		delete(m.channels, fold(channel.name))
+	}
+}
+
+// names replies with the members of the channels
+func (m *Mockd) names(client *Client, params []string) {
+	if len(params) == 0 {
+		m.reply(client, "366", "*", "End of /NAMES list.")
+		return
+	}
+
+	for _, name := range strings.Split(params[0], ",") {
+		if channel, ok := m.channels[fold(name)]; ok {
+			m.namesReply(client, channel)
+			continue
+		}
+
+		m.reply(client, "366", name, "End of /NAMES list.")
+	}
+}
+
+// namesReply sends the members of the channel in lines of at
+// most ten nicks
+func (m *Mockd) namesReply(client *Client, channel *channel) {
+	var names []string
+	for _, member := range channel.sorted() {
+		names = append(names, member.prefix()+member.client.nick)
+	}
+
+	for len(names) > 0 {
+		n := len(names)
+		if n > 10 {
+			n = 10
+		}
+
+		m.reply(client, "353", "=", channel.name, strings.Join(names[:n], " "))
+		names = names[n:]
+	}
+
+	m.reply(client, "366", channel.name, "End of /NAMES list.")
+}
+
+// topic replies with or changes the topic of the channel
+func (m *Mockd) topic(client *Client, params []string) {
+	if len(params) == 0 {
+		m.reply(client, "461", "TOPIC", "Not enough parameters")
+		return
+	}
+
+	channel, ok := m.channels[fold(params[0])]
+	if !ok {
+		m.reply(client, "403", params[0], "No such channel")
+		return
+	}
+
+	member := channel.member(client)
+	if member == nil {
+		m.reply(client, "442", channel.name, "You're not on that channel")
+		return
+	}
+
+	if len(params) == 1 {
+		if channel.topic == "" {
+			m.reply(client, "331", channel.name, "No topic is set")
+		} else {
+			m.reply(client, "332", channel.name, channel.topic)
+		}
+		return
+	}
+
+	if channel.modes['t'] && !member.op {
+		m.reply(client, "482", channel.name, "You're not channel operator")
+		return
+	}
+
+	channel.topic = params[1]
+
+	topic := &msg.Message{
+		Prefix:        client.prefix(),
+		Command:       "TOPIC",
+		Params:        []string{channel.name},
+		Trailing:      channel.topic,
+		EmptyTrailing: channel.topic == "",
+	}
+	client.send(topic)
+	channel.broadcast(topic, client)
+}
+
+// mode replies with or changes the modes of the channel. User
+// modes are accepted but ignored.
+func (m *Mockd) mode(client *Client, params []string) {
+	if len(params) == 0 {
+		m.reply(client, "461", "MODE", "Not enough parameters")
+		return
+	}
+
+	if !channelName(params[0]) {
+		if fold(params[0]) != fold(client.nick) {
+			m.reply(client, "502", "Cannot change mode for other users")
+			return
+		}
+
+		m.reply(client, "221", "+i")
+		return
+	}
+
+	channel, ok := m.channels[fold(params[0])]
+	if !ok {
+		m.reply(client, "403", params[0], "No such channel")
+		return
+	}
+
+	if len(params) == 1 {
+		reply := []string{channel.name, "+" + channel.flags()}
+		if channel.key != "" {
+			reply[1] += "k"
+			reply = append(reply, channel.key)
+		}
+		if channel.limit > 0 {
+			reply[1] += "l"
+			reply = append(reply, strconv.Itoa(channel.limit))
+		}
+
+		m.reply(client, "324", reply...)
+		return
+	}
+
+	member := channel.member(client)
+	args := params[2:]
+	next := func() (string, bool) {
+		if len(args) == 0 {
+			return "", false
+		}
+
+		arg := args[0]
+		args = args[1:]
+		return arg, true
+	}
+
+	var modes, changed []string
+	sign := ""
+	add := true
+	apply := func(mode byte, param string) {
+		symbol := "-"
+		if add {
+			symbol = "+"
+		}
+
+		if symbol != sign {
+			modes = append(modes, symbol)
+			sign = symbol
+		}
+
+		modes = append(modes, string(mode))
+		if param != "" {
+			changed = append(changed, param)
+		}
+	}
+
+	for i := 0; i < len(params[1]); i++ {
+		mode := params[1][i]
+
+		switch mode {
+		case '+', '-':
+			add = mode == '+'
+			continue
+		}
+
+		switch mode {
+		case 'b', 'q':
+			mask, ok := next()
+			if !ok {
+				m.listReply(client, channel, mode)
+				continue
+			}
+			if member == nil || !member.op {
+				m.reply(client, "482", channel.name, "You're not channel operator")
+				return
+			}
+
+			list := &channel.bans
+			if mode == 'q' {
+				list = &channel.quiets
+			}
+
+			mask = msg.NormalizeMask(mask)
+			if modifyList(list, mask, add) {
+				apply(mode, mask)
+			}
+		case 'o', 'v':
+			nick, ok := next()
+			if !ok {
+				continue
+			}
+			if member == nil || !member.op {
+				m.reply(client, "482", channel.name, "You're not channel operator")
+				return
+			}
+
+			target := channel.find(nick)
+			if target == nil {
+				m.reply(client, "441", nick, channel.name, "They aren't on that channel")
+				continue
+			}
+
+			if mode == 'o' {
+				target.op = add
+			} else {
+				target.voice = add
+			}
+			apply(mode, target.client.nick)
+		case 'k', 'l':
+			if member == nil || !member.op {
+				m.reply(client, "482", channel.name, "You're not channel operator")
+				return
+			}
+
+			param, ok := next()
+			if add && !ok {
+				continue
+			}
+
+			if mode == 'k' {
+				channel.key = ""
+				if add {
+					channel.key = param
+				} else {
+					param = "*"
+				}
+				apply(mode, param)
+				continue
+			}
+
+			if !add {
+				channel.limit = 0
+				apply(mode, "")
+				continue
+			}
+
+			limit, err := strconv.Atoi(param)
+			if err != nil || limit <= 0 {
+				continue
+			}
+
+			channel.limit = limit
+			apply(mode, param)
+		case 'i', 'm', 'n', 'r', 't':
+			if member == nil || !member.op {
+				m.reply(client, "482", channel.name, "You're not channel operator")
+				return
+			}
+
+			if channel.modes[mode] != add {
+				channel.modes[mode] = add
+				apply(mode, "")
+			}
+		default:
+			m.reply(client, "472", string(mode), "is unknown mode char to me")
+		}
+	}
+
+	if len(modes) == 0 {
+		return
+	}
+
+	change := &msg.Message{
+		Prefix:  client.prefix(),
+		Command: "MODE",
+		Params:  append([]string{channel.name, strings.Join(modes, "")}, changed...),
+	}
+	client.send(change)
+	channel.broadcast(change, client)
+}
+
+// modifyList adds or removes the mask and returns true if
+// the list changed
+func modifyList(list *[]string, mask string, add bool) bool {
+	for i, existing := range *list {
+		if fold(existing) != fold(mask) {
+			continue
+		}
+
+		if !add {
+			*list = append((*list)[:i], (*list)[i+1:]...)
+		}
+
+		return !add
+	}
+
+	if add {
+		*list = append(*list, mask)
+	}
+
+	return add
+}
+
+// listReply sends the ban or quiet list of the channel
+func (m *Mockd) listReply(client *Client, channel *channel, mode byte) {
+	entry, end, list := "367", "368", channel.bans
+	if mode == 'q' {
+		entry, end, list = "728", "729", channel.quiets
+	}
+
+	set := strconv.FormatInt(time.Now().Unix(), 10)
+	for _, mask := range list {
+		if mode == 'q' {
+			m.reply(client, entry, channel.name, "q", mask, m.Name, set)
+		} else {
+			m.reply(client, entry, channel.name, mask, m.Name, set)
+		}
+	}
+
+	if mode == 'q' {
+		m.reply(client, end, channel.name, "q", "End of Channel Quiet List")
+	} else {
+		m.reply(client, end, channel.name, "End of Channel Ban List")
+	}
+}
+
+// kick removes the nick from the channel
+func (m *Mockd) kick(client *Client, params []string) {
+	if len(params) < 2 {
+		m.reply(client, "461", "KICK", "Not enough parameters")
+		return
+	}
+
+	channel, ok := m.channels[fold(params[0])]
+	if !ok {
+		m.reply(client, "403", params[0], "No such channel")
+		return
+	}
+
+	member := channel.member(client)
+	if member == nil {
+		m.reply(client, "442", channel.name, "You're not on that channel")
+		return
+	}
+
+	if !member.op {
+		m.reply(client, "482", channel.name, "You're not channel operator")
+		return
+	}
+
+	target := channel.find(params[1])
+	if target == nil {
+		m.reply(client, "441", params[1], channel.name, "They aren't on that channel")
+		return
+	}
+
+	reason := target.client.nick
+	if len(params) > 2 && params[2] != "" {
+		reason = params[2]
+	}
+
+	kick := &msg.Message{
+		Prefix:   client.prefix(),
+		Command:  "KICK",
+		Params:   []string{channel.name, target.client.nick},
+		Trailing: reason,
+	}
+	client.send(kick)
+	channel.broadcast(kick, client)
+
+	m.leave(channel, target.client)
+}
+
+// invite lets the nick join the channel past +i and bans
+func (m *Mockd) invite(client *Client, params []string) {
+	if len(params) < 2 {
+		m.reply(client, "461", "INVITE", "Not enough parameters")
+		return
+	}
+
+	other, ok := m.nicks[fold(params[0])]
+	if !ok {
+		m.reply(client, "401", params[0], "No such nick/channel")
+		return
+	}
+
+	channel, ok := m.channels[fold(params[1])]
+	if !ok {
+		m.reply(client, "403", params[1], "No such channel")
+		return
+	}
+
+	member := channel.member(client)
+	if member == nil {
+		m.reply(client, "442", channel.name, "You're not on that channel")
+		return
+	}
+
+	if channel.member(other) != nil {
+		m.reply(client, "443", other.nick, channel.name, "is already on channel")
+		return
+	}
+
+	if channel.modes['i'] && !member.op {
+		m.reply(client, "482", channel.name, "You're not channel operator")
+		return
+	}
+
+	channel.invites[other] = true
+
+	m.reply(client, "341", other.nick, channel.name)
+	other.send(&msg.Message{
+		Prefix:  client.prefix(),
+		Command: "INVITE",
+		Params:  []string{other.nick, channel.name},
+	})
+}
@@ -0,0 +1,208 @@
+package mockd
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jriddick/geoffrey/msg"
+)
+
+// Client is a connection to the mocked server
+type Client struct {
+	server *Mockd
+	conn   net.Conn
+	closed chan struct{}
+	once   sync.Once
+
+	// Guarded by the server lock
+	nick       string
+	user       string
+	host       string
+	realname   string
+	registered bool
+	account    string
+
+	// Capability negotiation and SASL guarded by the server lock
+	negotiating bool
+	capVersion  int
+	caps        map[string]bool
+	mechanism   string
+	response    string
+
+	// Guarded by the client lock
+	lock     sync.Mutex
+	write    sync.Mutex
+	received []*msg.Message
+	cursor   int
+	notify   chan struct{}
+	seen     time.Time
+	frozen   bool
+	delay    time.Duration
+}
+
+// newClient creates the client for the connection
+func newClient(server *Mockd, conn net.Conn) *Client {
+	host := conn.RemoteAddr().String()
+	if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		host = addr.IP.String()
+	}
+
+	return &Client{
+		server: server,
+		conn:   conn,
+		closed: make(chan struct{}),
+		host:   host,
+		caps:   make(map[string]bool),
+		notify: make(chan struct{}),
+		seen:   time.Now(),
+	}
+}
+
+// Nick returns the current nick of the client
+func (c *Client) Nick() string {
+	c.server.lock.Lock()
+	defer c.server.lock.Unlock()
+
+	return c.nick
+}
+
+// prefix returns the prefix of the client as 'nick!user@host'
+func (c *Client) prefix() *msg.Prefix {
+	return &msg.Prefix{
+		Name: c.nick,
+		User: c.user,
+		Host: c.host,
+	}
+}
+
+// target returns the nick used in numeric replies
+func (c *Client) target() string {
+	if c.nick == "" {
+		return "*"
+	}
+
+	return c.nick
+}
+
+// Send writes the raw line to the client, adding the line
+// ending if it is missing
+func (c *Client) Send(line string) error {
+	if !strings.HasSuffix(line, "\r\n") {
+		line += "\r\n"
+	}
+
+	return c.SendRaw(line)
+}
+
+// SendRaw writes the data to the client as it is, which
+// allows sending partial lines
+func (c *Client) SendRaw(data string) error {
+	c.lock.Lock()
+	frozen, delay := c.frozen, c.delay
+	c.lock.Unlock()
+
+	// Frozen clients never receive anything
+	if frozen {
+		return nil
+	}
+
+	c.write.Lock()
+	defer c.write.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+
+	c.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	_, err := c.conn.Write([]byte(data))
+
+	return err
+}
+
+// send writes the message to the client
+func (c *Client) send(message *msg.Message) {
+	c.Send(message.String())
+}
+
+// Close disconnects the client from the server side
+func (c *Client) Close() {
+	c.once.Do(func() {
+		close(c.closed)
+		c.conn.Close()
+	})
+}
+
+// record stores the message received from the client and
+// returns false if the client is frozen
+func (c *Client) record(message *msg.Message) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	// Frozen clients are never heard
+	if c.frozen {
+		return false
+	}
+
+	c.received = append(c.received, message)
+	c.seen = time.Now()
+
+	// Wake up everyone waiting for a message
+	close(c.notify)
+	c.notify = make(chan struct{})
+
+	return true
+}
+
+// idle returns the time since the last message from the client
+func (c *Client) idle() time.Duration {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return time.Since(c.seen)
+}
+
+// Received returns every message received from the client
+func (c *Client) Received() []*msg.Message {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return append([]*msg.Message(nil), c.received...)
+}
+
+// Wait returns the next message received from the client
+// that matches, skipping the messages before it. Messages
+// returned by earlier waits are never matched again.
+func (c *Client) Wait(match func(*msg.Message) bool, timeout time.Duration) (*msg.Message, error) {
+	deadline := time.After(timeout)
+
+	for {
+		c.lock.Lock()
+		for i := c.cursor; i < len(c.received); i++ {
+			if match(c.received[i]) {
+				c.cursor = i + 1
+				c.lock.Unlock()
+				return c.received[i], nil
+			}
+		}
+		notify := c.notify
+		c.lock.Unlock()
+
+		select {
+		case <-notify:
+		case <-c.closed:
+			return nil, ErrClientClosed
+		case <-deadline:
+			return nil, ErrTimeout
+		}
+	}
+}
+
+// Expect returns the next message with the command received
+// from the client
+func (c *Client) Expect(command string, timeout time.Duration) (*msg.Message, error) {
+	return c.Wait(func(message *msg.Message) bool {
+		return strings.EqualFold(message.Command, command)
+	}, timeout)
+}
@@ -0,0 +1,12 @@
+package mockd
+
+import "errors"
+
+var (
+	// ErrTimeout occurs when the expected line or client
+	// did not arrive in time
+	ErrTimeout = errors.New("mockd: Timed out waiting for the client")
+	// ErrClientClosed occurs when waiting for a line from
+	// a client that has disconnected
+	ErrClientClosed = errors.New("mockd: Client has disconnected")
+)
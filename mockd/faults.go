@@ -0,0 +1,94 @@
+package mockd
+
+import (
+	"time"
+
+	"github.com/jriddick/geoffrey/msg"
+)
+
+// Refuse makes the server close every new connection right
+// after accepting it until it is called with false
+func (m *Mockd) Refuse(refuse bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.refuse = refuse
+}
+
+// refusing returns true if new connections are refused
+func (m *Mockd) refusing() bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.refuse
+}
+
+// KLine bans the mask from the server. Matching clients are
+// disconnected and new clients matching it are disconnected
+// when they try to register.
+func (m *Mockd) KLine(mask, reason string) {
+	m.lock.Lock()
+	m.klines[mask] = reason
+
+	var banned []*Client
+	for client := range m.clients {
+		if _, ok := m.klined(client); ok && client.registered {
+			banned = append(banned, client)
+		}
+	}
+	m.lock.Unlock()
+
+	for _, client := range banned {
+		m.lock.Lock()
+		m.reply(client, "465", "You are banned from this server- "+reason)
+		m.lock.Unlock()
+
+		client.Kill("K-Lined")
+	}
+}
+
+// UnKLine removes the ban on the mask
+func (m *Mockd) UnKLine(mask string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	delete(m.klines, mask)
+}
+
+// klined returns the reason if the client matches a K-line
+func (m *Mockd) klined(client *Client) (string, bool) {
+	for raw, reason := range m.klines {
+		mask, err := msg.ParseMask(raw, msg.RFC1459)
+		if err == nil && mask.Match(client.prefix(), "") {
+			return reason, true
+		}
+	}
+
+	return "", false
+}
+
+// Kill sends the ERROR line to the client before closing
+// the connection as if the server closed the link
+func (c *Client) Kill(reason string) {
+	c.Send("ERROR :Closing Link: " + c.host + " (" + reason + ")")
+	c.server.disconnect(c, reason)
+}
+
+// Freeze makes the connection half-open. The connection is
+// kept but nothing is sent to or read from the client until
+// it is closed, so it will eventually time out.
+func (c *Client) Freeze() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.frozen = true
+}
+
+// SetDelay makes the server wait before every line sent to
+// the client to simulate a slow connection
+func (c *Client) SetDelay(delay time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.delay = delay
+}
@@ -2,27 +2,99 @@ package mockd
 
 import (
 	"bufio"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"net"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/jriddick/geoffrey/msg"
 )
 
+// DefaultISupport are the tokens advertised by default
+var DefaultISupport = []string{
+	"CASEMAPPING=rfc1459",
+	"CHANTYPES=#&",
+	"CHANMODES=bq,k,l,imnrt",
+	"PREFIX=(ov)@+",
+	"MODES=3",
+	"NICKLEN=30",
+	"NETWORK=Geoffrey",
+}
+
 // Mockd is a mocked IRC server
 type Mockd struct {
 	Port     int
 	Listener net.Listener
 	Close    chan bool
 	sync.WaitGroup
+
+	// Name is the name of the server used as prefix
+	Name string
+	// ISupport are the tokens sent after registration
+	ISupport []string
+	// Motd are the lines of the message of the day
+	Motd []string
+	// PingInterval is how long a client may be idle before it
+	// is pinged and PingTimeout how long it has to reply. Zero
+	// disables the pings.
+	PingInterval time.Duration
+	PingTimeout  time.Duration
+
+	// Secure makes Listen open a TLS listener using TLSConfig
+	// or a generated self-signed certificate
+	Secure    bool
+	TLSConfig *tls.Config
+	// ClientAuth asks the clients for certificates, which are
+	// verified against ClientCAs when it has been set
+	ClientAuth tls.ClientAuthType
+	ClientCAs  *x509.CertPool
+
+	// Capabilities are advertised in CAP LS with their values
+	Capabilities map[string]string
+	// Accounts maps the SASL PLAIN accounts to their passwords
+	// and Fingerprints maps the certificate fingerprints to the
+	// accounts used with SASL EXTERNAL
+	Accounts     map[string]string
+	Fingerprints map[string]string
+
+	lock        sync.Mutex
+	certificate *x509.Certificate
+	clients     map[*Client]bool
+	nicks       map[string]*Client
+	channels    map[string]*channel
+	changed     chan struct{}
+	klines      map[string]string
+	refuse      bool
+	passive     bool
 }
 
 // NewMockd takes a port and returns
-// a new Mockd object.
+// a new Mockd object. Port zero picks
+// a free port when listening.
 func NewMockd(port int) *Mockd {
+	capabilities := make(map[string]string)
+	for name, value := range DefaultCapabilities {
+		capabilities[name] = value
+	}
+
 	return &Mockd{
-		Port:  port,
-		Close: make(chan bool),
+		Port:         port,
+		Close:        make(chan bool),
+		Name:         "geoffrey.com",
+		ISupport:     DefaultISupport,
+		Motd:         []string{"Welcome to the mocked Geoffrey IRC server"},
+		Capabilities: capabilities,
+		Accounts:     make(map[string]string),
+		Fingerprints: make(map[string]string),
+		clients:      make(map[*Client]bool),
+		nicks:        make(map[string]*Client),
+		channels:     make(map[string]*channel),
+		changed:      make(chan struct{}),
+		klines:       make(map[string]string),
 	}
 }
 
@@ -34,7 +106,19 @@ func (m *Mockd) Listen() error {
 		return err
 	}
 
+	// Wrap the listener when running securely
+	if m.Secure {
+		config, err := m.tlsConfig()
+		if err != nil {
+			listener.Close()
+			return err
+		}
+
+		listener = tls.NewListener(listener, config)
+	}
+
 	m.Listener = listener
+	m.Port = listener.Addr().(*net.TCPAddr).Port
 	return nil
 }
 
@@ -48,6 +132,7 @@ func (m *Mockd) Handle() {
 	for {
 		select {
 		case conn := <-conns:
+			m.Add(1)
 			go m.handleClient(conn)
 		case <-m.Close:
 			return
@@ -59,62 +144,503 @@ func (m *Mockd) Handle() {
 func (m *Mockd) Stop() (err error) {
 	close(m.Close)
 	err = m.Listener.Close()
+
+	m.lock.Lock()
+	for client := range m.clients {
+		client.Close()
+	}
+	m.lock.Unlock()
+
 	m.Wait()
 	return
 }
 
-func (m *Mockd) handleClient(client net.Conn) {
-	m.Add(1)
+// Clients returns the registered clients sorted by nick
+func (m *Mockd) Clients() []*Client {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var clients []*Client
+	for client := range m.clients {
+		if client.registered {
+			clients = append(clients, client)
+		}
+	}
+
+	sort.Slice(clients, func(i, j int) bool {
+		return fold(clients[i].nick) < fold(clients[j].nick)
+	})
+
+	return clients
+}
+
+// WaitClient returns the client once it has registered
+// with the nick
+func (m *Mockd) WaitClient(nick string, timeout time.Duration) (*Client, error) {
+	deadline := time.After(timeout)
+
+	for {
+		// The client registers while holding the lock
+		m.lock.Lock()
+		client, ok := m.nicks[fold(nick)]
+		ok = ok && client.registered
+		changed := m.changed
+		m.lock.Unlock()
+
+		if ok {
+			return client, nil
+		}
+
+		select {
+		case <-changed:
+		case <-deadline:
+			return nil, ErrTimeout
+		}
+	}
+}
+
+// Inject sends the raw line to every registered client
+func (m *Mockd) Inject(line string) {
+	for _, client := range m.Clients() {
+		client.Send(line)
+	}
+}
+
+// fold returns the nick or channel in lowercase
+func fold(name string) string {
+	return msg.RFC1459.Fold(name)
+}
+
+// reply sends the numeric reply from the server to the client
+// where the last parameter is always sent as trailing
+func (m *Mockd) reply(client *Client, numeric string, params ...string) {
+	message := &msg.Message{
+		Prefix:  &msg.Prefix{Name: m.Name},
+		Command: numeric,
+		Params:  append([]string{client.target()}, params...),
+	}
+
+	if len(params) > 0 {
+		message.Params = message.Params[:len(message.Params)-1]
+		message.Trailing = params[len(params)-1]
+		message.EmptyTrailing = message.Trailing == ""
+	}
+
+	client.send(message)
+}
+
+func (m *Mockd) handleClient(conn net.Conn) {
 	defer m.Done()
 
-	// Create reader and writer
-	reader := bufio.NewReader(client)
+	client := newClient(m, conn)
+
+	m.lock.Lock()
+	m.clients[client] = true
+	m.wake()
+	m.lock.Unlock()
+
+	defer m.disconnect(client, "Connection closed")
 
-	// User registration status
-	var userReceived bool
-	var nickReceived bool
+	// Passive servers only record what the client sends
+	if !m.passive {
+		// Write opening string
+		client.Send(":geoffrey.com NOTICE Auth :*** Looking up your hostname...")
 
-	// Write opening string
-	client.Write([]byte(":geoffrey.com NOTICE Auth :*** Looking up your hostname...\r\n"))
+		// Ping the client when it is idle
+		if m.PingInterval > 0 {
+			go m.pinger(client)
+		}
+	}
+
+	reader := bufio.NewReader(conn)
+	for {
+		// Read and parse the message
+		raw, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		message, err := msg.ParseMessage(raw)
+		if err != nil {
+			continue
+		}
+
+		if !client.record(message) || m.passive {
+			continue
+		}
+
+		if !m.handle(client, message) {
+			return
+		}
+	}
+}
+
+// pinger pings the client when it is idle and disconnects it
+// if it does not reply in time
+func (m *Mockd) pinger(client *Client) {
+	timeout := m.PingTimeout
+	if timeout <= 0 {
+		timeout = m.PingInterval
+	}
 
 	for {
 		select {
-		case <-m.Close:
-			client.Close()
+		case <-client.closed:
 			return
-		default:
-			// Read and parse the message
-			raw, _ := reader.ReadString('\n')
-			msg, _ := msg.ParseMessage(raw)
-
-			if msg != nil {
-				// Check if valid NICK command
-				if msg.Command == "NICK" {
-					nickReceived = true
-				}
+		case <-time.After(m.PingInterval):
+		}
 
-				// Check if valid USER command
-				if msg.Command == "USER" {
-					userReceived = true
-				}
+		if client.idle() < m.PingInterval {
+			continue
+		}
 
-				if userReceived && nickReceived {
-					// Send the registration message
-					client.Write([]byte(":geoffrey.com 001 Geoffrey :Welcome to the Geoffrey IRC Network!\r\n"))
+		pinged := time.Now()
+		client.Send("PING :" + m.Name)
 
-					// Unset the status
-					nickReceived = false
-					userReceived = false
-				}
+		select {
+		case <-client.closed:
+			return
+		case <-time.After(timeout):
+		}
 
-				if msg.Command != "NICK" && msg.Command != "USER" {
-					client.Write([]byte(fmt.Sprintf("%s\r\n", raw)))
-				}
+		// Nothing has been received since the ping
+		if client.idle() >= time.Since(pinged) {
+			client.Kill("Ping timeout")
+			return
+		}
+	}
+}
+
+// disconnect removes the client from the server and its
+// channels and tells everyone sharing a channel with it
+func (m *Mockd) disconnect(client *Client, reason string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if !m.clients[client] {
+		return
+	}
+	delete(m.clients, client)
+
+	if client.registered {
+		m.broadcastPeers(client, &msg.Message{
+			Prefix:   client.prefix(),
+			Command:  "QUIT",
+			Trailing: reason,
+		})
+
+		for key, channel := range m.channels {
+			channel.remove(client)
+			if len(channel.members) == 0 {
+				delete(m.channels, key)
+			}
+		}
+	}
+
+	if m.nicks[fold(client.nick)] == client {
+		delete(m.nicks, fold(client.nick))
+	}
+
+	client.Close()
+}
+
+// broadcastPeers sends the message to everyone sharing a
+// channel with the client, but not the client itself
+func (m *Mockd) broadcastPeers(client *Client, message *msg.Message) {
+	peers := make(map[*Client]bool)
+	for _, channel := range m.channels {
+		if channel.member(client) == nil {
+			continue
+		}
+
+		for _, member := range channel.members {
+			if member.client != client {
+				peers[member.client] = true
+			}
+		}
+	}
+
+	for peer := range peers {
+		peer.send(message)
+	}
+}
+
+// handle runs the command sent by the client and returns
+// false when the client should be disconnected
+func (m *Mockd) handle(client *Client, message *msg.Message) bool {
+	command := strings.ToUpper(message.Command)
+	params := message.AllParams()
+
+	switch command {
+	case "QUIT":
+		client.Kill("Quit: " + message.LastParam())
+		return false
+	case "PING":
+		client.send(&msg.Message{
+			Prefix:   &msg.Prefix{Name: m.Name},
+			Command:  "PONG",
+			Params:   []string{m.Name},
+			Trailing: message.LastParam(),
+		})
+		return true
+	case "PONG":
+		return true
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	switch command {
+	case "NICK":
+		m.nick(client, params)
+		return true
+	case "USER":
+		m.user(client, params)
+		return true
+	case "CAP":
+		m.capability(client, params)
+		return true
+	case "AUTHENTICATE":
+		m.authenticate(client, params)
+		return true
+	}
+
+	if !client.registered {
+		m.reply(client, "451", "You have not registered")
+		return true
+	}
+
+	switch command {
+	case "JOIN":
+		m.join(client, params)
+	case "PART":
+		m.part(client, params)
+	case "PRIVMSG", "NOTICE":
+		m.privmsg(client, command, params)
+	case "NAMES":
+		m.names(client, params)
+	case "TOPIC":
+		m.topic(client, params)
+	case "MODE":
+		m.mode(client, params)
+	case "KICK":
+		m.kick(client, params)
+	case "INVITE":
+		m.invite(client, params)
+	case "WHO":
+		m.who(client, params)
+	case "WHOIS":
+		m.whois(client, params)
+	default:
+		m.reply(client, "421", message.Command, "Unknown command")
+	}
+
+	return true
+}
+
+// nick sets or changes the nick of the client
+func (m *Mockd) nick(client *Client, params []string) {
+	if len(params) == 0 || params[0] == "" {
+		m.reply(client, "431", "No nickname given")
+		return
+	}
+
+	nick := params[0]
+	if strings.ContainsAny(nick[:1], "#&:0123456789") || strings.ContainsAny(nick, " ,*?!@") {
+		m.reply(client, "432", nick, "Erroneous nickname")
+		return
+	}
+
+	if other, ok := m.nicks[fold(nick)]; ok && other != client {
+		m.reply(client, "433", nick, "Nickname is already in use")
+		return
+	}
+
+	if client.registered {
+		change := &msg.Message{
+			Prefix:  client.prefix(),
+			Command: "NICK",
+			Params:  []string{nick},
+		}
+
+		client.send(change)
+		m.broadcastPeers(client, change)
+	}
+
+	delete(m.nicks, fold(client.nick))
+	client.nick = nick
+	m.nicks[fold(nick)] = client
+
+	m.register(client)
+}
+
+// user sets the user and realname of the client
+func (m *Mockd) user(client *Client, params []string) {
+	if client.registered {
+		m.reply(client, "462", "You may not reregister")
+		return
+	}
+
+	if len(params) < 4 {
+		m.reply(client, "461", "USER", "Not enough parameters")
+		return
+	}
+
+	client.user = params[0]
+	client.realname = params[3]
+
+	m.register(client)
+}
+
+// register welcomes the client once it has sent both NICK
+// and USER
+func (m *Mockd) register(client *Client) {
+	if client.registered || client.negotiating || client.nick == "" || client.user == "" {
+		return
+	}
+
+	// Banned clients are disconnected instead
+	if reason, ok := m.klined(client); ok {
+		m.reply(client, "465", "You are banned from this server- "+reason)
+		client.Send("ERROR :Closing Link: " + client.host + " (K-Lined)")
+		client.Close()
+		return
+	}
+
+	client.registered = true
+
+	m.reply(client, "001", "Welcome to the Geoffrey IRC Network!")
+	m.reply(client, "002", "Your host is "+m.Name+", running mockd")
+	m.reply(client, "003", "This server was created for testing")
+	m.reply(client, "004", m.Name, "mockd", "io", "bklmnoqrtv")
+
+	// Send at most 13 tokens per line
+	for tokens := m.ISupport; len(tokens) > 0; {
+		n := len(tokens)
+		if n > 13 {
+			n = 13
+		}
 
+		m.reply(client, "005", append(append([]string(nil), tokens[:n]...), "are supported by this server")...)
+		tokens = tokens[n:]
+	}
+
+	if len(m.Motd) == 0 {
+		m.reply(client, "422", "MOTD File is missing")
+	} else {
+		m.reply(client, "375", "- "+m.Name+" Message of the day -")
+		for _, line := range m.Motd {
+			m.reply(client, "372", "- "+line)
+		}
+		m.reply(client, "376", "End of /MOTD command.")
+	}
+
+	m.wake()
+}
+
+// wake wakes up everyone waiting for a client
+func (m *Mockd) wake() {
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
+
+// privmsg delivers the message to the channel or the nick
+func (m *Mockd) privmsg(client *Client, command string, params []string) {
+	if len(params) < 2 || params[1] == "" {
+		if command == "PRIVMSG" {
+			m.reply(client, "412", "No text to send")
+		}
+		return
+	}
+
+	for _, target := range strings.Split(params[0], ",") {
+		message := &msg.Message{
+			Prefix:        client.prefix(),
+			Command:       command,
+			Params:        []string{target},
+			Trailing:      params[1],
+			EmptyTrailing: params[1] == "",
+		}
+
+		if channel, ok := m.channels[fold(target)]; ok {
+			if !channel.canSend(client) {
+				if command == "PRIVMSG" {
+					m.reply(client, "404", target, "Cannot send to channel")
+				}
 				continue
 			}
+
+			channel.broadcast(message, client)
+			continue
+		}
+
+		if other, ok := m.nicks[fold(target)]; ok && other.registered {
+			other.send(message)
+			continue
+		}
+
+		if command == "PRIVMSG" {
+			m.reply(client, "401", target, "No such nick/channel")
+		}
+	}
+}
+
+// who replies with the users in the channel or with the nick
+func (m *Mockd) who(client *Client, params []string) {
+	mask := "*"
+	if len(params) > 0 {
+		mask = params[0]
+	}
+
+	reply := func(channel string, other *Client, flags string) {
+		m.reply(client, "352", channel, other.user, other.host, m.Name, other.nick, "H"+flags, "0 "+other.realname)
+	}
+
+	if channel, ok := m.channels[fold(mask)]; ok {
+		for _, member := range channel.sorted() {
+			reply(channel.name, member.client, member.prefix())
 		}
+	} else if other, ok := m.nicks[fold(mask)]; ok {
+		reply("*", other, "")
 	}
+
+	m.reply(client, "315", mask, "End of /WHO list.")
+}
+
+// whois replies with the details of the nick
+func (m *Mockd) whois(client *Client, params []string) {
+	if len(params) == 0 {
+		m.reply(client, "431", "No nickname given")
+		return
+	}
+
+	nick := params[len(params)-1]
+	other, ok := m.nicks[fold(nick)]
+	if !ok {
+		m.reply(client, "401", nick, "No such nick/channel")
+		m.reply(client, "318", nick, "End of /WHOIS list.")
+		return
+	}
+
+	m.reply(client, "311", other.nick, other.user, other.host, "*", other.realname)
+
+	var channels []string
+	for _, channel := range m.channels {
+		if member := channel.member(other); member != nil {
+			channels = append(channels, member.prefix()+channel.name)
+		}
+	}
+	sort.Strings(channels)
+
+	if len(channels) > 0 {
+		m.reply(client, "319", other.nick, strings.Join(channels, " "))
+	}
+
+	m.reply(client, "312", other.nick, m.Name, "Geoffrey mocked server")
+	if other.account != "" {
+		m.reply(client, "330", other.nick, other.account, "is logged in as")
+	}
+	m.reply(client, "318", other.nick, "End of /WHOIS list.")
 }
 
 func (m *Mockd) acceptClientConnections() chan net.Conn {
@@ -122,10 +648,21 @@ func (m *Mockd) acceptClientConnections() chan net.Conn {
 	go func(conns chan net.Conn, m *Mockd) {
 		for {
 			client, err := m.Listener.Accept()
-			if err != nil || client == nil {
+			if err != nil {
+				return
+			}
+
+			if m.refusing() {
+				client.Close()
 				continue
 			}
-			conns <- client
+
+			select {
+			case conns <- client:
+			case <-m.Close:
+				client.Close()
+				return
+			}
 		}
 	}(conns, m)
 	return conns
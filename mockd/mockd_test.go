@@ -1,18 +1,22 @@
 package mockd
 
 import (
+	"fmt"
 	"net"
+	"strings"
 	"testing"
+	"time"
 
 	"bufio"
 
+	"github.com/jriddick/geoffrey/msg"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
 func TestMockdServer(t *testing.T) {
 	Convey("With default Mockd server", t, func() {
 		// Create the server
-		mockd := NewMockd(5000)
+		mockd := NewMockd(0)
 
 		// Should never be nil
 		So(mockd, ShouldNotBeNil)
@@ -25,7 +29,7 @@ func TestMockdServer(t *testing.T) {
 
 		Convey("It should be able to accept connection", func() {
 			// Open connection to mockd
-			conn, err := net.Dial("tcp", "127.0.0.1:5000")
+			conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", mockd.Port))
 
 			// We should be connected
 			So(err, ShouldBeNil)
@@ -42,7 +46,7 @@ func TestMockdServer(t *testing.T) {
 
 		Convey("It should be able to handle registration", func() {
 			// Open connection to mockd
-			conn, err := net.Dial("tcp", "127.0.0.1:5000")
+			conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", mockd.Port))
 
 			// We should be connected
 			So(err, ShouldBeNil)
@@ -67,12 +71,12 @@ func TestMockdServer(t *testing.T) {
 			msg, err := reader.ReadString('\n')
 
 			So(err, ShouldBeNil)
-			So(msg, ShouldEqual, ":geoffrey.com 001 Geoffrey :Welcome to the Geoffrey IRC Network!\r\n")
+			So(msg, ShouldEqual, ":geoffrey.com 001 mockd :Welcome to the Geoffrey IRC Network!\r\n")
 		})
 
-		Convey("It should be able to echo anything it receives", func() {
+		Convey("It should reject commands before registration", func() {
 			// Open connection to mockd
-			conn, err := net.Dial("tcp", "127.0.0.1:5000")
+			conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", mockd.Port))
 
 			// We should be connected
 			So(err, ShouldBeNil)
@@ -86,15 +90,15 @@ func TestMockdServer(t *testing.T) {
 			So(err, ShouldBeNil)
 
 			// Send a message
-			_, err = conn.Write([]byte(":geoffrey.com 001 Geoffrey :Welcome to the Geoffrey IRC Network!\r\n"))
+			_, err = conn.Write([]byte("JOIN #geoffrey\r\n"))
 
 			So(err, ShouldBeNil)
 
-			// Read back the same message
+			// Read the rejection
 			msg, err := reader.ReadString('\n')
 
 			So(err, ShouldBeNil)
-			So(msg, ShouldEqual, ":geoffrey.com 001 Geoffrey :Welcome to the Geoffrey IRC Network!\r\n")
+			So(msg, ShouldEqual, ":geoffrey.com 451 * :You have not registered\r\n")
 		})
 
 		Reset(func() {
@@ -102,3 +106,180 @@ func TestMockdServer(t *testing.T) {
 		})
 	})
 }
+
+// testConn is a registered connection used by the tests
+type testConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// dial connects and registers with the nick
+func dial(mockd *Mockd, nick string) *testConn {
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", mockd.Port))
+	So(err, ShouldBeNil)
+
+	c := &testConn{Conn: conn, reader: bufio.NewReader(conn)}
+	c.send("NICK " + nick)
+	c.send("USER " + nick + " * 0 :" + nick)
+	c.expect("376")
+
+	return c
+}
+
+// send writes the line to the server
+func (c *testConn) send(line string) {
+	_, err := c.Write([]byte(line + "\r\n"))
+	So(err, ShouldBeNil)
+}
+
+// expect reads until the command and returns the message
+func (c *testConn) expect(command string) *msg.Message {
+	c.SetReadDeadline(time.Now().Add(time.Second))
+
+	for {
+		raw, err := c.reader.ReadString('\n')
+		So(err, ShouldBeNil)
+
+		message, err := msg.ParseMessage(raw)
+		So(err, ShouldBeNil)
+
+		if message.Command == command {
+			return message
+		}
+	}
+}
+
+func TestMockdChannels(t *testing.T) {
+	Convey("With a Mockd server and two clients", t, func() {
+		mockd := NewMockd(0)
+		mockd.ISupport = []string{"NETWORK=Mocked"}
+		So(mockd.Listen(), ShouldBeNil)
+		go mockd.Handle()
+
+		alice := dial(mockd, "alice")
+		bob := dial(mockd, "bob")
+
+		alice.send("JOIN #geoffrey")
+		So(alice.expect("366").Params, ShouldResemble, []string{"alice", "#geoffrey"})
+
+		bob.send("JOIN #geoffrey")
+		So(bob.expect("353").Trailing, ShouldEqual, "@alice bob")
+		So(alice.expect("JOIN").Prefix.Name, ShouldEqual, "bob")
+
+		Convey("It should advertise the configured tokens", func() {
+			conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", mockd.Port))
+			So(err, ShouldBeNil)
+			defer conn.Close()
+
+			carol := &testConn{Conn: conn, reader: bufio.NewReader(conn)}
+			carol.send("NICK carol")
+			carol.send("USER carol * 0 :carol")
+			So(carol.expect("005").Params, ShouldResemble, []string{"carol", "NETWORK=Mocked"})
+		})
+
+		Convey("It should find the registered clients", func() {
+			client, err := mockd.WaitClient("ALICE", time.Second)
+			So(err, ShouldBeNil)
+			So(client.Nick(), ShouldEqual, "alice")
+			So(mockd.Clients(), ShouldHaveLength, 2)
+		})
+
+		Convey("It should broadcast channel messages", func() {
+			bob.send("PRIVMSG #geoffrey :hello")
+
+			message := alice.expect("PRIVMSG")
+			So(message.Prefix.Name, ShouldEqual, "bob")
+			So(message.Trailing, ShouldEqual, "hello")
+		})
+
+		Convey("It should enforce the channel modes", func() {
+			bob.send("MODE #geoffrey +m")
+			So(bob.expect("482").Params, ShouldResemble, []string{"bob", "#geoffrey"})
+
+			alice.send("MODE #geoffrey +mb *!*@spam")
+			So(bob.expect("MODE").Params, ShouldResemble, []string{"#geoffrey", "+mb", "*!*@spam"})
+
+			bob.send("PRIVMSG #geoffrey :hello")
+			So(bob.expect("404").Params, ShouldResemble, []string{"bob", "#geoffrey"})
+
+			channel, ok := mockd.Channel("#GEOFFREY")
+			So(ok, ShouldBeTrue)
+			So(channel.Modes, ShouldEqual, "mnt")
+			So(channel.Bans, ShouldResemble, []string{"*!*@spam"})
+			So(channel.Members, ShouldResemble, map[string]string{"alice": "@", "bob": ""})
+		})
+
+		Convey("It should set the topic and kick members", func() {
+			alice.send("TOPIC #geoffrey :Welcome")
+			So(bob.expect("TOPIC").Trailing, ShouldEqual, "Welcome")
+
+			alice.send("KICK #geoffrey bob :Bye")
+			kick := bob.expect("KICK")
+			So(kick.Params, ShouldResemble, []string{"#geoffrey", "bob"})
+			So(kick.Trailing, ShouldEqual, "Bye")
+
+			alice.send("NAMES #geoffrey")
+			So(alice.expect("353").Trailing, ShouldEqual, "@alice")
+		})
+
+		Convey("It should tell the channel when a client quits", func() {
+			bob.send("QUIT :Leaving")
+
+			quit := alice.expect("QUIT")
+			So(quit.Prefix.Name, ShouldEqual, "bob")
+			So(quit.Trailing, ShouldEqual, "Quit: Leaving")
+		})
+
+		Convey("It should inject lines and record received lines", func() {
+			client, err := mockd.WaitClient("bob", time.Second)
+			So(err, ShouldBeNil)
+
+			mockd.Inject(":geoffrey.com NOTICE * :Server restarting")
+			So(alice.expect("NOTICE").Trailing, ShouldEqual, "Server restarting")
+
+			bob.send("PRIVMSG alice :one")
+			bob.send("PRIVMSG alice :two")
+
+			message, err := client.Wait(func(message *msg.Message) bool {
+				return strings.HasPrefix(message.Trailing, "t")
+			}, time.Second)
+			So(err, ShouldBeNil)
+			So(message.Trailing, ShouldEqual, "two")
+
+			_, err = client.Expect("PRIVMSG", 10*time.Millisecond)
+			So(err, ShouldEqual, ErrTimeout)
+		})
+
+		Reset(func() {
+			alice.Close()
+			bob.Close()
+			So(mockd.Stop(), ShouldBeNil)
+		})
+	})
+
+	Convey("With a Mockd server pinging idle clients", t, func() {
+		mockd := NewMockd(0)
+		mockd.PingInterval = 20 * time.Millisecond
+		mockd.PingTimeout = 20 * time.Millisecond
+		So(mockd.Listen(), ShouldBeNil)
+		go mockd.Handle()
+
+		client := dial(mockd, "idle")
+
+		Convey("It should disconnect clients that do not reply", func() {
+			So(client.expect("PING").Trailing, ShouldEqual, "geoffrey.com")
+			So(client.expect("ERROR").Trailing, ShouldEqual, "Closing Link: 127.0.0.1 (Ping timeout)")
+		})
+
+		Convey("It should keep clients that reply", func() {
+			So(client.expect("PING"), ShouldNotBeNil)
+			client.send("PONG :geoffrey.com")
+			So(client.expect("PING"), ShouldNotBeNil)
+		})
+
+		Reset(func() {
+			client.Close()
+			So(mockd.Stop(), ShouldBeNil)
+		})
+	})
+}
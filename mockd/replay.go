@@ -0,0 +1,209 @@
+package mockd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jriddick/geoffrey/msg"
+	"github.com/jriddick/geoffrey/transcript"
+)
+
+// Replayer is a passive server replaying a transcript. The
+// inbound lines are fed to the client and the lines sent by
+// the client are compared to the outbound lines.
+type Replayer struct {
+	*Mockd
+
+	// Entries is the transcript to replay
+	Entries []transcript.Entry
+	// Timeout is how long to wait for the client to connect
+	// and for the outbound lines between two inbound lines
+	Timeout time.Duration
+	// Ignore skips the lines that can not be replayed, like
+	// pings carrying the current time
+	Ignore func(*msg.Message) bool
+}
+
+// NewReplayer takes a port and the transcript and returns
+// a new passive server replaying it
+func NewReplayer(port int, entries []transcript.Entry) *Replayer {
+	server := NewMockd(port)
+	server.passive = true
+
+	return &Replayer{
+		Mockd:   server,
+		Entries: entries,
+		Timeout: 5 * time.Second,
+		Ignore:  IgnorePings,
+	}
+}
+
+// IgnorePings ignores the pings sent by the client as they
+// usually carry the current time
+func IgnorePings(message *msg.Message) bool {
+	return strings.EqualFold(message.Command, "PING")
+}
+
+// Line is a line that differs from the transcript
+type Line struct {
+	// Number is the number of the missing entry, or of the
+	// inbound entry that was sent before the unexpected line
+	Number int
+	Text   string
+}
+
+// Diff holds the differences between the lines sent by the
+// client and the outbound lines of the transcript
+type Diff struct {
+	Missing    []Line
+	Unexpected []Line
+}
+
+// Empty returns true if the client sent what was recorded
+func (d *Diff) Empty() bool {
+	return len(d.Missing) == 0 && len(d.Unexpected) == 0
+}
+
+// String returns the missing lines prefixed with '-' and the
+// unexpected lines prefixed with '+'
+func (d *Diff) String() string {
+	var diff strings.Builder
+
+	for _, line := range d.Missing {
+		fmt.Fprintf(&diff, "-%d %s\n", line.Number, line.Text)
+	}
+
+	for _, line := range d.Unexpected {
+		fmt.Fprintf(&diff, "+%d %s\n", line.Number, line.Text)
+	}
+
+	return diff.String()
+}
+
+// expected is an outbound line waiting to be matched
+type expected struct {
+	number int
+	text   string
+}
+
+// Run waits for a client, replays the transcript and returns
+// the differences. The outbound lines between two inbound
+// lines may arrive in any order as handlers run concurrently.
+func (r *Replayer) Run() (*Diff, error) {
+	client, err := r.waitConnection(r.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &Diff{}
+	last := 0
+
+	var pending []expected
+	for i, entry := range r.Entries {
+		switch entry.Direction {
+		case transcript.Inbound:
+			r.match(client, pending, last, diff)
+			pending = nil
+
+			client.Send(entry.Line)
+			last = i + 1
+		case transcript.Outbound:
+			message, err := msg.ParseMessage(entry.Line)
+			if err != nil || r.ignored(message) {
+				continue
+			}
+
+			pending = append(pending, expected{
+				number: i + 1,
+				text:   transcript.Redact(message.String()),
+			})
+		}
+	}
+
+	r.match(client, pending, last, diff)
+
+	// Everything sent after the last line is unexpected
+	for {
+		message, err := client.Wait(anything, 0)
+		if err != nil {
+			break
+		}
+
+		if !r.ignored(message) {
+			diff.Unexpected = append(diff.Unexpected, Line{Number: last, Text: transcript.Redact(message.String())})
+		}
+	}
+
+	return diff, nil
+}
+
+// match waits until the client has sent the pending lines or
+// the timeout passes and records the differences
+func (r *Replayer) match(client *Client, pending []expected, last int, diff *Diff) {
+	deadline := time.Now().Add(r.Timeout)
+
+	for len(pending) > 0 {
+		message, err := client.Wait(anything, time.Until(deadline))
+		if err != nil {
+			break
+		}
+
+		if r.ignored(message) {
+			continue
+		}
+
+		// Transcripts hold the credentials redacted
+		text := transcript.Redact(message.String())
+
+		found := -1
+		for i, line := range pending {
+			if line.text == text {
+				found = i
+				break
+			}
+		}
+
+		if found < 0 {
+			diff.Unexpected = append(diff.Unexpected, Line{Number: last, Text: text})
+			continue
+		}
+
+		pending = append(pending[:found], pending[found+1:]...)
+	}
+
+	for _, line := range pending {
+		diff.Missing = append(diff.Missing, Line{Number: line.number, Text: line.text})
+	}
+}
+
+// anything matches every message
+func anything(*msg.Message) bool {
+	return true
+}
+
+// ignored returns true if the line should not be compared
+func (r *Replayer) ignored(message *msg.Message) bool {
+	return r.Ignore != nil && r.Ignore(message)
+}
+
+// waitConnection returns the first client once it connects
+func (m *Mockd) waitConnection(timeout time.Duration) (*Client, error) {
+	deadline := time.After(timeout)
+
+	for {
+		m.lock.Lock()
+		changed := m.changed
+		for client := range m.clients {
+			m.lock.Unlock()
+			return client, nil
+		}
+		m.lock.Unlock()
+
+		select {
+		case <-changed:
+		case <-deadline:
+			return nil, ErrTimeout
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package mockd
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jriddick/geoffrey/msg"
+	"github.com/jriddick/geoffrey/transcript"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// session is a recorded registration and join
+const session = `
+2019-05-04T12:00:00Z < :geoffrey.com NOTICE Auth :*** Looking up your hostname...
+2019-05-04T12:00:00Z > NICK geoffrey
+2019-05-04T12:00:00Z > USER geoffrey 0 * :Geoffrey
+2019-05-04T12:00:01Z < :geoffrey.com 001 geoffrey :Welcome to the Geoffrey IRC Network!
+2019-05-04T12:00:01Z > JOIN #geoffrey
+2019-05-04T12:00:01Z > PING :1556971201
+2019-05-04T12:00:02Z < PING :geoffrey.com
+2019-05-04T12:00:02Z > PONG :geoffrey.com
+`
+
+// scriptedClient answers the server with the replies in the
+// script until the connection is closed
+func scriptedClient(port int, script map[string][]string) error {
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	for {
+		raw, err := reader.ReadString('\n')
+		if err != nil {
+			return nil
+		}
+
+		message, err := msg.ParseMessage(raw)
+		if err != nil {
+			return err
+		}
+
+		for _, line := range script[message.Command] {
+			if _, err := conn.Write([]byte(line + "\r\n")); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func TestReplayer(t *testing.T) {
+	entries, err := transcript.Read(strings.NewReader(session))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("With a Replayer replaying a session", t, func() {
+		replayer := NewReplayer(0, entries)
+		replayer.Timeout = 200 * time.Millisecond
+		So(replayer.Listen(), ShouldBeNil)
+		go replayer.Handle()
+
+		script := map[string][]string{
+			"NOTICE": {"USER geoffrey 0 * :Geoffrey", "NICK geoffrey"},
+			"001":    {"JOIN #geoffrey"},
+			"PING":   {"PONG :geoffrey.com"},
+		}
+
+		Convey("It should report no differences for the same session", func() {
+			go scriptedClient(replayer.Port, script)
+
+			diff, err := replayer.Run()
+			So(err, ShouldBeNil)
+			So(diff.Empty(), ShouldBeTrue)
+			So(diff.String(), ShouldEqual, "")
+		})
+
+		Convey("It should report the missing and unexpected lines", func() {
+			script["001"] = []string{"JOIN #other"}
+			script["PING"] = []string{"PRIVMSG #geoffrey :Hello", "PONG :geoffrey.com"}
+			go scriptedClient(replayer.Port, script)
+
+			diff, err := replayer.Run()
+			So(err, ShouldBeNil)
+			So(diff.Missing, ShouldResemble, []Line{{Number: 5, Text: "JOIN #geoffrey"}})
+			So(diff.Unexpected, ShouldResemble, []Line{
+				{Number: 4, Text: "JOIN #other"},
+				{Number: 7, Text: "PRIVMSG #geoffrey :Hello"},
+			})
+			So(diff.String(), ShouldEqual, "-5 JOIN #geoffrey\n+4 JOIN #other\n+7 PRIVMSG #geoffrey :Hello\n")
+		})
+
+		Convey("It should time out without a client", func() {
+			_, err := replayer.Run()
+			So(err, ShouldEqual, ErrTimeout)
+		})
+
+		Reset(func() {
+			So(replayer.Stop(), ShouldBeNil)
+		})
+	})
+}
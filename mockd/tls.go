@@ -0,0 +1,116 @@
+package mockd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"math/big"
+	"net"
+	"time"
+)
+
+// SelfSigned generates a self-signed certificate for the name,
+// which is also valid for localhost when used by a server
+func SelfSigned(name string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{name, "localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
+
+// Fingerprint returns the SHA-256 fingerprint of the
+// certificate in lowercase hex as used by SASL EXTERNAL
+func Fingerprint(certificate *x509.Certificate) string {
+	sum := sha256.Sum256(certificate.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// tlsConfig returns the configuration used by the listener,
+// generating a certificate when none has been configured
+func (m *Mockd) tlsConfig() (*tls.Config, error) {
+	config := m.TLSConfig
+	if config == nil {
+		certificate, err := SelfSigned(m.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		config = &tls.Config{
+			Certificates: []tls.Certificate{certificate},
+			ClientAuth:   m.ClientAuth,
+			ClientCAs:    m.ClientCAs,
+		}
+	}
+
+	if len(config.Certificates) > 0 {
+		m.certificate = config.Certificates[0].Leaf
+	}
+
+	return config, nil
+}
+
+// RootCAs returns the pool that clients can use to verify
+// the certificate of the server
+func (m *Mockd) RootCAs() *x509.CertPool {
+	pool := x509.NewCertPool()
+	if m.certificate != nil {
+		pool.AddCert(m.certificate)
+	}
+
+	return pool
+}
+
+// peerFingerprint returns the fingerprint of the certificate
+// sent by the client if it connected using TLS
+func (c *Client) peerFingerprint() string {
+	conn, ok := c.conn.(*tls.Conn)
+	if !ok {
+		return ""
+	}
+
+	state := conn.ConnectionState()
+	if len(state.PeerCertificates) == 0 {
+		return ""
+	}
+
+	return Fingerprint(state.PeerCertificates[0])
+}
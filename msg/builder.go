@@ -0,0 +1,212 @@
+package msg
+
+import "strconv"
+
+// Builder constructs messages parameter by parameter and
+// validates the result when the message is built.
+//
+//	message, err := msg.Build("PRIVMSG").
+//		Tag("+draft/reply", id).
+//		Param("#channel").
+//		Trailing(text).
+//		Message()
+type Builder struct {
+	message Message
+}
+
+// Build returns a new builder for the command
+func Build(command string) *Builder {
+	return &Builder{
+		message: Message{
+			Command: command,
+		},
+	}
+}
+
+// Tag adds the tag to the message
+func (b *Builder) Tag(key, value string) *Builder {
+	if b.message.Tags == nil {
+		b.message.Tags = make(Tags)
+	}
+
+	b.message.Tags[key] = value
+	return b
+}
+
+// Prefix sets the prefix of the message
+func (b *Builder) Prefix(name, user, host string) *Builder {
+	b.message.Prefix = &Prefix{
+		Name: name,
+		User: user,
+		Host: host,
+	}
+	return b
+}
+
+// Param adds a middle parameter to the message
+func (b *Builder) Param(param string) *Builder {
+	b.message.Params = append(b.message.Params, param)
+	return b
+}
+
+// Params adds middle parameters to the message
+func (b *Builder) Params(params ...string) *Builder {
+	b.message.Params = append(b.message.Params, params...)
+	return b
+}
+
+// Int adds a numeric middle parameter to the message
+func (b *Builder) Int(param int) *Builder {
+	return b.Param(strconv.Itoa(param))
+}
+
+// Trailing sets the trailing parameter of the message
+func (b *Builder) Trailing(trailing string) *Builder {
+	b.message.Trailing = trailing
+	b.message.EmptyTrailing = trailing == ""
+	return b
+}
+
+// Message validates and returns the built message
+func (b *Builder) Message() (*Message, error) {
+	message := b.message
+
+	// Copy the parameters so the builder can be reused
+	message.Params = append([]string(nil), b.message.Params...)
+	if b.message.Tags != nil {
+		message.Tags = make(Tags, len(b.message.Tags))
+		for key, value := range b.message.Tags {
+			message.Tags[key] = value
+		}
+	}
+
+	if err := message.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &message, nil
+}
+
+// Privmsg returns a PRIVMSG with the text to the target
+func Privmsg(target, text string) *Message {
+	return &Message{
+		Command:       "PRIVMSG",
+		Params:        []string{target},
+		Trailing:      text,
+		EmptyTrailing: text == "",
+	}
+}
+
+// Notice returns a NOTICE with the text to the target
+func Notice(target, text string) *Message {
+	return &Message{
+		Command:       "NOTICE",
+		Params:        []string{target},
+		Trailing:      text,
+		EmptyTrailing: text == "",
+	}
+}
+
+// Join returns a JOIN for the channel with an optional key
+func Join(channel, key string) *Message {
+	message := &Message{
+		Command: "JOIN",
+		Params:  []string{channel},
+	}
+
+	if key != "" {
+		message.Params = append(message.Params, key)
+	}
+
+	return message
+}
+
+// Part returns a PART for the channel with an optional reason
+func Part(channel, reason string) *Message {
+	return &Message{
+		Command:  "PART",
+		Params:   []string{channel},
+		Trailing: reason,
+	}
+}
+
+// Kick returns a KICK of the nick from the channel with an
+// optional reason
+func Kick(channel, nick, reason string) *Message {
+	return &Message{
+		Command:  "KICK",
+		Params:   []string{channel, nick},
+		Trailing: reason,
+	}
+}
+
+// Mode returns a MODE for the target with the mode changes
+// and their parameters
+func Mode(target, modes string, params ...string) *Message {
+	return &Message{
+		Command: "MODE",
+		Params:  append([]string{target, modes}, params...),
+	}
+}
+
+// Topic returns a TOPIC setting the topic of the channel
+// where an empty topic clears it
+func Topic(channel, topic string) *Message {
+	return &Message{
+		Command:       "TOPIC",
+		Params:        []string{channel},
+		Trailing:      topic,
+		EmptyTrailing: topic == "",
+	}
+}
+
+// Invite returns an INVITE of the nick to the channel
+func Invite(nick, channel string) *Message {
+	return &Message{
+		Command: "INVITE",
+		Params:  []string{nick, channel},
+	}
+}
+
+// Nick returns a NICK for the nick
+func Nick(nick string) *Message {
+	return &Message{
+		Command: "NICK",
+		Params:  []string{nick},
+	}
+}
+
+// User returns a USER for the user and real name
+func User(user, name string) *Message {
+	return &Message{
+		Command:       "USER",
+		Params:        []string{user, "0", "*"},
+		Trailing:      name,
+		EmptyTrailing: name == "",
+	}
+}
+
+// Ping returns a PING with the token
+func Ping(token string) *Message {
+	return &Message{
+		Command: "PING",
+		Params:  []string{token},
+	}
+}
+
+// Pong returns a PONG with the token
+func Pong(token string) *Message {
+	return &Message{
+		Command:       "PONG",
+		Trailing:      token,
+		EmptyTrailing: token == "",
+	}
+}
+
+// Quit returns a QUIT with an optional reason
+func Quit(reason string) *Message {
+	return &Message{
+		Command:  "QUIT",
+		Trailing: reason,
+	}
+}
@@ -0,0 +1,111 @@
+package msg_test
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/jriddick/geoffrey/msg"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var ValidateTests = [...]struct {
+	Message *Message
+	Err     error
+}{
+	{&Message{}, ErrMissingCommand},
+	{&Message{Command: "PRIV MSG"}, ErrInvalidCommand},
+	{&Message{Command: "PRIVMSG", Params: []string{"#a b", "text"}}, ErrInvalidParam},
+	{&Message{Command: "PRIVMSG", Params: []string{":#a", "text"}}, ErrInvalidParam},
+	{&Message{Command: "PRIVMSG", Params: []string{"", "text"}}, ErrInvalidParam},
+	{&Message{Command: "PRIVMSG", Params: []string{"#a"}, Trailing: "a\r\nQUIT"}, ErrInvalidCharacter},
+	{&Message{Command: "PRIVMSG", Params: []string{"#a\n", "text"}}, ErrInvalidCharacter},
+	{&Message{Command: "PRIVMSG", Params: []string{"#a", "a\x00b"}}, ErrInvalidCharacter},
+	{&Message{Command: "PRIVMSG", Prefix: &Prefix{Name: "a b"}, Params: []string{"#a"}}, ErrInvalidPrefix},
+	{&Message{Command: "PRIVMSG", Tags: Tags{"a_b": ""}, Params: []string{"#a"}}, ErrInvalidTag},
+	{&Message{Command: "CMD", Params: []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12", "13", "14", "15"}, Trailing: "16"}, ErrTooManyParams},
+}
+
+func TestBuilder(t *testing.T) {
+	Convey("With the message builder", t, func() {
+		Convey("Should build messages with typed params", func() {
+			message, err := Build("PRIVMSG").
+				Tag("+draft/reply", "abc").
+				Prefix("geoffrey", "bot", "host").
+				Param("#channel").
+				Trailing("Hello World").
+				Message()
+
+			So(err, ShouldBeNil)
+			So(message.String(), ShouldEqual, "@+draft/reply=abc :geoffrey!bot@host PRIVMSG #channel :Hello World")
+		})
+
+		Convey("Should build numeric params", func() {
+			message, err := Build("WHO").Param("#channel").Param("%tna").Int(152).Message()
+
+			So(err, ShouldBeNil)
+			So(message.String(), ShouldEqual, "WHO #channel %tna 152")
+		})
+
+		Convey("Should build empty trailing", func() {
+			message, err := Build("TOPIC").Param("#channel").Trailing("").Message()
+
+			So(err, ShouldBeNil)
+			So(message.String(), ShouldEqual, "TOPIC #channel :")
+		})
+
+		Convey("Should reject injected commands", func() {
+			message, err := Build("PRIVMSG").Param("#channel").Trailing("Title\r\nQUIT :bye").Message()
+
+			So(message, ShouldBeNil)
+			So(err, ShouldEqual, ErrInvalidCharacter)
+		})
+
+		Convey("Should be reusable", func() {
+			builder := Build("PRIVMSG").Param("#channel")
+
+			first, err := builder.Trailing("first").Message()
+			So(err, ShouldBeNil)
+
+			second, err := builder.Trailing("second").Message()
+			So(err, ShouldBeNil)
+
+			So(first.String(), ShouldEqual, "PRIVMSG #channel :first")
+			So(second.String(), ShouldEqual, "PRIVMSG #channel :second")
+		})
+	})
+
+	Convey("With the command helpers", t, func() {
+		So(Privmsg("#channel", "Hello World").String(), ShouldEqual, "PRIVMSG #channel :Hello World")
+		So(Notice("nick", "Hello").String(), ShouldEqual, "NOTICE nick :Hello")
+		So(Join("#channel", "").String(), ShouldEqual, "JOIN #channel")
+		So(Join("#channel", "secret").String(), ShouldEqual, "JOIN #channel secret")
+		So(Part("#channel", "").String(), ShouldEqual, "PART #channel")
+		So(Part("#channel", "bye").String(), ShouldEqual, "PART #channel :bye")
+		So(Kick("#channel", "nick", "").String(), ShouldEqual, "KICK #channel nick")
+		So(Kick("#channel", "nick", "bye").String(), ShouldEqual, "KICK #channel nick :bye")
+		So(Mode("#channel", "+bo", "*!*@host", "nick").String(), ShouldEqual, "MODE #channel +bo *!*@host nick")
+		So(Topic("#channel", "Hello World").String(), ShouldEqual, "TOPIC #channel :Hello World")
+		So(Topic("#channel", "").String(), ShouldEqual, "TOPIC #channel :")
+		So(Invite("nick", "#channel").String(), ShouldEqual, "INVITE nick #channel")
+		So(Nick("geoffrey").String(), ShouldEqual, "NICK geoffrey")
+		So(User("geoffrey", "Geoffrey Bot").String(), ShouldEqual, "USER geoffrey 0 * :Geoffrey Bot")
+		So(Ping("token").String(), ShouldEqual, "PING token")
+		So(Pong("token").String(), ShouldEqual, "PONG :token")
+		So(Quit("Leaving").String(), ShouldEqual, "QUIT :Leaving")
+	})
+
+	Convey("With message validation", t, func() {
+		for i, test := range ValidateTests {
+			test := test
+
+			Convey(fmt.Sprintf("It should reject message %d with %v", i, test.Err), func() {
+				So(test.Message.Validate(), ShouldEqual, test.Err)
+			})
+		}
+
+		Convey("It should accept a last param with spaces", func() {
+			So((&Message{Command: "PRIVMSG", Params: []string{"#a", "b c"}}).Validate(), ShouldBeNil)
+		})
+	})
+}
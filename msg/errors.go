@@ -0,0 +1,74 @@
+package msg
+
+import "errors"
+
+var (
+	// ErrEmpty occurs when the message is empty or
+	// only contains whitespace.
+	ErrEmpty = errors.New("message is empty")
+	// ErrTooLong occurs when the message without tags
+	// exceeds 512 bytes in strict mode or 1024 bytes otherwise.
+	ErrTooLong = errors.New("message is too long")
+	// ErrTagsTooLong occurs when the tags exceed 8191 bytes.
+	ErrTagsTooLong = errors.New("tags are too long")
+	// ErrOnlyTags occurs when the message ends with the tags.
+	ErrOnlyTags = errors.New("message ends with tags")
+	// ErrEmptyTags occurs when the tag field is empty.
+	ErrEmptyTags = errors.New("empty tag field")
+	// ErrOnlyPrefix occurs when the message ends with the prefix.
+	ErrOnlyPrefix = errors.New("message ends with prefix")
+	// ErrEmptyPrefix occurs when the prefix is empty.
+	ErrEmptyPrefix = errors.New("empty prefix")
+	// ErrMissingCommand occurs when the message has no command.
+	ErrMissingCommand = errors.New("message has no command")
+	// ErrInvalidCommand occurs in strict mode when the command
+	// is neither letters nor a three digit numeric.
+	ErrInvalidCommand = errors.New("invalid command")
+	// ErrInvalidCharacter occurs in strict mode or when validating
+	// when the message contains NUL, CR or LF.
+	ErrInvalidCharacter = errors.New("message contains NUL, CR or LF")
+	// ErrInvalidTag occurs in strict mode when a tag key does
+	// not follow the grammar.
+	ErrInvalidTag = errors.New("invalid tag key")
+	// ErrTooManyParams occurs in strict mode when the message
+	// has more than 15 parameters.
+	ErrTooManyParams = errors.New("too many parameters")
+	// ErrInvalidParam occurs when validating a message with a
+	// middle parameter that is empty, contains spaces or starts
+	// with a colon.
+	ErrInvalidParam = errors.New("invalid middle parameter")
+	// ErrInvalidPrefix occurs when validating a message with a
+	// prefix that is empty or contains spaces.
+	ErrInvalidPrefix = errors.New("invalid prefix")
+	// ErrInvalidMask occurs when a hostmask is empty or
+	// has an invalid CIDR or extended ban.
+	ErrInvalidMask = errors.New("invalid mask")
+	// ErrUnknownExtban occurs when an extended ban type
+	// is not supported.
+	ErrUnknownExtban = errors.New("unknown extended ban")
+)
+
+// ParseError is returned when a message could not be parsed.
+// The underlying error is one of the errors above.
+type ParseError struct {
+	Raw string
+	Err error
+}
+
+// parseError creates a new ParseError
+func parseError(raw string, err error) *ParseError {
+	return &ParseError{
+		Raw: raw,
+		Err: err,
+	}
+}
+
+// Error returns the underlying error message
+func (e *ParseError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,459 @@
+package msg
+
+import (
+	"net"
+	"sort"
+	"strings"
+)
+
+// CaseMapping is the casemapping used by the server when
+// comparing nicks and channels.
+type CaseMapping int
+
+const (
+	// RFC1459 folds A-Z and []\~ to a-z and {}|^
+	RFC1459 CaseMapping = iota
+	// StrictRFC1459 folds A-Z and []\ to a-z and {}|
+	StrictRFC1459
+	// ASCII only folds A-Z to a-z
+	ASCII
+)
+
+// ParseCaseMapping returns the casemapping from the name
+// advertised in ISUPPORT. Unknown names are RFC1459.
+func ParseCaseMapping(name string) CaseMapping {
+	switch strings.ToLower(name) {
+	case "ascii":
+		return ASCII
+	case "strict-rfc1459":
+		return StrictRFC1459
+	default:
+		return RFC1459
+	}
+}
+
+// lower returns the lowercase of the byte
+func (c CaseMapping) lower(b byte) byte {
+	switch {
+	case b >= 'A' && b <= 'Z':
+		return b + 'a' - 'A'
+	case c == ASCII:
+		return b
+	case b == '[' || b == ']' || b == '\\':
+		return b + '{' - '['
+	case b == '~' && c == RFC1459:
+		return '^'
+	}
+
+	return b
+}
+
+// Fold returns the text in lowercase using the casemapping
+func (c CaseMapping) Fold(text string) string {
+	for i := 0; i < len(text); i++ {
+		if c.lower(text[i]) == text[i] {
+			continue
+		}
+
+		// Only allocate when something has to be folded
+		buf := []byte(text)
+		for ; i < len(buf); i++ {
+			buf[i] = c.lower(buf[i])
+		}
+
+		return string(buf)
+	}
+
+	return text
+}
+
+// Equal returns true if both texts are equal using the casemapping
+func (c CaseMapping) Equal(a, b string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := 0; i < len(a); i++ {
+		if c.lower(a[i]) != c.lower(b[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// String returns the prefix as 'nick!user@host'
+func (p *Prefix) String() string {
+	prefix := p.Name
+	if p.User != "" {
+		prefix += "!" + p.User
+	}
+	if p.Host != "" {
+		prefix += "@" + p.Host
+	}
+
+	return prefix
+}
+
+// IsServer returns true if the prefix is a server name
+func (p *Prefix) IsServer() bool {
+	return p.User == "" && p.Host == "" && strings.IndexByte(p.Name, '.') > -1
+}
+
+// Glob returns true if the text matches the pattern where
+// '*' matches any number of characters and '?' matches
+// exactly one character, using the casemapping.
+func Glob(pattern, text string, mapping CaseMapping) bool {
+	return glob(mapping.Fold(pattern), mapping.Fold(text))
+}
+
+// glob matches the folded text against the folded pattern
+func glob(pattern, text string) bool {
+	p, t := 0, 0
+	star, next := -1, 0
+
+	for t < len(text) {
+		if p < len(pattern) {
+			switch pattern[p] {
+			case '*':
+				// Remember the star so we can backtrack to it
+				star, next = p, t
+				p++
+				continue
+			case '?', text[t]:
+				p++
+				t++
+				continue
+			}
+		}
+
+		// Let the last star consume one more character
+		if star == -1 {
+			return false
+		}
+
+		next++
+		p, t = star+1, next
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+
+	return p == len(pattern)
+}
+
+// literal returns true if the pattern has no wildcards
+func literal(pattern string) bool {
+	return strings.IndexAny(pattern, "*?") == -1
+}
+
+// NormalizeMask expands the mask to 'nick!user@host' where
+// missing parts are '*'. Extended bans are not changed.
+func NormalizeMask(mask string) string {
+	if strings.HasPrefix(mask, "$") {
+		return mask
+	}
+
+	nick, user, host := mask, "", ""
+
+	if at := strings.LastIndexByte(nick, '@'); at > -1 {
+		nick, host = nick[:at], nick[at+1:]
+	}
+
+	if bang := strings.IndexByte(nick, '!'); bang > -1 {
+		nick, user = nick[:bang], nick[bang+1:]
+	} else if host != "" {
+		// A mask like 'user@host' has no nick
+		nick, user = "", nick
+	}
+
+	if nick == "" {
+		nick = "*"
+	}
+	if user == "" {
+		user = "*"
+	}
+	if host == "" {
+		host = "*"
+	}
+
+	return nick + "!" + user + "@" + host
+}
+
+// Mask is a compiled hostmask. It matches either the
+// prefix as 'nick!user@host' with wildcards and CIDR
+// notation in the host, or an extended ban on the
+// account such as '$a', '$a:account' and '$~a'.
+type Mask struct {
+	raw     string
+	nick    string
+	user    string
+	host    string
+	suffix  string
+	network *net.IPNet
+	extban  byte
+	negate  bool
+	account string
+	mapping CaseMapping
+}
+
+// ParseMask compiles the mask using the casemapping
+func ParseMask(mask string, mapping CaseMapping) (*Mask, error) {
+	mask = strings.TrimSpace(mask)
+	if mask == "" {
+		return nil, ErrInvalidMask
+	}
+
+	m := &Mask{
+		raw:     NormalizeMask(mask),
+		mapping: mapping,
+	}
+
+	// Extended bans
+	if strings.HasPrefix(m.raw, "$") {
+		ban := m.raw[1:]
+
+		if strings.HasPrefix(ban, "~") {
+			m.negate = true
+			ban = ban[1:]
+		}
+
+		if ban == "" {
+			return nil, ErrInvalidMask
+		}
+
+		m.extban = ban[0]
+		if m.extban != 'a' {
+			return nil, ErrUnknownExtban
+		}
+
+		if len(ban) > 1 {
+			if ban[1] != ':' || len(ban) == 2 {
+				return nil, ErrInvalidMask
+			}
+
+			m.account = mapping.Fold(ban[2:])
+		}
+
+		return m, nil
+	}
+
+	folded := mapping.Fold(m.raw)
+	bang := strings.IndexByte(folded, '!')
+	at := strings.LastIndexByte(folded, '@')
+
+	m.nick = folded[:bang]
+	m.user = folded[bang+1 : at]
+	m.host = folded[at+1:]
+
+	// Hosts can be given in CIDR notation
+	if strings.IndexByte(m.host, '/') > -1 {
+		_, network, err := net.ParseCIDR(m.host)
+		if err != nil {
+			return nil, ErrInvalidMask
+		}
+
+		m.network = network
+	}
+
+	// Hosts usually end in a literal domain which rejects
+	// most prefixes before the globs have to be matched
+	m.suffix = m.host[strings.LastIndexAny(m.host, "*?")+1:]
+
+	return m, nil
+}
+
+// String returns the normalized mask
+func (m *Mask) String() string {
+	return m.raw
+}
+
+// Match returns true if the prefix or account matches the
+// mask. The account is empty or '*' if not logged in.
+func (m *Mask) Match(prefix *Prefix, account string) bool {
+	if m.extban != 0 {
+		return m.matchAccount(m.mapping.Fold(account))
+	}
+
+	if prefix == nil {
+		return false
+	}
+
+	return m.matchPrefix(m.mapping.Fold(prefix.Name), m.mapping.Fold(prefix.User), m.mapping.Fold(prefix.Host))
+}
+
+// matchAccount matches the folded account against the extban
+func (m *Mask) matchAccount(account string) bool {
+	matched := account != "" && account != "*"
+	if matched && m.account != "" {
+		matched = glob(m.account, account)
+	}
+
+	return matched != m.negate
+}
+
+// matchPrefix matches the folded prefix parts against the mask
+func (m *Mask) matchPrefix(nick, user, host string) bool {
+	if m.network != nil {
+		ip := net.ParseIP(host)
+		if ip == nil || !m.network.Contains(ip) {
+			return false
+		}
+	} else if !strings.HasSuffix(host, m.suffix) || !glob(m.host, host) {
+		return false
+	}
+
+	return glob(m.nick, nick) && glob(m.user, user)
+}
+
+// MaskSet is a set of compiled masks. Masks with a literal
+// nick or account are indexed so that checking a prefix
+// against thousands of masks only scans the wildcard ones.
+type MaskSet struct {
+	mapping  CaseMapping
+	masks    map[string]*Mask
+	nicks    map[string][]*Mask
+	accounts map[string][]*Mask
+	others   []*Mask
+}
+
+// NewMaskSet creates a set with the masks using the casemapping
+func NewMaskSet(mapping CaseMapping, masks ...string) (*MaskSet, error) {
+	set := &MaskSet{
+		mapping:  mapping,
+		masks:    make(map[string]*Mask),
+		nicks:    make(map[string][]*Mask),
+		accounts: make(map[string][]*Mask),
+	}
+
+	for _, mask := range masks {
+		if _, err := set.Add(mask); err != nil {
+			return nil, err
+		}
+	}
+
+	return set, nil
+}
+
+// Len returns the number of masks in the set
+func (s *MaskSet) Len() int {
+	return len(s.masks)
+}
+
+// Masks returns the normalized masks in the set
+func (s *MaskSet) Masks() []string {
+	masks := make([]string, 0, len(s.masks))
+	for _, mask := range s.masks {
+		masks = append(masks, mask.raw)
+	}
+	sort.Strings(masks)
+
+	return masks
+}
+
+// Add compiles and adds the mask to the set. It returns
+// false if an equal mask was already in the set.
+func (s *MaskSet) Add(raw string) (bool, error) {
+	mask, err := ParseMask(raw, s.mapping)
+	if err != nil {
+		return false, err
+	}
+
+	key := s.mapping.Fold(mask.raw)
+	if _, ok := s.masks[key]; ok {
+		return false, nil
+	}
+	s.masks[key] = mask
+
+	switch {
+	case mask.extban == 'a' && !mask.negate && mask.account != "" && literal(mask.account):
+		s.accounts[mask.account] = append(s.accounts[mask.account], mask)
+	case mask.extban == 0 && literal(mask.nick):
+		s.nicks[mask.nick] = append(s.nicks[mask.nick], mask)
+	default:
+		s.others = append(s.others, mask)
+	}
+
+	return true, nil
+}
+
+// Remove removes the mask from the set. It returns false
+// if the mask was not in the set.
+func (s *MaskSet) Remove(raw string) bool {
+	key := s.mapping.Fold(NormalizeMask(strings.TrimSpace(raw)))
+
+	mask, ok := s.masks[key]
+	if !ok {
+		return false
+	}
+	delete(s.masks, key)
+
+	s.accounts[mask.account] = without(s.accounts[mask.account], mask)
+	if len(s.accounts[mask.account]) == 0 {
+		delete(s.accounts, mask.account)
+	}
+
+	s.nicks[mask.nick] = without(s.nicks[mask.nick], mask)
+	if len(s.nicks[mask.nick]) == 0 {
+		delete(s.nicks, mask.nick)
+	}
+
+	s.others = without(s.others, mask)
+
+	return true
+}
+
+// without returns the masks without the mask
+func without(masks []*Mask, mask *Mask) []*Mask {
+	for i, m := range masks {
+		if m == mask {
+			return append(masks[:i:i], masks[i+1:]...)
+		}
+	}
+
+	return masks
+}
+
+// Match returns true if any mask in the set matches
+func (s *MaskSet) Match(prefix *Prefix, account string) bool {
+	return s.Find(prefix, account) != nil
+}
+
+// Find returns the first mask in the set that matches the
+// prefix or account, or nil if none of them match.
+func (s *MaskSet) Find(prefix *Prefix, account string) *Mask {
+	if s == nil {
+		return nil
+	}
+
+	account = s.mapping.Fold(account)
+	if masks := s.accounts[account]; len(masks) > 0 {
+		return masks[0]
+	}
+
+	var nick, user, host string
+	if prefix != nil {
+		nick = s.mapping.Fold(prefix.Name)
+		user = s.mapping.Fold(prefix.User)
+		host = s.mapping.Fold(prefix.Host)
+
+		for _, mask := range s.nicks[nick] {
+			if mask.matchPrefix(nick, user, host) {
+				return mask
+			}
+		}
+	}
+
+	for _, mask := range s.others {
+		if mask.extban != 0 {
+			if mask.matchAccount(account) {
+				return mask
+			}
+		} else if prefix != nil && mask.matchPrefix(nick, user, host) {
+			return mask
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,187 @@
+package msg_test
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/jriddick/geoffrey/msg"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var GlobTests = [...]struct {
+	Pattern string
+	Text    string
+	Match   bool
+}{
+	{"*", "", true},
+	{"*", "anything", true},
+	{"a?c", "abc", true},
+	{"a?c", "ac", false},
+	{"*.example.com", "irc.example.com", true},
+	{"*.example.com", "example.com", false},
+	{"a*b*c", "aXXbYYc", true},
+	{"a*b*c", "aXXbYY", false},
+	{"**a", "bba", true},
+	{"Nick[Away]", "nick{away}", true},
+	{"nick~", "NICK^", true},
+}
+
+var NormalizeTests = [...]struct {
+	Mask       string
+	Normalized string
+}{
+	{"nick", "nick!*@*"},
+	{"nick!user", "nick!user@*"},
+	{"user@host", "*!user@host"},
+	{"nick!user@host", "nick!user@host"},
+	{"@host", "*!*@host"},
+	{"$a:account", "$a:account"},
+}
+
+var MaskTests = [...]struct {
+	Mask    string
+	Prefix  string
+	Account string
+	Match   bool
+}{
+	{"nick", "Nick!user@host", "", true},
+	{"*!*@*.example.com", "nick!user@irc.example.com", "", true},
+	{"*!*@*.example.com", "nick!user@example.org", "", false},
+	{"*!~*@*", "nick!~user@host", "", true},
+	{"*!*@192.168.0.0/16", "nick!user@192.168.1.20", "", true},
+	{"*!*@192.168.0.0/16", "nick!user@10.0.0.1", "", false},
+	{"*!*@192.168.0.0/16", "nick!user@host", "", false},
+	{"*!*@2001:db8::/32", "nick!user@2001:db8::1", "", true},
+	{"$a", "nick!user@host", "account", true},
+	{"$a", "nick!user@host", "*", false},
+	{"$a:Account", "nick!user@host", "account", true},
+	{"$a:acc*", "nick!user@host", "account", true},
+	{"$a:other", "nick!user@host", "account", false},
+	{"$~a", "nick!user@host", "", true},
+	{"$~a", "nick!user@host", "account", false},
+}
+
+func TestMask(t *testing.T) {
+	Convey("With casemapping", t, func() {
+		So(RFC1459.Fold("Nick[]\\~"), ShouldEqual, "nick{}|^")
+		So(StrictRFC1459.Fold("Nick[]\\~"), ShouldEqual, "nick{}|~")
+		So(ASCII.Fold("Nick[]\\~"), ShouldEqual, "nick[]\\~")
+		So(RFC1459.Equal("Geoffrey[m]", "geoffrey{M}"), ShouldBeTrue)
+		So(ASCII.Equal("Geoffrey[m]", "geoffrey{M}"), ShouldBeFalse)
+		So(ParseCaseMapping("ascii"), ShouldEqual, ASCII)
+		So(ParseCaseMapping("strict-rfc1459"), ShouldEqual, StrictRFC1459)
+		So(ParseCaseMapping("rfc7613"), ShouldEqual, RFC1459)
+	})
+
+	Convey("With prefixes", t, func() {
+		So(ParsePrefix("nick!user@host").String(), ShouldEqual, "nick!user@host")
+		So(ParsePrefix("nick@host").String(), ShouldEqual, "nick@host")
+		So(ParsePrefix("irc.example.com").IsServer(), ShouldBeTrue)
+		So(ParsePrefix("nick!user@host.com").IsServer(), ShouldBeFalse)
+	})
+
+	Convey("With glob patterns", t, func() {
+		for _, test := range GlobTests {
+			So(Glob(test.Pattern, test.Text, RFC1459), ShouldEqual, test.Match)
+		}
+	})
+
+	Convey("With mask normalization", t, func() {
+		for _, test := range NormalizeTests {
+			So(NormalizeMask(test.Mask), ShouldEqual, test.Normalized)
+		}
+	})
+
+	Convey("With compiled masks", t, func() {
+		for i, test := range MaskTests {
+			test := test
+
+			Convey(fmt.Sprintf("Mask %d '%s' should match '%s' (%s): %v", i, test.Mask, test.Prefix, test.Account, test.Match), func() {
+				mask, err := ParseMask(test.Mask, RFC1459)
+				So(err, ShouldBeNil)
+				So(mask.Match(ParsePrefix(test.Prefix), test.Account), ShouldEqual, test.Match)
+			})
+		}
+
+		Convey("Should reject invalid masks", func() {
+			for mask, expected := range map[string]error{
+				"":                 ErrInvalidMask,
+				"$":                ErrInvalidMask,
+				"$a:":              ErrInvalidMask,
+				"$ab":              ErrInvalidMask,
+				"$r:name":          ErrUnknownExtban,
+				"*!*@10.0.0.0/99":  ErrInvalidMask,
+				"*!*@not-an-ip/16": ErrInvalidMask,
+			} {
+				_, err := ParseMask(mask, RFC1459)
+				So(err, ShouldEqual, expected)
+			}
+		})
+	})
+
+	Convey("With a mask set", t, func() {
+		set, err := NewMaskSet(RFC1459, "admin", "*!*@trusted.example.com", "$a:owner", "Ops[1]!*@*")
+		So(err, ShouldBeNil)
+		So(set.Len(), ShouldEqual, 4)
+
+		Convey("Should match indexed nicks", func() {
+			So(set.Match(ParsePrefix("Admin!user@host"), ""), ShouldBeTrue)
+			So(set.Match(ParsePrefix("ops{1}!user@host"), ""), ShouldBeTrue)
+			So(set.Find(ParsePrefix("admin!user@host"), "").String(), ShouldEqual, "admin!*@*")
+		})
+
+		Convey("Should match wildcard masks", func() {
+			So(set.Match(ParsePrefix("other!user@trusted.example.com"), ""), ShouldBeTrue)
+			So(set.Match(ParsePrefix("other!user@host"), ""), ShouldBeFalse)
+		})
+
+		Convey("Should match indexed accounts", func() {
+			So(set.Match(ParsePrefix("other!user@host"), "Owner"), ShouldBeTrue)
+			So(set.Match(nil, "owner"), ShouldBeTrue)
+		})
+
+		Convey("Should not add duplicates", func() {
+			added, err := set.Add("ADMIN!*@*")
+			So(err, ShouldBeNil)
+			So(added, ShouldBeFalse)
+			So(set.Len(), ShouldEqual, 4)
+		})
+
+		Convey("Should remove masks", func() {
+			So(set.Remove("Admin"), ShouldBeTrue)
+			So(set.Remove("$a:owner"), ShouldBeTrue)
+			So(set.Remove("unknown"), ShouldBeFalse)
+			So(set.Match(ParsePrefix("admin!user@host"), "owner"), ShouldBeFalse)
+			So(set.Masks(), ShouldResemble, []string{"*!*@trusted.example.com", "Ops[1]!*@*"})
+		})
+
+		Convey("Should not match on a nil set", func() {
+			var empty *MaskSet
+			So(empty.Match(ParsePrefix("admin!user@host"), ""), ShouldBeFalse)
+		})
+	})
+}
+
+func BenchmarkMaskSet(b *testing.B) {
+	masks := make([]string, 0, 5000)
+	for i := 0; i < 4000; i++ {
+		masks = append(masks, fmt.Sprintf("nick%d!*@*", i))
+	}
+	for i := 0; i < 1000; i++ {
+		masks = append(masks, fmt.Sprintf("*!*@*.host%d.example.com", i))
+	}
+
+	set, err := NewMaskSet(RFC1459, masks...)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	prefix := ParsePrefix("someone!user@irc.example.org")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		set.Match(prefix, "")
+	}
+}
@@ -1,24 +1,27 @@
 package msg
 
 import (
-	"bytes"
-	"fmt"
 	"strings"
+	"sync"
+	"time"
+	"unsafe"
 )
 
 const (
-	maxLength = 1024
+	// maxLength is the maximum length of the message
+	// excluding the tags but including CR LF.
+	maxLength = 512
+	// maxLenientLength is the maximum length of the message
+	// accepted outside of strict mode, as servers do not all
+	// keep to maxLength.
+	maxLenientLength = 1024
+	// maxParams is the maximum number of parameters
+	maxParams = 15
 )
 
-// Tags represents IRCv3.2 Message Tags that follows
-// the psuedo-BNF below. Vendor is handled by not splitting
-// so the saved key includes the vendor prefix.
-//
-// <tag>           ::= <key> ['=' <escaped value>]
-// <key>           ::= [ <vendor> '/' ] <sequence of letters, digits, hyphens (`-`)>
-// <escaped value> ::= <sequence of any characters except NUL, CR, LF, semicolon (`;`) and SPACE>
-// <vendor>        ::= <host>
-type Tags map[string]string
+// MaxMessageLength is the maximum length of a message
+// including the tags and CR LF that is parsed.
+const MaxMessageLength = maxTagsLength + maxLenientLength
 
 // Prefix represents an IRC Message Prefix and it follows
 // the psuedo-BNF below. Nick- or servername is stored in
@@ -49,79 +52,179 @@ type Prefix struct {
 // <trailing>      ::= <Any, possibly *empty*, sequence of octets not including
 //                     NUL or CR or LF>
 // <crlf>          ::= CR LF
+//
+// EmptyTrailing is set when the message ends with an empty
+// trailing parameter so it can be told apart from no trailing.
+// Time is the parsed 'time' tag from the server-time capability
+// and Batch holds the messages of a BATCH once it has ended.
+// Account is the services account of the sender from the
+// 'account' tag, or as tracked by the bot.
 type Message struct {
-	Tags     Tags     `json:",omitempty"`
-	Prefix   *Prefix  `json:",omitempty"`
-	Command  string   `json:",omitempty"`
-	Params   []string `json:",omitempty"`
-	Trailing string   `json:",omitempty"`
+	Tags          Tags       `json:",omitempty"`
+	Prefix        *Prefix    `json:",omitempty"`
+	Command       string     `json:",omitempty"`
+	Params        []string   `json:",omitempty"`
+	Trailing      string     `json:",omitempty"`
+	EmptyTrailing bool       `json:",omitempty"`
+	Time          time.Time  `json:"-"`
+	Account       string     `json:"-"`
+	Batch         []*Message `json:",omitempty"`
+
+	// Storage kept between reuses of the message
+	buf    []byte
+	prefix *Prefix
+	tags   Tags
+}
+
+// pool holds messages that can be reused
+var pool = sync.Pool{
+	New: func() interface{} {
+		return new(Message)
+	},
+}
+
+// AcquireMessage returns an empty message from the pool. The
+// message should be returned with ReleaseMessage once it is no
+// longer used.
+func AcquireMessage() *Message {
+	return pool.Get().(*Message)
+}
+
+// ReleaseMessage resets the message and returns it to the pool.
+// The message and any strings taken from it must not be used
+// after it has been released.
+func ReleaseMessage(m *Message) {
+	m.Reset()
+	pool.Put(m)
+}
+
+// Reset clears the message while keeping the allocated
+// storage for the next message parsed into it
+func (m *Message) Reset() {
+	if m.Prefix != nil {
+		m.prefix = m.Prefix
+	}
+
+	if m.Tags != nil {
+		for key := range m.Tags {
+			delete(m.Tags, key)
+		}
+		m.tags = m.Tags
+	}
+
+	m.Tags = nil
+	m.Prefix = nil
+	m.Command = ""
+	m.Params = m.Params[:0]
+	m.Trailing = ""
+	m.EmptyTrailing = false
+	m.Time = time.Time{}
+	m.Account = ""
+	m.Batch = nil
+	m.buf = m.buf[:0]
 }
 
 func trim(r rune) bool {
 	return r == '\n' || r == '\r'
 }
 
-// Bytes return the IRC message as a byte buffer
-func (m *Message) Bytes() []byte {
-	buf := new(bytes.Buffer)
+// hasTrailing returns true if the message has a trailing parameter
+func (m *Message) hasTrailing() bool {
+	return m.EmptyTrailing || m.Trailing != ""
+}
 
-	if m.Tags != nil {
-		buf.WriteRune('@')
-		length := len(m.Tags)
-		curr := 0
+// AllParams returns all parameters including the trailing
+// parameter as the last one if it is present.
+func (m *Message) AllParams() []string {
+	if !m.hasTrailing() {
+		return m.Params
+	}
 
-		for key, val := range m.Tags {
-			buf.WriteString(key)
-			curr++
+	params := make([]string, 0, len(m.Params)+1)
+	params = append(params, m.Params...)
 
-			if val != "" {
-				buf.WriteRune('=')
-				buf.WriteString(val)
-			}
+	return append(params, m.Trailing)
+}
 
-			if curr != length {
-				buf.WriteRune(';')
-			}
-		}
+// Param returns the parameter at the index including the
+// trailing parameter or an empty string if it does not exist.
+func (m *Message) Param(index int) string {
+	if index >= 0 && index < len(m.Params) {
+		return m.Params[index]
+	}
 
-		buf.WriteRune(' ')
+	if index == len(m.Params) && m.hasTrailing() {
+		return m.Trailing
 	}
 
+	return ""
+}
+
+// LastParam returns the last parameter including the trailing
+// parameter or an empty string if there are no parameters.
+func (m *Message) LastParam() string {
+	if m.hasTrailing() {
+		return m.Trailing
+	}
+
+	if len(m.Params) > 0 {
+		return m.Params[len(m.Params)-1]
+	}
+
+	return ""
+}
+
+// Bytes return the IRC message as a byte buffer
+func (m *Message) Bytes() []byte {
+	return m.AppendBytes(nil)
+}
+
+// AppendBytes appends the IRC message including CR LF to
+// the buffer and returns the extended buffer
+func (m *Message) AppendBytes(buf []byte) []byte {
+	// Write the tags separately as they have their own limit
+	buf = appendTags(buf, m.Tags)
+	tags := len(buf)
+
 	if m.Prefix != nil {
-		buf.WriteRune(':')
-		buf.WriteString(m.Prefix.Name)
+		buf = append(buf, ':')
+		buf = append(buf, m.Prefix.Name...)
 		if len(m.Prefix.User) > 0 {
-			buf.WriteRune('!')
-			buf.WriteString(m.Prefix.User)
+			buf = append(buf, '!')
+			buf = append(buf, m.Prefix.User...)
 		}
 		if len(m.Prefix.Host) > 0 {
-			buf.WriteRune('@')
-			buf.WriteString(m.Prefix.Host)
+			buf = append(buf, '@')
+			buf = append(buf, m.Prefix.Host...)
 		}
-		buf.WriteRune(' ')
+		buf = append(buf, ' ')
 	}
 
-	buf.WriteString(m.Command)
+	buf = append(buf, m.Command...)
 
-	if len(m.Params) > 0 {
-		buf.WriteRune(' ')
-		buf.WriteString(strings.Join(m.Params, " "))
-	}
+	for i, param := range m.Params {
+		buf = append(buf, ' ')
 
-	if len(m.Trailing) > 0 {
-		buf.WriteRune(' ')
-		buf.WriteRune(':')
-		buf.WriteString(m.Trailing)
+		// The last parameter has to be trailing if it is
+		// empty, contains spaces or starts with a colon
+		if i == len(m.Params)-1 && !m.hasTrailing() &&
+			(param == "" || param[0] == ':' || strings.IndexByte(param, ' ') > -1) {
+			buf = append(buf, ':')
+		}
+
+		buf = append(buf, param...)
 	}
 
-	if buf.Len() > maxLength-2 {
-		buf.Truncate(maxLength - 2)
+	if m.hasTrailing() {
+		buf = append(buf, ' ', ':')
+		buf = append(buf, m.Trailing...)
 	}
 
-	buf.WriteRune('\r')
-	buf.WriteRune('\n')
+	if len(buf)-tags > maxLength-2 {
+		buf = buf[:tags+maxLength-2]
+	}
 
-	return buf.Bytes()
+	return append(buf, '\r', '\n')
 }
 
 // String returns the IRC message as a string
@@ -129,135 +232,365 @@ func (m *Message) String() string {
 	return strings.TrimFunc(string(m.Bytes()), trim)
 }
 
+// Validate returns an error if the message cannot be sent
+// as a single IRC message. Middle parameters must not be
+// empty, contain spaces or start with a colon, except the
+// last one when there is no trailing parameter, and no part
+// of the message may contain NUL, CR or LF.
+func (m *Message) Validate() error {
+	if m.Command == "" {
+		return ErrMissingCommand
+	}
+
+	if !validCommand(m.Command) {
+		return ErrInvalidCommand
+	}
+
+	for key := range m.Tags {
+		if !validTagKey(key) {
+			return ErrInvalidTag
+		}
+	}
+
+	if m.Prefix != nil {
+		for _, part := range []string{m.Prefix.Name, m.Prefix.User, m.Prefix.Host} {
+			if invalidCharacters(part) {
+				return ErrInvalidCharacter
+			}
+
+			if strings.IndexByte(part, ' ') > -1 {
+				return ErrInvalidPrefix
+			}
+		}
+
+		if m.Prefix.Name == "" {
+			return ErrInvalidPrefix
+		}
+	}
+
+	for i, param := range m.Params {
+		if invalidCharacters(param) {
+			return ErrInvalidCharacter
+		}
+
+		// The last parameter is sent as trailing if needed
+		if i == len(m.Params)-1 && !m.hasTrailing() {
+			continue
+		}
+
+		if param == "" || param[0] == ':' || strings.IndexByte(param, ' ') > -1 {
+			return ErrInvalidParam
+		}
+	}
+
+	if invalidCharacters(m.Trailing) {
+		return ErrInvalidCharacter
+	}
+
+	params := len(m.Params)
+	if m.hasTrailing() {
+		params++
+	}
+
+	if params > maxParams {
+		return ErrTooManyParams
+	}
+
+	return nil
+}
+
+// invalidCharacters returns true if the text contains NUL, CR or LF
+func invalidCharacters(text string) bool {
+	return strings.IndexAny(text, "\x00\r\n") > -1
+}
+
+// ParsePrefix parses the prefix without the leading ':'
+func ParsePrefix(raw string) *Prefix {
+	prefix := &Prefix{}
+	parsePrefix(raw, prefix)
+	return prefix
+}
+
+// parsePrefix parses the prefix into the given prefix
+func parsePrefix(raw string, prefix *Prefix) {
+	*prefix = Prefix{}
+
+	// Search for the user
+	userToken := strings.IndexRune(raw, '!')
+
+	// Check if we found the user
+	if userToken > -1 {
+		// Set the name prefix
+		prefix.Name = raw[:userToken]
+
+		// Update the prefix
+		raw = raw[userToken+1:]
+
+		// See if we can find the host
+		hostToken := strings.IndexRune(raw, '@')
+
+		if hostToken > -1 {
+			prefix.User = raw[:hostToken]
+			prefix.Host = raw[hostToken+1:]
+		} else {
+			prefix.User = raw
+		}
+	} else {
+		// See if we can find the host
+		hostToken := strings.IndexRune(raw, '@')
+
+		if hostToken > -1 {
+			prefix.Name = raw[:hostToken]
+			prefix.Host = raw[hostToken+1:]
+		} else {
+			prefix.Name = raw
+		}
+	}
+}
+
 // ParseMessage takes an IRC message and parses
 // it into a Message struct.
 func ParseMessage(raw string) (*Message, error) {
-	// Make sure it does not exceed max length
-	if len(raw) > maxLength {
-		return nil, fmt.Errorf("message is too long")
+	return parseMessage(raw, false, true)
+}
+
+// ParseMessageBytes takes an IRC message and parses
+// it into a Message struct.
+func ParseMessageBytes(raw []byte) (*Message, error) {
+	return parseMessage(string(raw), false, true)
+}
+
+// ParseDecodedBytes parses an IRC message that was transcoded
+// to UTF-8 after it was read. The length is not checked as it
+// applies to the line read and transcoding can grow the line.
+func ParseDecodedBytes(raw []byte) (*Message, error) {
+	return parseMessage(string(raw), false, false)
+}
+
+// Parse parses the IRC message into the message reusing the
+// storage of the message. The raw bytes are copied so they can
+// be reused by the caller, but the strings of the message are
+// only valid until the message is reset or parsed into again.
+func (m *Message) Parse(raw []byte) error {
+	m.Reset()
+
+	// Copy the message into our own buffer
+	m.buf = append(m.buf, raw...)
+
+	return m.parse(*(*string)(unsafe.Pointer(&m.buf)), false, true)
+}
+
+// ParseMessageStrict takes an IRC message and parses it into
+// a Message struct. Unlike ParseMessage it rejects messages
+// that do not follow the grammar with a *ParseError.
+func ParseMessageStrict(raw string) (*Message, error) {
+	return parseMessage(raw, true, true)
+}
+
+// parseMessage parses the message and validates it
+// against the grammar if strict is set and its length
+// if checkLength is set
+func parseMessage(raw string, strict, checkLength bool) (*Message, error) {
+	// Create the message
+	message := new(Message)
+
+	if err := message.parse(raw, strict, checkLength); err != nil {
+		return nil, err
 	}
 
+	return message, nil
+}
+
+// parse parses the raw message into the message
+func (m *Message) parse(raw string, strict, checkLength bool) error {
+	// Keep the original for errors
+	line := raw
+
+	// Remove the line ending
+	raw = strings.TrimRight(raw, "\r\n")
+
 	// Make sure its not empty
 	if len(strings.TrimSpace(raw)) == 0 {
-		return nil, fmt.Errorf("message is empty")
+		return parseError(line, ErrEmpty)
 	}
 
-	// Create the message
-	message := new(Message)
+	// Make sure we do not have any illegal characters
+	if strict && invalidCharacters(raw) {
+		return parseError(line, ErrInvalidCharacter)
+	}
 
 	// Check if we have found a tag
 	if raw[0] == '@' {
-		// Create the tag container
-		message.Tags = make(map[string]string)
-
 		// Find the end of the tag field
 		tagEnd := strings.IndexRune(raw, ' ')
 
 		if tagEnd == -1 {
-			return nil, fmt.Errorf("message ends with tags")
+			return parseError(line, ErrOnlyTags)
 		}
 
 		if tagEnd == 1 {
-			return nil, fmt.Errorf("empty tag field")
+			return parseError(line, ErrEmptyTags)
 		}
 
-		tags := strings.Split(raw[1:tagEnd], ";")
-
-		for _, tag := range tags {
-			equal := strings.IndexRune(tag, '=')
+		// Make sure the tags do not exceed their max length
+		if tagEnd+1 > maxTagsLength {
+			return parseError(line, ErrTagsTooLong)
+		}
 
-			if equal > -1 {
-				message.Tags[tag[:equal]] = tag[equal+1:]
-			} else {
-				message.Tags[tag] = ""
+		// Parse the tags
+		m.Tags = m.tags
+		if m.Tags == nil {
+			m.Tags = make(Tags)
+		}
+		parseTags(raw[1:tagEnd], m.Tags)
+
+		// Make sure the tag keys are valid
+		if strict {
+			for key := range m.Tags {
+				if !validTagKey(key) {
+					return parseError(line, ErrInvalidTag)
+				}
 			}
 		}
 
+		// Attach the server time
+		if value, ok := m.Tags[TimeTag]; ok {
+			m.Time, _ = time.Parse(time.RFC3339Nano, value)
+		}
+
+		// Attach the account of the sender
+		m.Account = m.Tags[AccountTag]
+
 		// Remove the tags from the string
-		raw = raw[tagEnd+1:]
+		raw = strings.TrimLeft(raw[tagEnd+1:], " ")
 	}
 
-	if raw[0] == ':' {
-		// Create the prefix
-		message.Prefix = &Prefix{}
+	// Make sure the rest does not exceed max length
+	limit := maxLenientLength
+	if strict {
+		limit = maxLength
+	}
 
+	if checkLength && len(raw)+2 > limit {
+		return parseError(line, ErrTooLong)
+	}
+
+	if len(raw) > 0 && raw[0] == ':' {
 		// Find the end
 		prefixEnd := strings.IndexRune(raw, ' ')
 
 		if prefixEnd == -1 {
-			return nil, fmt.Errorf("message ends with prefix")
+			return parseError(line, ErrOnlyPrefix)
 		}
 
 		if prefixEnd == 1 {
-			return nil, fmt.Errorf("empty prefix")
+			return parseError(line, ErrEmptyPrefix)
 		}
 
-		// Get the substring
-		prefix := raw[1:prefixEnd]
+		// Parse the prefix
+		m.Prefix = m.prefix
+		if m.Prefix == nil {
+			m.Prefix = new(Prefix)
+		}
+		parsePrefix(raw[1:prefixEnd], m.Prefix)
 
-		// Search for the user
-		userToken := strings.IndexRune(prefix, '!')
+		// Remove the prefix
+		raw = strings.TrimLeft(raw[prefixEnd+1:], " ")
+	}
 
-		// Check if we found the user
-		if userToken > -1 {
-			// Set the name prefix
-			message.Prefix.Name = prefix[:userToken]
+	// Search for the end of command
+	commandEnd := strings.IndexRune(raw, ' ')
+	if commandEnd == -1 {
+		commandEnd = len(raw)
+	}
 
-			// Update the prefix
-			prefix = prefix[userToken+1:]
+	// Set the command
+	m.Command = raw[:commandEnd]
+	raw = raw[commandEnd:]
 
-			// See if we can find the host
-			hostToken := strings.IndexRune(prefix, '@')
+	if m.Command == "" {
+		return parseError(line, ErrMissingCommand)
+	}
 
-			if hostToken > -1 {
-				message.Prefix.User = prefix[:hostToken]
-				message.Prefix.Host = prefix[hostToken+1:]
-			} else {
-				message.Prefix.User = prefix
-			}
-		} else {
-			// See if we can find the host
-			hostToken := strings.IndexRune(prefix, '@')
-
-			if hostToken > -1 {
-				message.Prefix.Name = prefix[:hostToken]
-				message.Prefix.Host = prefix[hostToken+1:]
-			} else {
-				message.Prefix.Name = prefix
-			}
+	if strict && !validCommand(m.Command) {
+		return parseError(line, ErrInvalidCommand)
+	}
+
+	for {
+		// Skip the separating spaces
+		raw = strings.TrimLeft(raw, " ")
+
+		if raw == "" {
+			break
 		}
 
-		// Remove the prefix
-		raw = raw[prefixEnd+1:]
+		// The rest is the trailing parameter
+		if raw[0] == ':' {
+			m.Trailing = raw[1:]
+			m.EmptyTrailing = m.Trailing == ""
+			break
+		}
+
+		// Find the end of the middle parameter
+		paramEnd := strings.IndexRune(raw, ' ')
+		if paramEnd == -1 {
+			paramEnd = len(raw)
+		}
+
+		m.Params = append(m.Params, raw[:paramEnd])
+		raw = raw[paramEnd:]
 	}
 
-	// Search for the end of command
-	commandEnd := strings.IndexRune(raw, ' ')
+	// Count the trailing as a parameter
+	params := len(m.Params)
+	if m.hasTrailing() {
+		params++
+	}
+
+	if strict && params > maxParams {
+		return parseError(line, ErrTooManyParams)
+	}
 
-	if commandEnd > -1 {
-		// Set the command
-		message.Command = raw[:commandEnd]
+	return nil
+}
 
-		// Find the trailing
-		trailingToken := strings.Index(raw, " :")
+// validCommand returns true if the command is either
+// letters or a three digit numeric
+func validCommand(command string) bool {
+	letters, digits := 0, 0
+
+	for i := 0; i < len(command); i++ {
+		switch c := command[i]; {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+			letters++
+		case c >= '0' && c <= '9':
+			digits++
+		default:
+			return false
+		}
+	}
 
-		// Check if we found the token
-		if trailingToken > -1 {
-			// Set the trailing
-			message.Trailing = strings.TrimFunc(raw[trailingToken+2:], trim)
+	return (letters > 0 && digits == 0) || (letters == 0 && digits == 3)
+}
 
-			if commandEnd+1 < trailingToken-1 {
-				// Set the params
-				message.Params = strings.Split(strings.TrimSpace(raw[commandEnd+1:trailingToken]), " ")
-			}
-		} else {
-			// Set the params
-			message.Params = strings.Split(raw[commandEnd+1:], " ")
+// validTagKey returns true if the key follows the grammar
+func validTagKey(key string) bool {
+	// Remove the client prefix
+	key = strings.TrimPrefix(key, "+")
+
+	// Validate the vendor
+	if slash := strings.IndexRune(key, '/'); slash > -1 {
+		vendor := key[:slash]
+		key = key[slash+1:]
+
+		if vendor == "" || strings.IndexFunc(vendor, func(r rune) bool {
+			return !(r == '.' || r == '-' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+		}) > -1 {
+			return false
 		}
-	} else {
-		// Set the command
-		message.Command = strings.TrimSpace(raw)
 	}
 
-	return message, nil
+	return key != "" && strings.IndexFunc(key, func(r rune) bool {
+		return !(r == '-' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	}) == -1
 }
@@ -194,7 +194,7 @@ var MessageTests = [...]*struct {
 	{
 		Result: &Message{
 			Command:  "TEST",
-			Params:   []string{"$@", "", "param"},
+			Params:   []string{"$@", "param"},
 			Trailing: "Trailing",
 		},
 		Message: "TEST $@  param :Trailing",
@@ -217,9 +217,10 @@ var MessageTests = [...]*struct {
 	},
 	{
 		Result: &Message{
-			Command:  "TOPIC",
-			Params:   []string{"#foo"},
-			Trailing: "",
+			Command:       "TOPIC",
+			Params:        []string{"#foo"},
+			Trailing:      "",
+			EmptyTrailing: true,
 		},
 		Message: "TOPIC #foo :",
 	},
@@ -336,6 +337,61 @@ func TestMessageParser(t *testing.T) {
 			})
 		})
 
+		Convey("Given a message parsed from bytes", func() {
+			raw := []byte("@tag=val;test :nick!user@host PRIVMSG #channel :Hello!\r\n")
+			msg, err := ParseMessageBytes(raw)
+
+			Convey("It should resemble the string parser", func() {
+				So(err, ShouldBeNil)
+
+				expected, _ := ParseMessage(string(raw))
+				So(msg, ShouldResemble, expected)
+			})
+		})
+
+		Convey("Given a pooled message", func() {
+			raw := []byte("@tag=val;test :nick!user@host PRIVMSG #channel :Hello!\r\n")
+			msg := AcquireMessage()
+
+			Convey("It should parse into the message", func() {
+				So(msg.Parse(raw), ShouldBeNil)
+				So(msg.Tags, ShouldResemble, Tags{"tag": "val", "test": ""})
+				So(msg.Prefix, ShouldResemble, &Prefix{Name: "nick", User: "user", Host: "host"})
+				So(msg.Command, ShouldEqual, "PRIVMSG")
+				So(msg.Params, ShouldResemble, []string{"#channel"})
+				So(msg.Trailing, ShouldEqual, "Hello!")
+			})
+
+			Convey("It should not keep fields between messages", func() {
+				So(msg.Parse(raw), ShouldBeNil)
+				So(msg.Parse([]byte("PING")), ShouldBeNil)
+				So(msg.Tags, ShouldBeNil)
+				So(msg.Prefix, ShouldBeNil)
+				So(msg.Params, ShouldBeEmpty)
+				So(msg.Trailing, ShouldEqual, "")
+			})
+
+			Convey("It should not allocate when reused", func() {
+				So(testing.AllocsPerRun(100, func() {
+					msg.Parse(raw)
+				}), ShouldEqual, 0)
+			})
+
+			Convey("It should not allocate when encoding into a buffer", func() {
+				So(msg.Parse(raw), ShouldBeNil)
+				buf := make([]byte, 0, 512)
+
+				So(testing.AllocsPerRun(100, func() {
+					buf = msg.AppendBytes(buf[:0])
+				}), ShouldEqual, 0)
+				So(string(buf), ShouldEqual, string(raw))
+			})
+
+			Reset(func() {
+				ReleaseMessage(msg)
+			})
+		})
+
 		Convey("Given an empty message", func() {
 			msg, err := ParseMessage("")
 
@@ -394,6 +450,77 @@ func BenchmarkParseMessage_max(b *testing.B) {
 	}
 }
 
+func BenchmarkParseMessageBytes_short(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(25)
+
+	raw := []byte("COMMAND arg1 :Message\r\n")
+	for i := 0; i < b.N; i++ {
+		ParseMessageBytes(raw)
+	}
+}
+
+func BenchmarkParseMessageBytes_max(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(144)
+
+	raw := []byte("@tag=val;tag1;tag2;tag3;tag4 :Namename!username@hostname COMMAND arg1 arg2 arg3 arg4 arg5 arg6 arg7 :Message Message Message Message Message\r\n")
+	for i := 0; i < b.N; i++ {
+		ParseMessageBytes(raw)
+	}
+}
+
+func BenchmarkParsePooled_short(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(25)
+
+	raw := []byte("COMMAND arg1 :Message\r\n")
+	for i := 0; i < b.N; i++ {
+		m := AcquireMessage()
+		m.Parse(raw)
+		ReleaseMessage(m)
+	}
+}
+
+func BenchmarkParsePooled_max(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(144)
+
+	raw := []byte("@tag=val;tag1;tag2;tag3;tag4 :Namename!username@hostname COMMAND arg1 arg2 arg3 arg4 arg5 arg6 arg7 :Message Message Message Message Message\r\n")
+	for i := 0; i < b.N; i++ {
+		m := AcquireMessage()
+		m.Parse(raw)
+		ReleaseMessage(m)
+	}
+}
+
+func BenchmarkAppendMessage_max(b *testing.B) {
+	b.ReportAllocs()
+
+	// Create a message
+	m := &Message{
+		Tags: map[string]string{
+			"hello": "world",
+			"money": "",
+		},
+		Prefix: &Prefix{
+			Name: "oh",
+			User: "fi!loh",
+			Host: "mo@ho.org",
+		},
+		Command:  "PRIVMSG",
+		Params:   []string{"#channel"},
+		Trailing: "Hello!",
+	}
+
+	// Reuse the same buffer
+	buf := make([]byte, 0, 512)
+
+	for i := 0; i < b.N; i++ {
+		buf = m.AppendBytes(buf[:0])
+	}
+}
+
 func BenchmarkBuildMessage_max(b *testing.B) {
 	b.ReportAllocs()
 
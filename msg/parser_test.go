@@ -0,0 +1,197 @@
+package msg_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/jriddick/geoffrey/msg"
+	"gopkg.in/yaml.v2"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// parserAtoms are the atoms of a message in the parser-tests suite
+type parserAtoms struct {
+	Tags   map[string]string
+	Source string
+	Verb   string
+	Params []string
+}
+
+// loadParserTests loads the vendored parser-tests file
+func loadParserTests(name string, tests interface{}) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "parser-tests", name))
+	So(err, ShouldBeNil)
+	So(yaml.Unmarshal(data, tests), ShouldBeNil)
+}
+
+func TestParserSuite(t *testing.T) {
+	Convey("With the parser-tests suite", t, func() {
+		Convey("Given the message split tests", func() {
+			var suite struct {
+				Tests []struct {
+					Input string
+					Atoms parserAtoms
+				}
+			}
+			loadParserTests("msg-split.yaml", &suite)
+			So(suite.Tests, ShouldNotBeEmpty)
+
+			for _, test := range suite.Tests {
+				test := test
+
+				Convey(test.Input, func() {
+					msg, err := ParseMessage(test.Input)
+					So(err, ShouldBeNil)
+
+					So(msg.Command, ShouldEqual, test.Atoms.Verb)
+					So(msg.AllParams(), ShouldResemble, test.Atoms.Params)
+
+					if test.Atoms.Tags != nil {
+						So(msg.Tags, ShouldResemble, Tags(test.Atoms.Tags))
+					} else {
+						So(msg.Tags, ShouldBeNil)
+					}
+
+					if test.Atoms.Source != "" {
+						So(msg.Prefix, ShouldResemble, ParsePrefix(test.Atoms.Source))
+					} else {
+						So(msg.Prefix, ShouldBeNil)
+					}
+
+					// The last parameter should be available by itself
+					if len(test.Atoms.Params) > 0 {
+						So(msg.LastParam(), ShouldEqual, test.Atoms.Params[len(test.Atoms.Params)-1])
+					}
+				})
+			}
+		})
+
+		Convey("Given the message join tests", func() {
+			var suite struct {
+				Tests []struct {
+					Desc    string
+					Atoms   parserAtoms
+					Matches []string
+				}
+			}
+			loadParserTests("msg-join.yaml", &suite)
+			So(suite.Tests, ShouldNotBeEmpty)
+
+			for _, test := range suite.Tests {
+				test := test
+
+				Convey(test.Desc, func() {
+					msg := &Message{
+						Command: test.Atoms.Verb,
+						Params:  test.Atoms.Params,
+					}
+
+					if test.Atoms.Tags != nil {
+						msg.Tags = Tags(test.Atoms.Tags)
+					}
+
+					if test.Atoms.Source != "" {
+						msg.Prefix = ParsePrefix(test.Atoms.Source)
+					}
+
+					So(msg.String(), ShouldBeIn, test.Matches)
+				})
+			}
+		})
+
+		Convey("Given the userhost split tests", func() {
+			var suite struct {
+				Tests []struct {
+					Source string
+					Atoms  struct {
+						Nick string
+						User string
+						Host string
+					}
+				}
+			}
+			loadParserTests("userhost-split.yaml", &suite)
+			So(suite.Tests, ShouldNotBeEmpty)
+
+			for _, test := range suite.Tests {
+				test := test
+
+				Convey(test.Source, func() {
+					So(ParsePrefix(test.Source), ShouldResemble, &Prefix{
+						Name: test.Atoms.Nick,
+						User: test.Atoms.User,
+						Host: test.Atoms.Host,
+					})
+				})
+			}
+		})
+	})
+}
+
+var StrictTests = [...]struct {
+	Message string
+	Err     error
+}{
+	{"PRIVMSG #channel :Hello\x00World", ErrInvalidCharacter},
+	{"PRIVMSG #channel :Hello\rWorld", ErrInvalidCharacter},
+	{"PRIV-MSG #channel :Hello", ErrInvalidCommand},
+	{"12 #channel :Hello", ErrInvalidCommand},
+	{"@+a.b/c-d;e=f;+=x PRIVMSG #channel :Hello", ErrInvalidTag},
+	{"@a_b=c PRIVMSG #channel :Hello", ErrInvalidTag},
+	{"CMD 1 2 3 4 5 6 7 8 9 10 11 12 13 14 15 16", ErrTooManyParams},
+	{"@tag ", ErrMissingCommand},
+	{"", ErrEmpty},
+}
+
+func TestStrictParser(t *testing.T) {
+	Convey("With the strict parser", t, func() {
+		Convey("Given malformed messages", func() {
+			for _, test := range StrictTests {
+				test := test
+
+				Convey("It should reject '"+test.Message+"'", func() {
+					msg, err := ParseMessageStrict(test.Message)
+
+					So(msg, ShouldBeNil)
+					So(errors.Is(err, test.Err), ShouldBeTrue)
+
+					var parseErr *ParseError
+					So(errors.As(err, &parseErr), ShouldBeTrue)
+					So(parseErr.Raw, ShouldEqual, test.Message)
+				})
+			}
+		})
+
+		Convey("Given well-formed messages", func() {
+			for _, raw := range []string{
+				"@+example.com/reply=1;time=2020-05-20T12:00:00.000Z :nick!user@host PRIVMSG #channel :Hello!\r\n",
+				":irc.example.com 001 geoffrey :Welcome",
+				"CMD 1 2 3 4 5 6 7 8 9 10 11 12 13 14 :15",
+			} {
+				Convey("It should accept '"+raw+"'", func() {
+					msg, err := ParseMessageStrict(raw)
+
+					So(err, ShouldBeNil)
+					So(msg, ShouldNotBeNil)
+				})
+			}
+		})
+
+		Convey("Given a message longer than 512 bytes", func() {
+			raw := "PRIVMSG #channel :" + strings.Repeat("a", 600)
+
+			Convey("It should only be rejected in strict mode", func() {
+				_, err := ParseMessageStrict(raw)
+				So(errors.Is(err, ErrTooLong), ShouldBeTrue)
+
+				msg, err := ParseMessage(raw)
+				So(err, ShouldBeNil)
+				So(msg.Trailing, ShouldHaveLength, 600)
+			})
+		})
+	})
+}
@@ -0,0 +1,299 @@
+package msg
+
+import (
+	"sort"
+	"strings"
+)
+
+// maxTagsLength is the maximum length of the tags including
+// the leading '@' and the trailing space.
+const maxTagsLength = 8191
+
+// Tags used by the IRCv3 capabilities
+const (
+	TimeTag    = "time"
+	BatchTag   = "batch"
+	LabelTag   = "label"
+	AccountTag = "account"
+	MsgIDTag   = "msgid"
+)
+
+// Tags represents IRCv3.2 Message Tags that follows
+// the psuedo-BNF below. Vendor is handled by not splitting
+// so the saved key includes the vendor prefix. Values are
+// stored unescaped.
+//
+// <tag>           ::= <key> ['=' <escaped value>]
+// <key>           ::= [ <client_prefix> ] [ <vendor> '/' ] <sequence of letters, digits, hyphens (`-`)>
+// <client_prefix> ::= '+'
+// <escaped value> ::= <sequence of any characters except NUL, CR, LF, semicolon (`;`) and SPACE>
+// <vendor>        ::= <host>
+type Tags map[string]string
+
+// TagKey is the key of a message tag
+type TagKey string
+
+// ClientOnly returns true if the tag is a client-only tag
+func (k TagKey) ClientOnly() bool {
+	return strings.HasPrefix(string(k), "+")
+}
+
+// Vendor returns the vendor of the tag or an empty string
+// if the tag has no vendor prefix
+func (k TagKey) Vendor() string {
+	key := strings.TrimPrefix(string(k), "+")
+
+	if slash := strings.IndexRune(key, '/'); slash > -1 {
+		return key[:slash]
+	}
+
+	return ""
+}
+
+// Name returns the tag name without client prefix and vendor
+func (k TagKey) Name() string {
+	key := strings.TrimPrefix(string(k), "+")
+
+	if slash := strings.IndexRune(key, '/'); slash > -1 {
+		return key[slash+1:]
+	}
+
+	return key
+}
+
+// Get returns the value of the tag and whether it exists
+func (t Tags) Get(key string) (string, bool) {
+	value, ok := t[key]
+	return value, ok
+}
+
+// Has returns true if the tag exists
+func (t Tags) Has(key string) bool {
+	_, ok := t[key]
+	return ok
+}
+
+// Keys returns the keys of the tags in sorted order
+func (t Tags) Keys() []string {
+	keys := make([]string, 0, len(t))
+	for key := range t {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// ClientOnly returns the client-only tags
+func (t Tags) ClientOnly() Tags {
+	return t.filter(func(key TagKey) bool {
+		return key.ClientOnly()
+	})
+}
+
+// Server returns the tags that are not client-only
+func (t Tags) Server() Tags {
+	return t.filter(func(key TagKey) bool {
+		return !key.ClientOnly()
+	})
+}
+
+// Vendor returns the tags with the given vendor prefix
+func (t Tags) Vendor(vendor string) Tags {
+	return t.filter(func(key TagKey) bool {
+		return key.Vendor() == vendor
+	})
+}
+
+// filter returns the tags matching the function
+func (t Tags) filter(match func(TagKey) bool) Tags {
+	tags := make(Tags)
+	for key, value := range t {
+		if match(TagKey(key)) {
+			tags[key] = value
+		}
+	}
+
+	return tags
+}
+
+// tagEscaper escapes tag values
+var tagEscaper = strings.NewReplacer(
+	"\\", "\\\\",
+	";", "\\:",
+	" ", "\\s",
+	"\r", "\\r",
+	"\n", "\\n",
+)
+
+// EscapeTagValue escapes the tag value for the wire
+func EscapeTagValue(value string) string {
+	return tagEscaper.Replace(value)
+}
+
+// UnescapeTagValue unescapes a tag value from the wire. Invalid
+// escapes drop the backslash and a trailing backslash is removed.
+func UnescapeTagValue(value string) string {
+	// Nothing to unescape
+	if strings.IndexByte(value, '\\') == -1 {
+		return value
+	}
+
+	buf := new(strings.Builder)
+	buf.Grow(len(value))
+
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' {
+			buf.WriteByte(value[i])
+			continue
+		}
+
+		// Skip the backslash
+		i++
+
+		// Drop trailing backslash
+		if i == len(value) {
+			break
+		}
+
+		switch value[i] {
+		case ':':
+			buf.WriteByte(';')
+		case 's':
+			buf.WriteByte(' ')
+		case 'r':
+			buf.WriteByte('\r')
+		case 'n':
+			buf.WriteByte('\n')
+		default:
+			buf.WriteByte(value[i])
+		}
+	}
+
+	return buf.String()
+}
+
+// parseTags parses the raw tags without the leading '@'
+// into the given tags
+func parseTags(raw string, tags Tags) {
+	for raw != "" {
+		// Find the end of the tag
+		end := strings.IndexByte(raw, ';')
+		if end == -1 {
+			end = len(raw)
+		}
+
+		tag := raw[:end]
+		raw = raw[end:]
+
+		if raw != "" {
+			raw = raw[1:]
+		}
+
+		// Skip empty tags
+		if tag == "" {
+			continue
+		}
+
+		if equal := strings.IndexByte(tag, '='); equal > -1 {
+			tags[tag[:equal]] = UnescapeTagValue(tag[equal+1:])
+		} else {
+			tags[tag] = ""
+		}
+	}
+}
+
+// escapedLength returns the length of the value once escaped
+func escapedLength(value string) int {
+	length := len(value)
+
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\', ';', ' ', '\r', '\n':
+			length++
+		}
+	}
+
+	return length
+}
+
+// appendEscaped appends the escaped value to the buffer
+func appendEscaped(buf []byte, value string) []byte {
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '\\':
+			buf = append(buf, '\\', '\\')
+		case ';':
+			buf = append(buf, '\\', ':')
+		case ' ':
+			buf = append(buf, '\\', 's')
+		case '\r':
+			buf = append(buf, '\\', 'r')
+		case '\n':
+			buf = append(buf, '\\', 'n')
+		default:
+			buf = append(buf, c)
+		}
+	}
+
+	return buf
+}
+
+// appendTags appends the tags in sorted order including the
+// leading '@' and the trailing space. Tags that do not fit
+// within the tag length limit are left out.
+func appendTags(buf []byte, tags Tags) []byte {
+	if len(tags) == 0 {
+		return buf
+	}
+
+	// Sort the keys without allocating for the common case
+	var scratch [16]string
+	keys := scratch[:0]
+
+	for key := range tags {
+		keys = append(keys, key)
+
+		for i := len(keys) - 1; i > 0 && keys[i] < keys[i-1]; i-- {
+			keys[i], keys[i-1] = keys[i-1], keys[i]
+		}
+	}
+
+	// Length of the written tags
+	length := 0
+
+	for _, key := range keys {
+		value := tags[key]
+
+		// Get the length of the tag
+		size := len(key)
+		if value != "" {
+			size += 1 + escapedLength(value)
+		}
+
+		// Make sure the tag fits including '@' or ';' and the space
+		if length+size+2 > maxTagsLength {
+			continue
+		}
+
+		if length == 0 {
+			buf = append(buf, '@')
+		} else {
+			buf = append(buf, ';')
+		}
+
+		buf = append(buf, key...)
+		if value != "" {
+			buf = append(buf, '=')
+			buf = appendEscaped(buf, value)
+		}
+
+		length += size + 1
+	}
+
+	if length > 0 {
+		buf = append(buf, ' ')
+	}
+
+	return buf
+}
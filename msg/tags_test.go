@@ -0,0 +1,132 @@
+package msg_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/jriddick/geoffrey/msg"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var TagValueTests = [...]struct {
+	Escaped   string
+	Unescaped string
+}{
+	{"", ""},
+	{"value", "value"},
+	{"a\\sb", "a b"},
+	{"a\\:b", "a;b"},
+	{"a\\\\b", "a\\b"},
+	{"a\\r\\nb", "a\r\nb"},
+	{"\\:\\s\\\\\\r\\n", "; \\\r\n"},
+}
+
+func TestTags(t *testing.T) {
+	Convey("With message tags", t, func() {
+		Convey("Given escaped tag values", func() {
+			for _, test := range TagValueTests {
+				Convey("It should unescape '"+test.Escaped+"'", func() {
+					So(UnescapeTagValue(test.Escaped), ShouldEqual, test.Unescaped)
+				})
+
+				Convey("It should escape '"+test.Unescaped+"'", func() {
+					So(EscapeTagValue(test.Unescaped), ShouldEqual, test.Escaped)
+				})
+			}
+		})
+
+		Convey("Given invalid escapes", func() {
+			Convey("It should drop the backslash of unknown escapes", func() {
+				So(UnescapeTagValue("\\b\\x"), ShouldEqual, "bx")
+			})
+
+			Convey("It should drop a trailing backslash", func() {
+				So(UnescapeTagValue("value\\"), ShouldEqual, "value")
+			})
+		})
+
+		Convey("Given a message with escaped tags", func() {
+			msg, err := ParseMessage("@+example.com/reply=a\\sb\\:c;time=2020-05-20T12:00:00.000Z;empty= :nick PRIVMSG #channel :Hello!")
+
+			So(err, ShouldBeNil)
+
+			Convey("It should unescape the values", func() {
+				So(msg.Tags, ShouldResemble, Tags{
+					"+example.com/reply": "a b;c",
+					"time":               "2020-05-20T12:00:00.000Z",
+					"empty":              "",
+				})
+			})
+
+			Convey("It should split client-only and server tags", func() {
+				So(msg.Tags.ClientOnly(), ShouldResemble, Tags{"+example.com/reply": "a b;c"})
+				So(msg.Tags.Server(), ShouldResemble, Tags{"time": "2020-05-20T12:00:00.000Z", "empty": ""})
+			})
+
+			Convey("It should parse the server time", func() {
+				So(msg.Time.Equal(time.Date(2020, 5, 20, 12, 0, 0, 0, time.UTC)), ShouldBeTrue)
+			})
+
+			Convey("It should find tags by vendor", func() {
+				So(msg.Tags.Vendor("example.com"), ShouldResemble, Tags{"+example.com/reply": "a b;c"})
+			})
+
+			Convey("It should serialize deterministically", func() {
+				for i := 0; i < 10; i++ {
+					So(msg.String(), ShouldEqual, "@+example.com/reply=a\\sb\\:c;empty;time=2020-05-20T12:00:00.000Z :nick PRIVMSG #channel :Hello!")
+				}
+			})
+		})
+
+		Convey("Given tag keys", func() {
+			Convey("It should detect client-only tags", func() {
+				So(TagKey("+typing").ClientOnly(), ShouldBeTrue)
+				So(TagKey("time").ClientOnly(), ShouldBeFalse)
+			})
+
+			Convey("It should split vendor and name", func() {
+				So(TagKey("+draft/reply").Vendor(), ShouldEqual, "draft")
+				So(TagKey("+draft/reply").Name(), ShouldEqual, "reply")
+				So(TagKey("account").Vendor(), ShouldEqual, "")
+				So(TagKey("account").Name(), ShouldEqual, "account")
+			})
+		})
+
+		Convey("Given tags longer than the body limit", func() {
+			raw := "@long=" + strings.Repeat("a", 1000) + " PRIVMSG #channel :Hello!"
+			msg, err := ParseMessage(raw)
+
+			Convey("It should parse the message", func() {
+				So(err, ShouldBeNil)
+				So(msg.Tags["long"], ShouldHaveLength, 1000)
+				So(msg.String(), ShouldEqual, raw)
+			})
+		})
+
+		Convey("Given tags exceeding the tag limit", func() {
+			msg, err := ParseMessage("@long=" + strings.Repeat("a", 8191) + " PRIVMSG #channel :Hello!")
+
+			Convey("It should fail with an error", func() {
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "tags are too long")
+				So(msg, ShouldBeNil)
+			})
+		})
+
+		Convey("Given a message with tags exceeding the tag limit", func() {
+			msg := &Message{
+				Tags: Tags{
+					"a": strings.Repeat("a", 5000),
+					"b": strings.Repeat("b", 5000),
+				},
+				Command: "PING",
+			}
+
+			Convey("It should leave out the tags that do not fit", func() {
+				So(msg.String(), ShouldEqual, "@a="+strings.Repeat("a", 5000)+" PING")
+			})
+		})
+	})
+}
@@ -0,0 +1,121 @@
+package plugins
+
+import (
+	"fmt"
+	"strings"
+
+	base "github.com/jriddick/geoffrey/bot"
+	"github.com/jriddick/geoffrey/irc"
+	"github.com/jriddick/geoffrey/msg"
+	log "github.com/sirupsen/logrus"
+)
+
+func init() {
+	base.RegisterHandler(ChannelsHandler)
+}
+
+// replyTarget returns where replies to the message should be sent
+func replyTarget(bot *base.Bot, msg *msg.Message) string {
+	if len(msg.Params) > 0 && !bot.IsMe(msg.Params[0]) {
+		return msg.Params[0]
+	}
+
+	return msg.Prefix.Name
+}
+
+// ChannelsHandler lets administrators manage the channels
+// of the bot at runtime. Changes are persisted in the database.
+//
+// !join <channel> [key]
+// !part <channel> [reason]
+// !cycle <channel>
+// !channels
+var ChannelsHandler = base.Handler{
+	Name:        "Channels",
+	Description: "Administrator commands for joining and parting channels at runtime",
+	Event:       irc.Message,
+	Run: func(bot *base.Bot, msg *msg.Message) (bool, error) {
+		// Only handle commands
+		if msg.Prefix == nil || !strings.HasPrefix(msg.Trailing, "!") {
+			return false, nil
+		}
+
+		// Split the command
+		args := strings.Fields(msg.Trailing)
+
+		switch args[0] {
+		case "!join", "!part", "!cycle", "!channels":
+		default:
+			return false, nil
+		}
+
+		// Get where to reply
+		target := replyTarget(bot, msg)
+
+		// Only administrators may manage channels
+		if !bot.IsAdmin(msg.Prefix) {
+			log.Warnf("[channels] Ignored '%s' from non-administrator '%s'", args[0], msg.Prefix.Name)
+			return false, nil
+		}
+
+		// List the tracked channels
+		if args[0] == "!channels" {
+			var names []string
+			for _, channel := range bot.Channels() {
+				if channel.Joined {
+					names = append(names, channel.Name)
+				} else {
+					names = append(names, channel.Name+" (not joined)")
+				}
+			}
+
+			if len(names) == 0 {
+				bot.Send(target, "Not tracking any channels")
+			} else {
+				bot.Send(target, "Channels: "+strings.Join(names, ", "))
+			}
+
+			return true, nil
+		}
+
+		// The remaining commands need a channel
+		if len(args) < 2 {
+			bot.Send(target, fmt.Sprintf("Usage: %s <channel>", args[0]))
+			return false, nil
+		}
+
+		// Get the channel
+		channel := base.ParseChannel(args[1])
+
+		switch args[0] {
+		case "!join":
+			if len(args) > 2 {
+				channel.Key = args[2]
+			}
+
+			if err := bot.SaveChannel(channel.Name, channel.Key); err != nil {
+				return false, err
+			}
+
+			bot.JoinKey(channel.Name, channel.Key)
+		case "!part":
+			if err := bot.ForgetChannel(channel.Name); err != nil {
+				return false, err
+			}
+
+			bot.Part(channel.Name, strings.Join(args[2:], " "))
+		case "!cycle":
+			// Keep the key we joined with
+			if tracked, ok := bot.Channel(channel.Name); ok {
+				channel.Key = tracked.Key
+			}
+
+			bot.Part(channel.Name, "Cycling")
+			bot.JoinKey(channel.Name, channel.Key)
+		}
+
+		log.Infof("[channels] '%s' ran '%s %s'", msg.Prefix.Name, args[0], channel.Name)
+
+		return true, nil
+	},
+}
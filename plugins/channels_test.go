@@ -0,0 +1,88 @@
+package plugins
+
+import (
+	"io/ioutil"
+	"testing"
+
+	base "github.com/jriddick/geoffrey/bot"
+	"github.com/jriddick/geoffrey/bottest"
+	log "github.com/sirupsen/logrus"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestChannels(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	Convey("With a bot managed by administrators", t, func() {
+		config := base.Config{
+			Channels: []string{"#geoffrey"},
+			Plugins:  []string{"Channels"},
+			Admins:   []string{"$a:boss", "admin!*@admin.com"},
+		}
+		config.Identification.Nick = "geoffrey"
+
+		fake, err := bottest.New(config)
+		So(err, ShouldBeNil)
+		So(fake.Enter("#geoffrey", "boss!b@boss.com"), ShouldBeNil)
+		So(fake.Login("boss!b@boss.com", "boss"), ShouldBeNil)
+		fake.Clear()
+
+		Convey("Should join channels for an administrator by mask", func() {
+			So(fake.FeedLine(":admin!a@admin.com PRIVMSG #geoffrey :!join #new secret"), ShouldBeNil)
+			So(fake, bottest.ShouldHaveSent, "JOIN #new secret")
+
+			channel, ok := fake.Channel("#new")
+			So(ok, ShouldBeTrue)
+			So(channel.Key, ShouldEqual, "secret")
+		})
+
+		Convey("Should part channels for an administrator by account", func() {
+			So(fake.FeedLine(":boss!b@boss.com PRIVMSG geoffrey :!part #geoffrey Bye"), ShouldBeNil)
+			So(fake, bottest.ShouldHaveSent, "PART #geoffrey :Bye")
+
+			_, ok := fake.Channel("#geoffrey")
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("Should cycle channels with their key", func() {
+			fake.JoinKey("#keyed", "secret")
+			fake.Clear()
+
+			So(fake.FeedLine(":admin!a@admin.com PRIVMSG #geoffrey :!cycle #keyed"), ShouldBeNil)
+			So(fake, bottest.ShouldHaveSent, "PART #keyed :Cycling")
+			So(fake, bottest.ShouldHaveSent, "JOIN #keyed secret")
+		})
+
+		Convey("Should list the channels in private", func() {
+			So(fake.FeedLine(":admin!a@admin.com PRIVMSG geoffrey :!channels"), ShouldBeNil)
+			So(fake, bottest.ShouldHaveReplied, "admin", "^Channels: #geoffrey$")
+		})
+
+		Convey("Should ignore everyone else", func() {
+			for _, line := range []string{
+				// Only the nick of the administrator
+				":admin!a@elsewhere.com PRIVMSG #geoffrey :!join #new",
+				// Only the nick of the account holder
+				":boss!b@boss.com NICK other",
+				":boss!x@spoof.com PRIVMSG #geoffrey :!part #geoffrey",
+				":someone!s@someone.com PRIVMSG #geoffrey :!cycle #geoffrey",
+			} {
+				So(fake.FeedLine(line), ShouldBeNil)
+			}
+
+			So(fake.Sent(), ShouldBeEmpty)
+			_, ok := fake.Channel("#geoffrey")
+			So(ok, ShouldBeTrue)
+		})
+
+		Convey("Should show the usage without a channel", func() {
+			So(fake.FeedLine(":admin!a@admin.com PRIVMSG #geoffrey :!join"), ShouldBeNil)
+			So(fake, bottest.ShouldHaveReplied, "#geoffrey", "^Usage: !join <channel>$")
+		})
+
+		Reset(func() {
+			fake.Close()
+		})
+	})
+}
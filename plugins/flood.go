@@ -0,0 +1,568 @@
+package plugins
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	base "github.com/jriddick/geoffrey/bot"
+	"github.com/jriddick/geoffrey/irc"
+	"github.com/jriddick/geoffrey/msg"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+func init() {
+	base.RegisterHandler(FloodHandler)
+
+	// Count the joins and parts for join floods
+	for _, event := range []string{irc.Join, irc.Part} {
+		handler := FloodHandler
+		handler.Event = event
+		base.RegisterHandler(handler)
+	}
+}
+
+// floodAuditPrefix is the prefix of the audit log in the
+// bucket of the plugin
+const floodAuditPrefix = "audit/"
+
+// floodCapsLength is the shortest line checked for capitals
+const floodCapsLength = 10
+
+// floodLimits are the thresholds and actions for a channel.
+// A check triggers when its count within the period reaches
+// the threshold, and a negative threshold disables it. The
+// durations are in milliseconds.
+type floodLimits struct {
+	Lines    int      `yaml:"lines"`
+	Repeats  int      `yaml:"repeats"`
+	Mentions int      `yaml:"mentions"`
+	Caps     float64  `yaml:"caps"`
+	Joins    int      `yaml:"joins"`
+	Cycles   int      `yaml:"cycles"`
+	Period   int      `yaml:"period"`
+	Actions  []string `yaml:"actions"`
+	Quiet    int      `yaml:"quiet"`
+	Ban      int      `yaml:"ban"`
+	Lock     string   `yaml:"lock"`
+	Lockdown int      `yaml:"lockdown"`
+	Forget   int      `yaml:"forget"`
+}
+
+// defaultFloodLimits are used for everything not configured
+var defaultFloodLimits = floodLimits{
+	Lines:    6,
+	Repeats:  3,
+	Mentions: 6,
+	Caps:     0.8,
+	Joins:    8,
+	Cycles:   4,
+	Period:   5000,
+	Actions:  []string{"warn", "quiet", "kick", "ban", "lockdown"},
+	Quiet:    60000,
+	Ban:      600000,
+	Lock:     "mr",
+	Lockdown: 120000,
+	Forget:   900000,
+}
+
+// merge returns the limits with the configured values replacing
+// the defaults
+func (l floodLimits) merge(other floodLimits) floodLimits {
+	if other.Lines != 0 {
+		l.Lines = other.Lines
+	}
+	if other.Repeats != 0 {
+		l.Repeats = other.Repeats
+	}
+	if other.Mentions != 0 {
+		l.Mentions = other.Mentions
+	}
+	if other.Caps != 0 {
+		l.Caps = other.Caps
+	}
+	if other.Joins != 0 {
+		l.Joins = other.Joins
+	}
+	if other.Cycles != 0 {
+		l.Cycles = other.Cycles
+	}
+	if other.Period != 0 {
+		l.Period = other.Period
+	}
+	if len(other.Actions) > 0 {
+		l.Actions = other.Actions
+	}
+	if other.Quiet != 0 {
+		l.Quiet = other.Quiet
+	}
+	if other.Ban != 0 {
+		l.Ban = other.Ban
+	}
+	if other.Lock != "" {
+		l.Lock = other.Lock
+	}
+	if other.Lockdown != 0 {
+		l.Lockdown = other.Lockdown
+	}
+	if other.Forget != 0 {
+		l.Forget = other.Forget
+	}
+
+	return l
+}
+
+// floodSettings is the 'flood' section of the plugin settings
+//
+//	flood:
+//	  audit: "#geoffrey-ops"
+//	  exempt: [ "$a:jriddick" ]
+//	  defaults: { lines: 6, period: 5000 }
+//	  channels:
+//	    "#geoffrey": { mentions: 4, actions: [ warn, kick, ban ] }
+type floodSettings struct {
+	Audit    string                 `yaml:"audit"`
+	Exempt   []string               `yaml:"exempt"`
+	Defaults floodLimits            `yaml:"defaults"`
+	Channels map[string]floodLimits `yaml:"channels"`
+}
+
+// floodUser is the recent activity of a user in a channel.
+// Last is the time of the last activity, which decides when the
+// user is forgotten, and offence the time of the last action
+// against the user, which decides when the escalation resets.
+type floodUser struct {
+	lines   []time.Time
+	texts   []string
+	cycles  []time.Time
+	level   int
+	last    time.Time
+	offence time.Time
+}
+
+// floodActions are the messages to send and the entries to
+// store, which are run after the state has been unlocked
+type floodActions []func()
+
+// run runs the actions in order
+func (a floodActions) run() {
+	for _, action := range a {
+		action()
+	}
+}
+
+// floodState holds the settings and recent activity of a bot
+type floodState struct {
+	sync.Mutex
+	settings floodSettings
+	exempt   *msg.MaskSet
+	users    map[string]*floodUser
+	joins    map[string][]time.Time
+	locked   map[string]bool
+	swept    time.Time
+	sequence int
+}
+
+// floods holds the flood state of every bot
+var floods = struct {
+	sync.Mutex
+	bots map[*base.Bot]*floodState
+}{
+	bots: make(map[*base.Bot]*floodState),
+}
+
+// floodFor returns the flood state of the bot, loading the
+// settings the first time
+func floodFor(bot *base.Bot) (*floodState, error) {
+	floods.Lock()
+	defer floods.Unlock()
+
+	if state, ok := floods.bots[bot]; ok {
+		return state, nil
+	}
+
+	state := &floodState{
+		users:  make(map[string]*floodUser),
+		joins:  make(map[string][]time.Time),
+		locked: make(map[string]bool),
+	}
+
+	if settings, ok := bot.Config().Settings["flood"]; ok {
+		data, err := yaml.Marshal(settings)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := yaml.Unmarshal(data, &state.settings); err != nil {
+			return nil, fmt.Errorf("[flood] Invalid settings: %v", err)
+		}
+	}
+
+	exempt, err := msg.NewMaskSet(bot.CaseMapping(), state.settings.Exempt...)
+	if err != nil {
+		return nil, err
+	}
+	state.exempt = exempt
+
+	floods.bots[bot] = state
+	return state, nil
+}
+
+// limits returns the limits for the channel
+func (s *floodState) limits(channel string) floodLimits {
+	limits := defaultFloodLimits.merge(s.settings.Defaults)
+
+	if configured, ok := s.settings.Channels[strings.ToLower(channel)]; ok {
+		limits = limits.merge(configured)
+	}
+
+	return limits
+}
+
+// user returns the activity of the user in the channel
+func (s *floodState) user(bot *base.Bot, channel, nick string) *floodUser {
+	key := bot.CaseMapping().Fold(channel + " " + nick)
+
+	user, ok := s.users[key]
+	if !ok {
+		user = &floodUser{}
+		s.users[key] = user
+	}
+
+	return user
+}
+
+// sweep forgets the users without recent activity
+func (s *floodState) sweep(now time.Time, forget time.Duration) {
+	if now.Sub(s.swept) < time.Minute {
+		return
+	}
+	s.swept = now
+
+	for key, user := range s.users {
+		if now.Sub(user.last) > forget {
+			delete(s.users, key)
+		}
+	}
+}
+
+// recent returns the times within the period
+func recent(times []time.Time, now time.Time, period time.Duration) []time.Time {
+	for len(times) > 0 && now.Sub(times[0]) > period {
+		times = times[1:]
+	}
+
+	return times
+}
+
+// reaches returns true if the count reaches the enabled threshold
+func reaches(count, threshold int) bool {
+	return threshold > 0 && count >= threshold
+}
+
+// capsRatio returns the ratio of capital letters in the text
+// or zero if the text has too few letters to tell
+func capsRatio(text string) float64 {
+	letters, upper := 0, 0
+	for _, r := range irc.StripFormatting(text) {
+		if unicode.IsLetter(r) {
+			letters++
+			if unicode.IsUpper(r) {
+				upper++
+			}
+		}
+	}
+
+	if letters < floodCapsLength {
+		return 0
+	}
+
+	return float64(upper) / float64(letters)
+}
+
+// mentions returns the number of channel members mentioned
+func mentions(bot *base.Bot, channel, text string) int {
+	mapping := bot.CaseMapping()
+
+	members := make(map[string]bool)
+	for _, member := range bot.Members(channel) {
+		members[mapping.Fold(member.Nick)] = true
+	}
+
+	count := 0
+	for _, word := range strings.FieldsFunc(text, func(r rune) bool {
+		return unicode.IsSpace(r) || r == ',' || r == ':'
+	}) {
+		if key := mapping.Fold(word); members[key] {
+			delete(members, key)
+			count++
+		}
+	}
+
+	return count
+}
+
+// floodEntry is an action in the audit log
+type floodEntry struct {
+	Time    time.Time
+	Channel string
+	Nick    string
+	Account string `json:",omitempty"`
+	Reason  string
+	Action  string
+}
+
+// floodAuditTime formats the time of the audit keys so they
+// sort in order
+const floodAuditTime = "2006-01-02T15:04:05.000000000Z"
+
+// audit returns the action logging and persisting the entry and
+// reporting it to the audit channel if one is configured. The
+// key holds a sequence number so entries at the same time are
+// all kept.
+func (s *floodState) audit(bot *base.Bot, entry floodEntry) func() {
+	s.sequence++
+	key := fmt.Sprintf("%s%s %06d %s %s",
+		floodAuditPrefix, entry.Time.UTC().Format(floodAuditTime), s.sequence, entry.Channel, entry.Nick)
+
+	return func() {
+		log.Warnf("[flood] %s in '%s' by '%s': %s", entry.Action, entry.Channel, entry.Nick, entry.Reason)
+
+		if err := bot.Storage("flood").Put(key, entry); err != nil {
+			log.Errorf("[flood] Could not save the audit entry: %v", err)
+		}
+
+		if s.settings.Audit != "" {
+			bot.Notice(s.settings.Audit, fmt.Sprintf("[flood] %s %s in %s: %s", entry.Action, entry.Nick, entry.Channel, entry.Reason))
+		}
+	}
+}
+
+// lockdown returns the action setting the lock modes on the
+// channel and removing them once the lockdown is over. It
+// returns nil if the channel is already locked down.
+func (s *floodState) lockdown(bot *base.Bot, channel string, limits floodLimits) func() {
+	key := strings.ToLower(channel)
+	if s.locked[key] || limits.Lock == "" {
+		return nil
+	}
+	s.locked[key] = true
+
+	var lock, unlock []base.ModeChange
+	for _, mode := range []byte(limits.Lock) {
+		lock = append(lock, base.ModeChange{Add: true, Mode: mode})
+		unlock = append(unlock, base.ModeChange{Add: false, Mode: mode})
+	}
+
+	return func() {
+		bot.Mode(channel, lock...)
+		bot.After(time.Duration(limits.Lockdown)*time.Millisecond, func() {
+			s.Lock()
+			delete(s.locked, key)
+			s.Unlock()
+
+			bot.Mode(channel, unlock...)
+		})
+	}
+}
+
+// punish escalates the action against the user for the reason
+// and returns the actions to run
+func (s *floodState) punish(bot *base.Bot, message *msg.Message, channel, reason string, limits floodLimits, user *floodUser, now time.Time) floodActions {
+	// Forget old offences
+	if now.Sub(user.offence) > time.Duration(limits.Forget)*time.Millisecond {
+		user.level = 0
+	}
+
+	if len(limits.Actions) == 0 {
+		return nil
+	}
+
+	action := limits.Actions[len(limits.Actions)-1]
+	if user.level < len(limits.Actions) {
+		action = limits.Actions[user.level]
+	}
+	user.level++
+	user.offence = now
+
+	// Start counting again after each action
+	user.lines = nil
+	user.texts = nil
+	user.cycles = nil
+
+	nick := message.Prefix.Name
+	mask := "*!*@" + message.Prefix.Host
+	if message.Prefix.Host == "" {
+		mask = nick + "!*@*"
+	}
+
+	var actions floodActions
+
+	switch action {
+	case "warn":
+		actions = append(actions, func() {
+			bot.Notice(nick, fmt.Sprintf("Please stop flooding %s (%s)", channel, reason))
+		})
+	case "quiet":
+		actions = append(actions, func() {
+			bot.Quiet(channel, mask)
+			bot.After(time.Duration(limits.Quiet)*time.Millisecond, func() {
+				bot.Unquiet(channel, mask)
+			})
+		})
+	case "kick":
+		actions = append(actions, func() {
+			bot.Kick(channel, nick, reason)
+		})
+	case "ban":
+		actions = append(actions, func() {
+			if err := bot.TimedBan(channel, mask, time.Duration(limits.Ban)*time.Millisecond); err != nil {
+				log.Errorf("[flood] Could not ban '%s' in '%s': %v", mask, channel, err)
+			}
+			bot.Kick(channel, nick, reason)
+		})
+	case "lockdown":
+		if lockdown := s.lockdown(bot, channel, limits); lockdown != nil {
+			actions = append(actions, lockdown)
+		}
+	default:
+		log.Errorf("[flood] Unknown action '%s'", action)
+		return nil
+	}
+
+	return append(actions, s.audit(bot, floodEntry{
+		Time:    now,
+		Channel: channel,
+		Nick:    nick,
+		Account: message.Account,
+		Reason:  reason,
+		Action:  action,
+	}))
+}
+
+// FloodHandler protects the channels from floods and spam by
+// escalating from warnings to quiets, kicks, timed bans and
+// finally locking the channel down.
+var FloodHandler = base.Handler{
+	Name:        "Flood",
+	Description: "Protects channels from floods, repeated lines, mass highlights and join floods",
+	Event:       irc.Message,
+	Run: func(bot *base.Bot, msg *msg.Message) (bool, error) {
+		// Only handle channel messages from others
+		if msg.Prefix == nil || bot.IsMe(msg.Prefix.Name) {
+			return false, nil
+		}
+
+		channel := msg.Trailing
+		if len(msg.Params) > 0 {
+			channel = msg.Params[0]
+		}
+
+		if _, ok := bot.Channel(channel); !ok {
+			return false, nil
+		}
+
+		state, err := floodFor(bot)
+		if err != nil {
+			return false, err
+		}
+
+		// Trusted users are never punished
+		if bot.IsAdmin(msg.Prefix) || state.exempt.Match(msg.Prefix, msg.Account) {
+			return false, nil
+		}
+
+		state.Lock()
+		actions, handled := state.check(bot, msg, channel)
+		state.Unlock()
+
+		// Send and store without holding the lock
+		actions.run()
+
+		return handled, nil
+	},
+}
+
+// check counts the message against the limits of the channel
+// and returns the actions to run for the offences found. The
+// state must be locked.
+func (s *floodState) check(bot *base.Bot, message *msg.Message, channel string) (floodActions, bool) {
+	now := bot.Now()
+	limits := s.limits(channel)
+	period := time.Duration(limits.Period) * time.Millisecond
+
+	s.sweep(now, time.Duration(limits.Forget)*time.Millisecond)
+
+	user := s.user(bot, channel, message.Prefix.Name)
+	defer func() {
+		user.last = now
+	}()
+
+	// Joins and parts count towards join floods and cycling
+	if message.Command != irc.Message {
+		var actions floodActions
+		user.cycles = append(recent(user.cycles, now, period), now)
+
+		if message.Command == irc.Join {
+			key := strings.ToLower(channel)
+			s.joins[key] = append(recent(s.joins[key], now, period), now)
+
+			if reaches(len(s.joins[key]), limits.Joins) {
+				if lockdown := s.lockdown(bot, channel, limits); lockdown != nil {
+					actions = append(actions, lockdown, s.audit(bot, floodEntry{
+						Time:    now,
+						Channel: channel,
+						Nick:    message.Prefix.Name,
+						Account: message.Account,
+						Reason:  "Join flood",
+						Action:  "lockdown",
+					}))
+				}
+			}
+		}
+
+		if reaches(len(user.cycles), limits.Cycles) {
+			actions = append(actions, s.punish(bot, message, channel, "Join flood", limits, user, now)...)
+			return actions, true
+		}
+
+		return actions, false
+	}
+
+	// Count the lines and repeats
+	text := strings.ToLower(strings.TrimSpace(irc.StripFormatting(message.Trailing)))
+
+	user.lines = append(recent(user.lines, now, period), now)
+
+	// Keep the texts of the recent lines
+	if keep := len(user.lines) - 1; keep < len(user.texts) {
+		user.texts = user.texts[len(user.texts)-keep:]
+	}
+	user.texts = append(user.texts, text)
+
+	repeats := 0
+	for _, previous := range user.texts {
+		if previous == text {
+			repeats++
+		}
+	}
+
+	var reason string
+	switch {
+	case reaches(len(user.lines), limits.Lines):
+		reason = "Flooding"
+	case reaches(repeats, limits.Repeats):
+		reason = "Repeating"
+	case reaches(mentions(bot, channel, message.Trailing), limits.Mentions):
+		reason = "Mass highlight"
+	case limits.Caps > 0 && capsRatio(message.Trailing) >= limits.Caps:
+		reason = "Excessive caps"
+	default:
+		return nil, false
+	}
+
+	return s.punish(bot, message, channel, reason, limits, user, now), true
+}
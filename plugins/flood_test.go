@@ -0,0 +1,168 @@
+package plugins
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	base "github.com/jriddick/geoffrey/bot"
+	"github.com/jriddick/geoffrey/bottest"
+	"github.com/jriddick/geoffrey/storage"
+	log "github.com/sirupsen/logrus"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// floodBot returns a bot in #geoffrey protected by the flood
+// plugin with the actions
+func floodBot(actions ...interface{}) *bottest.Bot {
+	config := base.Config{
+		Channels: []string{"#geoffrey"},
+		Plugins:  []string{"Flood"},
+		Settings: map[interface{}]interface{}{
+			"flood": map[interface{}]interface{}{
+				"defaults": map[interface{}]interface{}{
+					"actions": actions,
+				},
+			},
+		},
+	}
+	config.Identification.Nick = "geoffrey"
+
+	fake, err := bottest.New(config)
+	So(err, ShouldBeNil)
+	So(fake.Enter("#geoffrey"), ShouldBeNil)
+
+	return fake
+}
+
+// say makes the nick say the text in #geoffrey
+func say(fake *bottest.Bot, nick, text string) {
+	So(fake.FeedLine(fmt.Sprintf(":%s!%s@%s.com PRIVMSG #geoffrey :%s", nick, nick, nick, text)), ShouldBeNil)
+}
+
+// audits returns the actions in the audit log
+func audits(fake *bottest.Bot) []string {
+	var actions []string
+
+	So(fake.Storage("flood").Each(floodAuditPrefix, func(key string, value storage.Value) error {
+		var entry floodEntry
+		if err := value.Decode(&entry); err != nil {
+			return err
+		}
+
+		actions = append(actions, entry.Action+" "+entry.Nick)
+		return nil
+	}), ShouldBeNil)
+
+	return actions
+}
+
+func TestFlood(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	Convey("With a channel protected from floods", t, func() {
+		fake := floodBot("warn", "kick", "ban")
+		fake.Clear()
+
+		Convey("Should warn once the lines reach the threshold", func() {
+			for i := 1; i < defaultFloodLimits.Lines; i++ {
+				say(fake, "spammer", fmt.Sprintf("line %d", i))
+			}
+			So(fake.Sent(), ShouldBeEmpty)
+
+			say(fake, "spammer", "one line too many")
+			So(fake, bottest.ShouldHaveReplied, "spammer", "^Please stop flooding #geoffrey \\(Flooding\\)$")
+			So(audits(fake), ShouldResemble, []string{"warn spammer"})
+		})
+
+		Convey("Should not count the lines outside of the period", func() {
+			for i := 0; i < 2*defaultFloodLimits.Lines; i++ {
+				say(fake, "talker", fmt.Sprintf("line %d", i))
+				fake.Clock.Advance(2 * time.Second)
+			}
+
+			So(fake.Sent(), ShouldBeEmpty)
+		})
+
+		Convey("Should warn about repeated lines", func() {
+			for i := 0; i < defaultFloodLimits.Repeats; i++ {
+				say(fake, "parrot", "Hello!")
+			}
+
+			So(fake, bottest.ShouldHaveReplied, "parrot", "\\(Repeating\\)$")
+		})
+
+		Convey("Should escalate from warning to kicking to banning", func() {
+			for _, action := range []string{"NOTICE", "KICK", "MODE"} {
+				for i := 0; i < defaultFloodLimits.Lines; i++ {
+					say(fake, "spammer", fmt.Sprintf("line %d", i))
+				}
+
+				So(fake.Commands(action), ShouldHaveLength, 1)
+				fake.Clear()
+			}
+
+			So(audits(fake), ShouldResemble, []string{"warn spammer", "kick spammer", "ban spammer"})
+
+			bans, err := fake.TimedBans("#geoffrey")
+			So(err, ShouldBeNil)
+			So(bans, ShouldHaveLength, 1)
+			So(bans[0].Mask, ShouldEqual, "*!*@spammer.com")
+		})
+
+		Convey("Should forget offences after a while even if the user keeps talking", func() {
+			for i := 0; i < defaultFloodLimits.Lines; i++ {
+				say(fake, "spammer", fmt.Sprintf("line %d", i))
+			}
+			So(fake.Commands("NOTICE"), ShouldHaveLength, 1)
+
+			// Keep talking below the threshold until the offence is forgotten
+			forget := time.Duration(defaultFloodLimits.Forget) * time.Millisecond
+			for talked := time.Duration(0); talked <= forget; talked += 2 * time.Second {
+				say(fake, "spammer", fmt.Sprintf("calm %d", talked))
+				fake.Clock.Advance(2 * time.Second)
+			}
+			fake.Clear()
+
+			for i := 0; i < defaultFloodLimits.Lines; i++ {
+				say(fake, "spammer", fmt.Sprintf("again %d", i))
+			}
+
+			So(fake.Commands("NOTICE"), ShouldHaveLength, 1)
+			So(fake.Commands("KICK"), ShouldBeEmpty)
+		})
+
+		Convey("Should lock the channel down during a join flood", func() {
+			for i := 1; i < defaultFloodLimits.Joins; i++ {
+				So(fake.FeedLine(fmt.Sprintf(":bot%d!bot@bots.com JOIN #geoffrey", i)), ShouldBeNil)
+			}
+			So(fake.Commands("MODE"), ShouldBeEmpty)
+
+			So(fake.FeedLine(":last!bot@bots.com JOIN #geoffrey"), ShouldBeNil)
+			So(fake, bottest.ShouldHaveSent, "MODE #geoffrey +mr")
+			fake.Clear()
+
+			fake.Clock.Advance(time.Duration(defaultFloodLimits.Lockdown) * time.Millisecond)
+			So(fake, bottest.ShouldHaveSent, "MODE #geoffrey -mr")
+		})
+
+		Convey("Should keep every audit entry made at the same time", func() {
+			// The cycling user causes the join flood on their last join
+			So(fake.FeedLine(":cycler!c@cycler.com JOIN #geoffrey"), ShouldBeNil)
+			So(fake.FeedLine(":cycler!c@cycler.com PART #geoffrey"), ShouldBeNil)
+			So(fake.FeedLine(":cycler!c@cycler.com JOIN #geoffrey"), ShouldBeNil)
+			for i := 3; i < defaultFloodLimits.Joins; i++ {
+				So(fake.FeedLine(fmt.Sprintf(":bot%d!bot@bots.com JOIN #geoffrey", i)), ShouldBeNil)
+			}
+			So(fake.FeedLine(":cycler!c@cycler.com JOIN #geoffrey"), ShouldBeNil)
+
+			So(audits(fake), ShouldResemble, []string{"lockdown cycler", "warn cycler"})
+		})
+
+		Reset(func() {
+			fake.Close()
+		})
+	})
+}
@@ -13,12 +13,12 @@ import (
 
 	"regexp"
 
-	badger "github.com/dgraph-io/badger/v2"
 	"github.com/dustin/go-humanize"
 	"github.com/google/go-github/v31/github"
 	base "github.com/jriddick/geoffrey/bot"
 	"github.com/jriddick/geoffrey/irc"
 	"github.com/jriddick/geoffrey/msg"
+	"github.com/jriddick/geoffrey/storage"
 	"github.com/mvdan/xurls"
 	log "github.com/sirupsen/logrus"
 )
@@ -90,8 +90,8 @@ var GitHubHandler = base.Handler{
 			return false, nil
 		}
 
-		// Get the database
-		db := bot.Db()
+		// Get the bucket of the plugin
+		db := bot.Storage("github")
 
 		if client == nil {
 			log.Warnf("[github] Could not get authentication details.")
@@ -99,7 +99,7 @@ var GitHubHandler = base.Handler{
 		}
 
 		// Open a read transacation to the database
-		db.View(func(txn *badger.Txn) error {
+		db.View(func(tx storage.Tx) error {
 			// Download the information from the webpage
 			for _, text := range urls {
 				match := matcher.FindStringSubmatch(text)
@@ -108,11 +108,11 @@ var GitHubHandler = base.Handler{
 						log.Errorf("[github] Could not parse url '%s': %v", text, err)
 					} else {
 						// Look for the URL in the database
-						value, err := txn.Get([]byte(text))
+						value, err := tx.Get([]byte(text))
 
 						// Check if it was found or not
 						if err != nil {
-							if err != badger.ErrKeyNotFound {
+							if err != storage.ErrNotFound {
 								log.Errorf("[github] Could not query the database: %v", err)
 							} else {
 								log.Infof("[github] Fetching GitHub information for url '%s'", text)
@@ -166,15 +166,12 @@ var GitHubHandler = base.Handler{
 								}
 							}
 						} else {
-							value.Value(func(val []byte) error {
-								bot.Send(msg.Params[0], fmt.Sprintf("[%s] %s",
-									irc.Foreground("GitHub", irc.Blue),
-									irc.Bold(
-										string(val),
-									),
-								))
-								return nil
-							})
+							bot.Send(msg.Params[0], fmt.Sprintf("[%s] %s",
+								irc.Foreground("GitHub", irc.Blue),
+								irc.Bold(
+									string(value),
+								),
+							))
 						}
 					}
 				}
@@ -1,13 +1,46 @@
 package plugins
 
 import (
+	"time"
+
 	"github.com/jriddick/geoffrey/bot"
 	"github.com/jriddick/geoffrey/irc"
 	"github.com/jriddick/geoffrey/msg"
+	log "github.com/sirupsen/logrus"
 )
 
 func init() {
 	bot.RegisterHandler(JoinHandler)
+	bot.RegisterHandler(joinKickHandler)
+	bot.RegisterHandler(joinInviteHandler)
+
+	// Retry the joins that failed for temporary reasons
+	for _, event := range []string{
+		irc.ErrChannelisfull,
+		irc.ErrInviteonlychan,
+		irc.ErrBannedfromchan,
+		irc.ErrBadchannelkey,
+	} {
+		handler := joinRetryHandler
+		handler.Event = event
+		bot.RegisterHandler(handler)
+	}
+}
+
+// Default values for the join configuration
+const (
+	defaultJoinDelay   = 5000
+	defaultJoinRetry   = 30000
+	defaultJoinRetries = 5
+)
+
+// joinSetting returns the configured value or the fallback
+func joinSetting(value, fallback int) time.Duration {
+	if value <= 0 {
+		value = fallback
+	}
+
+	return time.Millisecond * time.Duration(value)
 }
 
 // JoinHandler will join all configured channels
@@ -17,14 +50,142 @@ var JoinHandler = bot.Handler{
 	Description: "Joins all pre-defined channels after registration",
 	Event:       irc.Welcome,
 	Run: func(bot *bot.Bot, msg *msg.Message) (bool, error) {
+		// Join the configured and previously tracked channels
+		// after services identification
+		afterServices(bot, msg, func() {
+			for _, channel := range bot.Channels() {
+				bot.JoinKey(channel.Name, channel.Key)
+			}
+		})
+
+		return true, nil
+	},
+}
+
+// joinRetryHandler schedules a new join attempt when
+// the server rejects a join.
+var joinRetryHandler = bot.Handler{
+	Name:        JoinHandler.Name,
+	Description: JoinHandler.Description,
+	Run: func(bot *bot.Bot, msg *msg.Message) (bool, error) {
+		// We need the channel that failed
+		if len(msg.Params) < 2 {
+			return false, nil
+		}
+
 		// Get the configuration
 		config := bot.Config()
 
-		// Join the channels in the configuration
-		for _, channel := range config.Channels {
-			bot.Join(channel)
+		// Only retry channels we are tracking
+		channel, ok := bot.Channel(msg.Params[1])
+		if !ok {
+			return false, nil
+		}
+
+		// Get the retry limit
+		retries := config.Joins.Retries
+		if retries <= 0 {
+			retries = defaultJoinRetries
+		}
+
+		// Give up when we have reached the limit
+		if attempt := bot.Attempt(channel.Name); attempt > retries {
+			log.Errorf("[join] Could not join '%s' after %d attempts: %s", channel.Name, retries, msg.Trailing)
+			return false, nil
+		}
+
+		// Get the retry delay
+		delay := joinSetting(config.Joins.Retry, defaultJoinRetry)
+
+		log.Warnf("[join] Could not join '%s' (%s), retrying in %s", channel.Name, msg.Trailing, delay)
+
+		bot.After(delay, func() {
+			bot.JoinKey(channel.Name, channel.Key)
+		})
+
+		return true, nil
+	},
+}
+
+// joinKickHandler rejoins channels after the bot
+// has been kicked.
+var joinKickHandler = bot.Handler{
+	Name:        JoinHandler.Name,
+	Description: JoinHandler.Description,
+	Event:       irc.Kick,
+	Run: func(bot *bot.Bot, msg *msg.Message) (bool, error) {
+		// Get the configuration
+		config := bot.Config()
+
+		// Only rejoin if we were the one kicked
+		if !config.Joins.Rejoin || len(msg.Params) < 2 || !bot.IsMe(msg.Params[1]) {
+			return false, nil
 		}
 
+		// Only rejoin channels we are tracking
+		channel, ok := bot.Channel(msg.Params[0])
+		if !ok {
+			return false, nil
+		}
+
+		// Get the rejoin delay
+		delay := joinSetting(config.Joins.Delay, defaultJoinDelay)
+
+		log.Infof("[join] Kicked from '%s' (%s), rejoining in %s", channel.Name, msg.Trailing, delay)
+
+		bot.After(delay, func() {
+			bot.JoinKey(channel.Name, channel.Key)
+		})
+
 		return true, nil
 	},
 }
+
+// joinInviteHandler joins channels that the bot
+// has been invited to by trusted users.
+var joinInviteHandler = bot.Handler{
+	Name:        JoinHandler.Name,
+	Description: JoinHandler.Description,
+	Event:       irc.Invite,
+	Run: func(bot *bot.Bot, msg *msg.Message) (bool, error) {
+		// Get the configuration
+		config := bot.Config()
+
+		// Get the invited channel
+		channel := msg.Trailing
+		if len(msg.Params) > 1 {
+			channel = msg.Params[1]
+		}
+
+		if msg.Prefix == nil || channel == "" {
+			return false, nil
+		}
+
+		// Only accept invites from trusted users
+		trusted, err := trustedInviter(config, msg.Prefix, msg.Account)
+		if err != nil {
+			return false, err
+		}
+
+		if trusted {
+			log.Infof("[join] Invited to '%s' by '%s'", channel, msg.Prefix.Name)
+			bot.Join(channel)
+			return true, nil
+		}
+
+		log.Warnf("[join] Ignored invite to '%s' from untrusted '%s'", channel, msg.Prefix.Name)
+
+		return false, nil
+	},
+}
+
+// trustedInviter returns true if the prefix or account
+// matches one of the masks trusted to invite the bot
+func trustedInviter(config bot.Config, prefix *msg.Prefix, account string) (bool, error) {
+	trusted, err := msg.NewMaskSet(msg.RFC1459, config.Joins.Invite...)
+	if err != nil {
+		return false, err
+	}
+
+	return trusted.Match(prefix, account), nil
+}
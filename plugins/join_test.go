@@ -0,0 +1,115 @@
+package plugins
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	base "github.com/jriddick/geoffrey/bot"
+	"github.com/jriddick/geoffrey/bottest"
+	log "github.com/sirupsen/logrus"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestJoin(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	Convey("With a bot joining channels", t, func() {
+		config := base.Config{
+			Channels: []string{"#geoffrey", "&local secret"},
+			Plugins:  []string{"Join"},
+		}
+		config.Identification.Nick = "geoffrey"
+		config.Joins.Rejoin = true
+		config.Joins.Delay = 1000
+		config.Joins.Retry = 5000
+		config.Joins.Retries = 2
+		config.Joins.Invite = []string{"$a:boss", "friend!*@friend.com"}
+
+		fake, err := bottest.New(config)
+		So(err, ShouldBeNil)
+
+		Convey("Should join the channels once registered", func() {
+			So(fake.FeedLine(":irc.example.com 001 geoffrey :Welcome"), ShouldBeNil)
+			So(fake, bottest.ShouldHaveSent, "JOIN #geoffrey")
+			So(fake, bottest.ShouldHaveSent, "JOIN &local secret")
+		})
+
+		Convey("Should retry failed joins until the limit", func() {
+			for attempt := 1; attempt <= config.Joins.Retries; attempt++ {
+				So(fake.FeedLine(":irc.example.com 475 geoffrey &local :Cannot join channel (+k)"), ShouldBeNil)
+				So(fake.Commands("JOIN"), ShouldBeEmpty)
+
+				fake.Clock.Advance(5 * time.Second)
+				So(fake, bottest.ShouldHaveSent, "JOIN &local secret")
+				fake.Clear()
+			}
+
+			So(fake.FeedLine(":irc.example.com 475 geoffrey &local :Cannot join channel (+k)"), ShouldBeNil)
+			So(fake.Clock.Pending(), ShouldEqual, 0)
+		})
+
+		Convey("Should retry again after reconnecting", func() {
+			for attempt := 0; attempt <= config.Joins.Retries; attempt++ {
+				So(fake.FeedLine(":irc.example.com 473 geoffrey #geoffrey :Cannot join channel (+i)"), ShouldBeNil)
+				fake.Clock.Advance(5 * time.Second)
+			}
+			So(fake.Clock.Pending(), ShouldEqual, 0)
+
+			So(fake.FeedLine(":irc.example.com 001 geoffrey :Welcome"), ShouldBeNil)
+			fake.Clear()
+
+			So(fake.FeedLine(":irc.example.com 473 geoffrey #geoffrey :Cannot join channel (+i)"), ShouldBeNil)
+			So(fake.Clock.Pending(), ShouldEqual, 1)
+
+			fake.Clock.Advance(5 * time.Second)
+			So(fake, bottest.ShouldHaveSent, "JOIN #geoffrey")
+		})
+
+		Convey("Should not retry channels it does not track", func() {
+			So(fake.FeedLine(":irc.example.com 473 geoffrey #elsewhere :Cannot join channel (+i)"), ShouldBeNil)
+			So(fake.Clock.Pending(), ShouldEqual, 0)
+		})
+
+		Convey("Should rejoin after being kicked", func() {
+			So(fake.Enter("#geoffrey"), ShouldBeNil)
+			So(fake.FeedLine(":op!op@op.com KICK #geoffrey geoffrey :Out"), ShouldBeNil)
+			So(fake.Commands("JOIN"), ShouldBeEmpty)
+
+			fake.Clock.Advance(time.Second)
+			So(fake, bottest.ShouldHaveSent, "JOIN #geoffrey")
+		})
+
+		Convey("Should not rejoin when others are kicked", func() {
+			So(fake.Enter("#geoffrey"), ShouldBeNil)
+			So(fake.FeedLine(":op!op@op.com KICK #geoffrey someone :Out"), ShouldBeNil)
+
+			fake.Clock.Advance(time.Second)
+			So(fake.Commands("JOIN"), ShouldBeEmpty)
+		})
+
+		Convey("Should only accept invites from trusted users", func() {
+			So(fake.Enter("#geoffrey", "boss!b@boss.com"), ShouldBeNil)
+			So(fake.Login("boss!b@boss.com", "boss"), ShouldBeNil)
+
+			for i, inviter := range []string{"friend!f@friend.com", "boss!b@boss.com"} {
+				So(fake.FeedLine(fmt.Sprintf(":%s INVITE geoffrey #invited%d", inviter, i)), ShouldBeNil)
+				So(fake, bottest.ShouldHaveSent, fmt.Sprintf("JOIN #invited%d", i))
+			}
+			fake.Clear()
+
+			// Someone else takes the nick of the account holder
+			So(fake.FeedLine(":boss!b@boss.com QUIT :Bye"), ShouldBeNil)
+			for _, inviter := range []string{"friend!f@spoof.com", "boss!x@spoof.com", "someone!s@someone.com"} {
+				So(fake.FeedLine(fmt.Sprintf(":%s INVITE geoffrey #untrusted", inviter)), ShouldBeNil)
+			}
+			So(fake.Commands("JOIN"), ShouldBeEmpty)
+		})
+
+		Reset(func() {
+			fake.Close()
+		})
+	})
+}
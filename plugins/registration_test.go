@@ -0,0 +1,46 @@
+package plugins
+
+import (
+	"io/ioutil"
+	"testing"
+
+	base "github.com/jriddick/geoffrey/bot"
+	"github.com/jriddick/geoffrey/bottest"
+	log "github.com/sirupsen/logrus"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRegistration(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	Convey("With a bot connecting to a server", t, func() {
+		config := base.Config{
+			Plugins: []string{"Registration", "Ping"},
+		}
+		config.Identification.Nick = "geoffrey"
+		config.Identification.User = "geoffrey"
+		config.Identification.Name = "Geoffrey"
+
+		fake, err := bottest.New(config)
+		So(err, ShouldBeNil)
+
+		Convey("Should register once the server looks up the host", func() {
+			So(fake.FeedLine(":irc.example.com NOTICE * :*** Checking ident"), ShouldBeNil)
+			So(fake.Sent(), ShouldBeEmpty)
+
+			So(fake.FeedLine(":irc.example.com NOTICE * :*** Looking up your hostname..."), ShouldBeNil)
+			So(fake, bottest.ShouldHaveSent, "NICK geoffrey")
+			So(fake, bottest.ShouldHaveSent, "USER geoffrey 0 * :Geoffrey")
+		})
+
+		Convey("Should answer pings from the server", func() {
+			So(fake.FeedLine("PING :irc.example.com"), ShouldBeNil)
+			So(fake, bottest.ShouldHaveSent, "PONG :irc.example.com")
+		})
+
+		Reset(func() {
+			fake.Close()
+		})
+	})
+}
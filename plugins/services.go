@@ -0,0 +1,310 @@
+package plugins
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jriddick/geoffrey/bot"
+	"github.com/jriddick/geoffrey/irc"
+	"github.com/jriddick/geoffrey/msg"
+	log "github.com/sirupsen/logrus"
+)
+
+func init() {
+	bot.RegisterHandler(ServicesHandler)
+	bot.RegisterHandler(servicesNoticeHandler)
+	bot.RegisterHandler(servicesLoggedInHandler)
+	bot.RegisterHandler(servicesJoinHandler)
+}
+
+// Default values for the services configuration
+const (
+	defaultNickServ        = "NickServ"
+	defaultChanServ        = "ChanServ"
+	defaultServicesTimeout = 10000
+	defaultServicesSuccess = `(?i)(you are now identified|you are successfully identified|password accepted)`
+	defaultServicesFailure = `(?i)(invalid password|password incorrect|is not registered|isn't registered)`
+)
+
+// servicesState holds the identification state for a
+// single registration of a bot.
+type servicesState struct {
+	sync.Mutex
+	welcome *msg.Message
+	done    bool
+	waiting []func()
+}
+
+// finish ends the wait for identification and runs everything
+// waiting for it. It returns false if the wait had already ended.
+func (s *servicesState) finish() bool {
+	s.Lock()
+	if s.done {
+		s.Unlock()
+		return false
+	}
+
+	s.done = true
+	waiting := s.waiting
+	s.waiting = nil
+	s.Unlock()
+
+	for _, f := range waiting {
+		f()
+	}
+
+	return true
+}
+
+// wait runs the function once the wait for identification
+// has ended
+func (s *servicesState) wait(f func()) {
+	s.Lock()
+	if !s.done {
+		s.waiting = append(s.waiting, f)
+		s.Unlock()
+		return
+	}
+	s.Unlock()
+
+	f()
+}
+
+// servicesPatterns are the compiled patterns of a bot that
+// recognize the replies from NickServ
+type servicesPatterns struct {
+	success *regexp.Regexp
+	failure *regexp.Regexp
+}
+
+// services holds the identification state and the patterns
+// of every bot
+var services = struct {
+	sync.Mutex
+	bots     map[*bot.Bot]*servicesState
+	patterns map[*bot.Bot]servicesPatterns
+}{
+	bots:     make(map[*bot.Bot]*servicesState),
+	patterns: make(map[*bot.Bot]servicesPatterns),
+}
+
+// servicesFor returns the identification state for the bot. A
+// new state is created when the welcome message differs from the
+// stored one so that every registration identifies again.
+func servicesFor(bot *bot.Bot, welcome *msg.Message) *servicesState {
+	services.Lock()
+	defer services.Unlock()
+
+	state, ok := services.bots[bot]
+	if !ok || (welcome != nil && state.welcome != welcome) {
+		state = &servicesState{
+			welcome: welcome,
+		}
+		services.bots[bot] = state
+	}
+
+	return state
+}
+
+// afterServices runs the function once the bot has identified
+// to NickServ or the configured timeout expires. It runs it
+// immediately if the Services plugin is not enabled.
+func afterServices(bot *bot.Bot, welcome *msg.Message, f func()) {
+	if !bot.HasPlugin(ServicesHandler.Name) {
+		f()
+		return
+	}
+
+	// Get the configuration
+	config := bot.Config()
+
+	// Get the timeout
+	timeout := config.Services.Timeout
+	if timeout <= 0 {
+		timeout = defaultServicesTimeout
+	}
+
+	state := servicesFor(bot, welcome)
+	bot.After(time.Millisecond*time.Duration(timeout), func() {
+		if state.finish() {
+			log.Warnf("[services] No identification confirmation received within %dms", timeout)
+		}
+	})
+
+	state.wait(f)
+}
+
+// servicesName returns the configured name or the fallback
+func servicesName(name, fallback string) string {
+	if name == "" {
+		return fallback
+	}
+
+	return name
+}
+
+// servicesPattern compiles the configured pattern or the fallback
+func servicesPattern(pattern, fallback string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		pattern = fallback
+	}
+
+	return regexp.Compile(pattern)
+}
+
+// ServicesHandler identifies the bot to NickServ after
+// registration on networks that lack SASL.
+var ServicesHandler = bot.Handler{
+	Name:        "Services",
+	Description: "Identifies to NickServ and requests channel modes from ChanServ",
+	Event:       irc.Welcome,
+	Init: func(bot *bot.Bot) (bool, error) {
+		// Get the configuration
+		config := bot.Config()
+
+		// Compile the patterns once
+		success, err := servicesPattern(config.Services.Success, defaultServicesSuccess)
+		if err != nil {
+			return false, err
+		}
+		failure, err := servicesPattern(config.Services.Failure, defaultServicesFailure)
+		if err != nil {
+			return false, err
+		}
+
+		services.Lock()
+		services.patterns[bot] = servicesPatterns{success: success, failure: failure}
+		services.Unlock()
+
+		return true, nil
+	},
+	Run: func(bot *bot.Bot, msg *msg.Message) (bool, error) {
+		// Get the configuration
+		config := bot.Config()
+
+		// Get the identification state for this registration
+		state := servicesFor(bot, msg)
+
+		// Nothing to identify with
+		if config.Services.Password == "" {
+			state.finish()
+			return false, nil
+		}
+
+		// Get the identify command
+		identify := config.Services.Identify
+		if identify == "" {
+			if config.Services.Account != "" {
+				identify = "IDENTIFY {account} {password}"
+			} else {
+				identify = "IDENTIFY {password}"
+			}
+		}
+
+		// Send the identification
+		bot.Send(servicesName(config.Services.NickServ, defaultNickServ), strings.NewReplacer(
+			"{account}", config.Services.Account,
+			"{password}", config.Services.Password,
+		).Replace(identify))
+
+		return true, nil
+	},
+}
+
+// servicesNoticeHandler waits for NickServ to confirm
+// or reject the identification.
+var servicesNoticeHandler = bot.Handler{
+	Name:        ServicesHandler.Name,
+	Description: ServicesHandler.Description,
+	Event:       irc.Notice,
+	Run: func(bot *bot.Bot, msg *msg.Message) (bool, error) {
+		// Get the configuration
+		config := bot.Config()
+
+		// Only handle notices from NickServ
+		if msg.Prefix == nil || !strings.EqualFold(msg.Prefix.Name, servicesName(config.Services.NickServ, defaultNickServ)) {
+			return false, nil
+		}
+
+		// Get the patterns
+		services.Lock()
+		patterns, ok := services.patterns[bot]
+		services.Unlock()
+
+		if !ok {
+			return false, nil
+		}
+
+		switch {
+		case patterns.success.MatchString(msg.Trailing):
+			log.Infof("[services] Identified to %s", msg.Prefix.Name)
+		case patterns.failure.MatchString(msg.Trailing):
+			// The joins wait for the timeout as we are not identified
+			log.Errorf("[services] Could not identify to %s: %s", msg.Prefix.Name, msg.Trailing)
+			return true, nil
+		default:
+			return false, nil
+		}
+
+		// Let the joins continue
+		servicesFor(bot, nil).finish()
+
+		return true, nil
+	},
+}
+
+// servicesLoggedInHandler treats RPL_LOGGEDIN as confirmation
+// on networks that send it after a NickServ identification.
+var servicesLoggedInHandler = bot.Handler{
+	Name:        ServicesHandler.Name,
+	Description: ServicesHandler.Description,
+	Event:       irc.Loggedin,
+	Run: func(bot *bot.Bot, msg *msg.Message) (bool, error) {
+		servicesFor(bot, nil).finish()
+		return true, nil
+	},
+}
+
+// servicesJoinHandler requests ops or voice from ChanServ
+// when the bot joins a configured channel.
+var servicesJoinHandler = bot.Handler{
+	Name:        ServicesHandler.Name,
+	Description: ServicesHandler.Description,
+	Event:       irc.Join,
+	Run: func(bot *bot.Bot, msg *msg.Message) (bool, error) {
+		// Get the configuration
+		config := bot.Config()
+
+		// Only handle our own joins
+		if msg.Prefix == nil || !bot.IsMe(msg.Prefix.Name) {
+			return false, nil
+		}
+
+		// Get the channel
+		channel := msg.Trailing
+		if len(msg.Params) > 0 {
+			channel = msg.Params[0]
+		}
+
+		// Get the ChanServ name
+		chanserv := servicesName(config.Services.ChanServ, defaultChanServ)
+
+		for _, op := range config.Services.Op {
+			if strings.EqualFold(op, channel) {
+				bot.Send(chanserv, "OP "+channel)
+				return true, nil
+			}
+		}
+
+		for _, voice := range config.Services.Voice {
+			if strings.EqualFold(voice, channel) {
+				bot.Send(chanserv, "VOICE "+channel)
+				return true, nil
+			}
+		}
+
+		return false, nil
+	},
+}
@@ -0,0 +1,116 @@
+package plugins
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	base "github.com/jriddick/geoffrey/bot"
+	"github.com/jriddick/geoffrey/bottest"
+	log "github.com/sirupsen/logrus"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestServices(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+
+	Convey("With a bot identifying to services", t, func() {
+		config := base.Config{
+			Channels: []string{"#geoffrey"},
+			Plugins:  []string{"Services", "Join"},
+		}
+		config.Identification.Nick = "geoffrey"
+		config.Services.NickServ = "NickServ"
+		config.Services.Password = "hunter2"
+		config.Services.Timeout = 5000
+		config.Services.Op = []string{"#geoffrey"}
+
+		// registered creates the bot and registers it
+		registered := func() *bottest.Bot {
+			fake, err := bottest.New(config)
+			So(err, ShouldBeNil)
+			So(fake.FeedLine(":irc.example.com 001 geoffrey :Welcome"), ShouldBeNil)
+
+			return fake
+		}
+
+		Convey("Should identify and wait with the joins", func() {
+			fake := registered()
+			defer fake.Close()
+
+			So(fake, bottest.ShouldHaveSent, "PRIVMSG NickServ :IDENTIFY hunter2")
+			So(fake.Commands("JOIN"), ShouldBeEmpty)
+		})
+
+		Convey("Should identify with the account and template", func() {
+			config.Services.Account = "geoffrey"
+			fake := registered()
+			defer fake.Close()
+			So(fake, bottest.ShouldHaveSent, "PRIVMSG NickServ :IDENTIFY geoffrey hunter2")
+
+			config.Services.Identify = "LOGIN {account} {password}"
+			custom := registered()
+			defer custom.Close()
+			So(custom, bottest.ShouldHaveSent, "PRIVMSG NickServ :LOGIN geoffrey hunter2")
+		})
+
+		Convey("Should join once identified", func() {
+			fake := registered()
+			defer fake.Close()
+
+			So(fake.FeedLine(":NickServ!services@services. NOTICE geoffrey :You are now identified for geoffrey."), ShouldBeNil)
+			So(fake, bottest.ShouldHaveSent, "JOIN #geoffrey")
+		})
+
+		Convey("Should join once logged in", func() {
+			fake := registered()
+			defer fake.Close()
+
+			So(fake.FeedLine(":irc.example.com 900 geoffrey geoffrey!geoffrey@host geoffrey :You are now logged in as geoffrey"), ShouldBeNil)
+			So(fake, bottest.ShouldHaveSent, "JOIN #geoffrey")
+		})
+
+		Convey("Should not treat a failure as identified", func() {
+			fake := registered()
+			defer fake.Close()
+
+			So(fake.FeedLine(":NickServ!services@services. NOTICE geoffrey :Invalid password for geoffrey."), ShouldBeNil)
+			So(fake.Commands("JOIN"), ShouldBeEmpty)
+
+			fake.Clock.Advance(5 * time.Second)
+			So(fake.Commands("JOIN"), ShouldHaveLength, 1)
+		})
+
+		Convey("Should join after the timeout without a reply", func() {
+			fake := registered()
+			defer fake.Close()
+
+			fake.Clock.Advance(5*time.Second - time.Millisecond)
+			So(fake.Commands("JOIN"), ShouldBeEmpty)
+
+			fake.Clock.Advance(time.Millisecond)
+			So(fake, bottest.ShouldHaveSent, "JOIN #geoffrey")
+
+			// A late confirmation does not join again
+			So(fake.FeedLine(":NickServ!services@services. NOTICE geoffrey :You are now identified for geoffrey."), ShouldBeNil)
+			So(fake.Commands("JOIN"), ShouldHaveLength, 1)
+		})
+
+		Convey("Should ignore notices from others", func() {
+			fake := registered()
+			defer fake.Close()
+
+			So(fake.FeedLine(":spoof!s@spoof.com NOTICE geoffrey :You are now identified for geoffrey."), ShouldBeNil)
+			So(fake.Commands("JOIN"), ShouldBeEmpty)
+		})
+
+		Convey("Should ask ChanServ for modes on joins", func() {
+			fake := registered()
+			defer fake.Close()
+
+			So(fake.Enter("#geoffrey"), ShouldBeNil)
+			So(fake, bottest.ShouldHaveReplied, "ChanServ", "^OP #geoffrey$")
+		})
+	})
+}
@@ -10,10 +10,10 @@ import (
 	"regexp"
 
 	"github.com/PuerkitoBio/goquery"
-	badger "github.com/dgraph-io/badger/v2"
 	base "github.com/jriddick/geoffrey/bot"
 	"github.com/jriddick/geoffrey/irc"
 	"github.com/jriddick/geoffrey/msg"
+	"github.com/jriddick/geoffrey/storage"
 	"github.com/mvdan/xurls"
 	log "github.com/sirupsen/logrus"
 )
@@ -28,8 +28,8 @@ func fetchTitle(bot *base.Bot, uri *url.URL, channel string, text string) {
 		uri.Scheme = "http"
 	}
 
-	// Get the database from the bot
-	db := bot.Db()
+	// Get the bucket of the plugin
+	db := bot.Storage("title")
 
 	// Fetch the document
 	doc, err := goquery.NewDocument(uri.String())
@@ -53,8 +53,8 @@ func fetchTitle(bot *base.Bot, uri *url.URL, channel string, text string) {
 		))
 
 		// Save the title for future use
-		if err := db.Update(func(txn *badger.Txn) error {
-			return txn.Set([]byte(text), []byte(title))
+		if err := db.Update(func(tx storage.Tx) error {
+			return tx.Set([]byte(text), []byte(title), 0)
 		}); err != nil {
 			log.Errorf("[title] Could not save title to database: %v", err)
 		}
@@ -118,11 +118,11 @@ var TitleHandler = base.Handler{
 			return false, nil
 		}
 
-		// Get the database
-		db := bot.Db()
+		// Get the bucket of the plugin
+		db := bot.Storage("title")
 
 		// Open a read transacation to the database
-		db.View(func(txn *badger.Txn) error {
+		db.View(func(tx storage.Tx) error {
 			// Download the information from the webpage
 			for _, text := range urls {
 				// Set to true to to skip the urls from being handled
@@ -142,11 +142,11 @@ var TitleHandler = base.Handler{
 						log.Errorf("[title] Could not parse url '%s': %v", text, err)
 					} else {
 						// Look for the URL in the database
-						value, err := txn.Get([]byte(text))
+						value, err := tx.Get([]byte(text))
 
 						// Check if it was found or not
 						if err != nil {
-							if err != badger.ErrKeyNotFound {
+							if err != storage.ErrNotFound {
 								log.Errorf("[title] Could not query the database: %v", err)
 							} else {
 								log.Infof("[title] Fetching title for url '%s'", text)
@@ -155,15 +155,12 @@ var TitleHandler = base.Handler{
 								go fetchTitle(bot, uri, msg.Params[0], text)
 							}
 						} else {
-							value.Value(func(val []byte) error {
-								bot.Send(msg.Params[0], fmt.Sprintf("[%s] %s",
-									irc.Foreground("LINK", irc.Green),
-									irc.Bold(
-										string(val),
-									),
-								))
-								return nil
-							})
+							bot.Send(msg.Params[0], fmt.Sprintf("[%s] %s",
+								irc.Foreground("LINK", irc.Green),
+								irc.Bold(
+									string(value),
+								),
+							))
 						}
 					}
 				}
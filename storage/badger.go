@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"time"
+
+	badger "github.com/dgraph-io/badger/v2"
+)
+
+// Badger is a store backed by a badger database
+type Badger struct {
+	db       *badger.DB
+	inMemory bool
+}
+
+// OpenBadger opens the badger database in the directory, or
+// keeps it in memory if the path is empty
+func OpenBadger(path string) (*Badger, error) {
+	options := badger.DefaultOptions(path)
+	if path == "" {
+		options = options.WithInMemory(true).WithLogger(nil)
+	}
+
+	db, err := badger.Open(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Badger{db: db, inMemory: path == ""}, nil
+}
+
+// DB returns the underlying database
+func (b *Badger) DB() *badger.DB {
+	return b.db
+}
+
+// View runs the function in a read-only transaction
+func (b *Badger) View(f func(Tx) error) error {
+	return b.db.View(func(txn *badger.Txn) error {
+		return f(&badgerTx{txn: txn})
+	})
+}
+
+// Update runs the function in a read-write transaction
+func (b *Badger) Update(f func(Tx) error) error {
+	return b.db.Update(func(txn *badger.Txn) error {
+		return f(&badgerTx{txn: txn})
+	})
+}
+
+// Close closes the database
+func (b *Badger) Close() error {
+	return b.db.Close()
+}
+
+// Compact merges the levels of the tree and rewrites the value
+// log files until there is nothing left to reclaim
+func (b *Badger) Compact() error {
+	// There are no files to reclaim
+	if b.inMemory {
+		return nil
+	}
+
+	if err := b.db.Flatten(1); err != nil {
+		return err
+	}
+
+	for {
+		if err := b.db.RunValueLogGC(0.5); err == badger.ErrNoRewrite {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// badgerTx is a badger transaction
+type badgerTx struct {
+	txn *badger.Txn
+}
+
+func (t *badgerTx) Get(key []byte) ([]byte, error) {
+	item, err := t.txn.Get(key)
+	if err == badger.ErrKeyNotFound {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return item.ValueCopy(nil)
+}
+
+func (t *badgerTx) Set(key, value []byte, ttl time.Duration) error {
+	entry := badger.NewEntry(key, value)
+	if ttl > 0 {
+		entry = entry.WithTTL(ttl)
+	}
+
+	err := t.txn.SetEntry(entry)
+	if err == badger.ErrReadOnlyTxn {
+		return ErrReadOnly
+	}
+
+	return err
+}
+
+func (t *badgerTx) Delete(key []byte) error {
+	err := t.txn.Delete(key)
+	if err == badger.ErrReadOnlyTxn {
+		return ErrReadOnly
+	}
+
+	return err
+}
+
+func (t *badgerTx) Iterate(prefix []byte, f func(key, value []byte) error) error {
+	options := badger.DefaultIteratorOptions
+	options.Prefix = prefix
+
+	iterator := t.txn.NewIterator(options)
+	defer iterator.Close()
+
+	for iterator.Rewind(); iterator.Valid(); iterator.Next() {
+		item := iterator.Item()
+
+		value, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+
+		if err := f(item.KeyCopy(nil), value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (t *badgerTx) expires(key []byte) (time.Time, error) {
+	item, err := t.txn.Get(key)
+	if err == badger.ErrKeyNotFound {
+		return time.Time{}, ErrNotFound
+	} else if err != nil {
+		return time.Time{}, err
+	}
+
+	if item.ExpiresAt() == 0 {
+		return time.Time{}, nil
+	}
+
+	return time.Unix(int64(item.ExpiresAt()), 0), nil
+}
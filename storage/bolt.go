@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltBucket is the bolt bucket holding all keys
+var boltBucket = []byte("geoffrey")
+
+// Bolt is a store backed by a bolt database
+type Bolt struct {
+	db *bolt.DB
+}
+
+// OpenBolt opens or creates the bolt database file
+func OpenBolt(path string) (*Bolt, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Bolt{db: db}, nil
+}
+
+// DB returns the underlying database
+func (b *Bolt) DB() *bolt.DB {
+	return b.db
+}
+
+// View runs the function in a read-only transaction
+func (b *Bolt) View(f func(Tx) error) error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		return f(&boltTx{bucket: tx.Bucket(boltBucket), now: time.Now()})
+	})
+}
+
+// Update runs the function in a read-write transaction
+func (b *Bolt) Update(f func(Tx) error) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return f(&boltTx{bucket: tx.Bucket(boltBucket), now: time.Now()})
+	})
+}
+
+// Close closes the database
+func (b *Bolt) Close() error {
+	return b.db.Close()
+}
+
+// Compact deletes the expired keys. Bolt reuses the freed pages
+// but never shrinks the file.
+func (b *Bolt) Compact() error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltBucket)
+		now := time.Now().UnixNano()
+
+		var expired [][]byte
+		if err := bucket.ForEach(func(key, data []byte) error {
+			if expires := boltExpires(data); expires != 0 && expires <= now {
+				expired = append(expired, append([]byte{}, key...))
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		for _, key := range expired {
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// boltExpires returns when the stored value expires in
+// nanoseconds, or zero if it never does
+func boltExpires(data []byte) int64 {
+	if len(data) < 8 {
+		return 0
+	}
+
+	return int64(binary.BigEndian.Uint64(data))
+}
+
+// boltTx is a bolt transaction. Values are stored after the
+// time they expire at in nanoseconds, or zero.
+type boltTx struct {
+	bucket *bolt.Bucket
+	now    time.Time
+}
+
+// decode returns the value unless it has expired
+func (t *boltTx) decode(data []byte) ([]byte, bool) {
+	if len(data) < 8 {
+		return nil, false
+	}
+
+	if expires := boltExpires(data); expires != 0 && expires <= t.now.UnixNano() {
+		return nil, false
+	}
+
+	return append([]byte{}, data[8:]...), true
+}
+
+func (t *boltTx) Get(key []byte) ([]byte, error) {
+	value, ok := t.decode(t.bucket.Get(key))
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return value, nil
+}
+
+func (t *boltTx) Set(key, value []byte, ttl time.Duration) error {
+	if !t.bucket.Tx().Writable() {
+		return ErrReadOnly
+	}
+
+	var expires int64
+	if at := expiry(t.now, ttl); !at.IsZero() {
+		expires = at.UnixNano()
+	}
+
+	data := make([]byte, 8, 8+len(value))
+	binary.BigEndian.PutUint64(data, uint64(expires))
+
+	return t.bucket.Put(key, append(data, value...))
+}
+
+func (t *boltTx) Delete(key []byte) error {
+	if !t.bucket.Tx().Writable() {
+		return ErrReadOnly
+	}
+
+	return t.bucket.Delete(key)
+}
+
+func (t *boltTx) Iterate(prefix []byte, f func(key, value []byte) error) error {
+	cursor := t.bucket.Cursor()
+
+	for key, data := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, data = cursor.Next() {
+		value, ok := t.decode(data)
+		if !ok {
+			continue
+		}
+
+		if err := f(append([]byte{}, key...), value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (t *boltTx) expires(key []byte) (time.Time, error) {
+	data := t.bucket.Get(key)
+	if _, ok := t.decode(data); !ok {
+		return time.Time{}, ErrNotFound
+	}
+
+	if expires := boltExpires(data); expires != 0 {
+		return time.Unix(0, expires), nil
+	}
+
+	return time.Time{}, nil
+}
@@ -0,0 +1,15 @@
+package storage
+
+import "errors"
+
+var (
+	// ErrNotFound occurs when the key does not exist or
+	// has expired
+	ErrNotFound = errors.New("storage: Key not found")
+	// ErrReadOnly occurs when a read-only transaction
+	// tries to change a key
+	ErrReadOnly = errors.New("storage: Transaction is read-only")
+	// ErrUnknownBackend occurs when the source does not
+	// name a backend that can be opened
+	ErrUnknownBackend = errors.New("storage: Unknown backend")
+)
@@ -0,0 +1,244 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// restoreBatch is how many keys are restored or deleted per
+// transaction
+const restoreBatch = 1000
+
+// errBatchFull stops the iteration once a batch is full
+var errBatchFull = errors.New("storage: Batch is full")
+
+// Record is a key in a dump. Values holding JSON are written
+// as is, other values are written as base64 in Raw.
+type Record struct {
+	Key     string          `json:"key"`
+	Value   json.RawMessage `json:"value,omitempty"`
+	Raw     []byte          `json:"raw,omitempty"`
+	Expires *time.Time      `json:"expires,omitempty"`
+}
+
+// Namespace is a bucket found in a store
+type Namespace struct {
+	Name string
+	Keys int
+}
+
+// Compacter is implemented by the stores that can reclaim the
+// space used by deleted and expired keys
+type Compacter interface {
+	Compact() error
+}
+
+// expirer is implemented by the transactions of the backends
+type expirer interface {
+	expires(key []byte) (time.Time, error)
+}
+
+// Dump writes the keys of the store with the prefix to the
+// writer as JSON lines and returns how many were written
+func Dump(store Store, prefix string, writer io.Writer) (int, error) {
+	count := 0
+	encoder := json.NewEncoder(writer)
+	encoder.SetEscapeHTML(false)
+
+	err := store.View(func(tx Tx) error {
+		return tx.Iterate([]byte(prefix), func(key, value []byte) error {
+			record := Record{Key: string(key)}
+
+			// Only values that encode to the same bytes are
+			// written as JSON so restoring them is lossless
+			var compact bytes.Buffer
+			if json.Compact(&compact, value) == nil && bytes.Equal(compact.Bytes(), value) {
+				record.Value = value
+			} else {
+				record.Raw = value
+			}
+
+			if expirer, ok := tx.(expirer); ok {
+				expires, err := expirer.expires(key)
+				if err != nil {
+					return err
+				}
+
+				if !expires.IsZero() {
+					record.Expires = &expires
+				}
+			}
+
+			count++
+			return encoder.Encode(record)
+		})
+	})
+
+	return count, err
+}
+
+// Restore reads the JSON lines written by Dump and stores the
+// keys, skipping those that have expired since. It returns how
+// many keys were restored.
+func Restore(store Store, reader io.Reader) (int, error) {
+	var batch []Record
+	count := 0
+
+	flush := func() error {
+		restored := 0
+
+		err := store.Update(func(tx Tx) error {
+			now := time.Now()
+			restored = 0
+
+			for _, record := range batch {
+				var ttl time.Duration
+				if record.Expires != nil {
+					if ttl = record.Expires.Sub(now); ttl <= 0 {
+						continue
+					}
+				}
+
+				value := []byte(record.Value)
+				if record.Value == nil {
+					value = record.Raw
+				}
+
+				if err := tx.Set([]byte(record.Key), value, ttl); err != nil {
+					return err
+				}
+
+				restored++
+			}
+
+			return nil
+		})
+
+		if err == nil {
+			count += restored
+		}
+
+		batch = batch[:0]
+		return err
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+
+	for number := 1; scanner.Scan(); number++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return count, fmt.Errorf("line %d: %w", number, err)
+		}
+
+		if batch = append(batch, record); len(batch) == restoreBatch {
+			if err := flush(); err != nil {
+				return count, err
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return count, err
+	}
+
+	return count, flush()
+}
+
+// Compact reclaims the space used by deleted and expired keys
+// if the store supports it
+func Compact(store Store) error {
+	if compacter, ok := store.(Compacter); ok {
+		return compacter.Compact()
+	}
+
+	return nil
+}
+
+// Inspect returns the namespaces of the store sorted by name
+// with the number of keys in them. Keys outside of a bucket
+// are counted in the namespace without a name.
+func Inspect(store Store) ([]Namespace, error) {
+	counts := make(map[string]int)
+
+	err := store.View(func(tx Tx) error {
+		return tx.Iterate(nil, func(key, value []byte) error {
+			name := ""
+			if index := strings.Index(string(key), Separator); index >= 0 {
+				name = string(key[:index])
+			}
+
+			counts[name]++
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	namespaces := make([]Namespace, 0, len(counts))
+	for name, keys := range counts {
+		namespaces = append(namespaces, Namespace{Name: name, Keys: keys})
+	}
+
+	sort.Slice(namespaces, func(i, j int) bool {
+		return namespaces[i].Name < namespaces[j].Name
+	})
+
+	return namespaces, nil
+}
+
+// DeletePrefix deletes the keys with the prefix and returns
+// how many were deleted
+func DeletePrefix(store Store, prefix string) (int, error) {
+	count := 0
+
+	for {
+		deleted := 0
+
+		err := store.Update(func(tx Tx) error {
+			var keys [][]byte
+
+			// Collect the keys first as not every backend allows
+			// deleting keys while iterating
+			if err := tx.Iterate([]byte(prefix), func(key, value []byte) error {
+				if keys = append(keys, key); len(keys) == restoreBatch {
+					return errBatchFull
+				}
+				return nil
+			}); err != nil && err != errBatchFull {
+				return err
+			}
+
+			for _, key := range keys {
+				if err := tx.Delete(key); err != nil {
+					return err
+				}
+			}
+
+			deleted = len(keys)
+			return nil
+		})
+
+		if err != nil {
+			return count, err
+		}
+
+		count += deleted
+		if deleted < restoreBatch {
+			return count, nil
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMaintenance(t *testing.T) {
+	for _, backend := range []string{"badger", "bolt", "sqlite", "memory"} {
+		Convey("With a filled "+backend+" store", t, func() {
+			dir, err := ioutil.TempDir("", "geoffrey")
+			So(err, ShouldBeNil)
+
+			open := func(name string) Store {
+				path := filepath.Join(dir, name)
+				if backend == "badger" {
+					So(os.Mkdir(path, 0700), ShouldBeNil)
+				}
+
+				store, err := Open(backend + ":" + path)
+				So(err, ShouldBeNil)
+				return store
+			}
+
+			store := open("source")
+
+			channels := NewBucket(store, "channels")
+			So(channels.Put("#geoffrey", item{Name: "geoffrey"}), ShouldBeNil)
+			So(channels.Put("#go-nuts", item{Name: "go-nuts", Count: 2}), ShouldBeNil)
+			So(NewBucket(store, "title").PutTTL("https://github.com", item{Name: "GitHub"}, time.Hour), ShouldBeNil)
+			So(store.Update(func(tx Tx) error {
+				return tx.Set([]byte("raw"), []byte{0, 1, 2, '{'}, 0)
+			}), ShouldBeNil)
+
+			Convey("Should restore a dump into an empty "+backend+" store", func() {
+				var dump bytes.Buffer
+				count, err := Dump(store, "", &dump)
+				So(err, ShouldBeNil)
+				So(count, ShouldEqual, 4)
+				So(strings.Count(dump.String(), "\n"), ShouldEqual, 4)
+
+				restored := open("restored")
+				defer restored.Close()
+
+				count, err = Restore(restored, &dump)
+				So(err, ShouldBeNil)
+				So(count, ShouldEqual, 4)
+
+				var value item
+				So(NewBucket(restored, "channels").Get("#go-nuts", &value), ShouldBeNil)
+				So(value, ShouldResemble, item{Name: "go-nuts", Count: 2})
+
+				So(restored.View(func(tx Tx) error {
+					raw, err := tx.Get([]byte("raw"))
+					So(raw, ShouldResemble, []byte{0, 1, 2, '{'})
+					return err
+				}), ShouldBeNil)
+
+				So(restored.View(func(tx Tx) error {
+					expirer, ok := tx.(expirer)
+					So(ok, ShouldBeTrue)
+
+					expires, err := expirer.expires([]byte("title/https://github.com"))
+					So(expires, ShouldHappenWithin, time.Minute, time.Now().Add(time.Hour))
+					return err
+				}), ShouldBeNil)
+			})
+
+			Convey("Should only dump the keys with the prefix in "+backend, func() {
+				var dump bytes.Buffer
+				count, err := Dump(store, "channels/", &dump)
+				So(err, ShouldBeNil)
+				So(count, ShouldEqual, 2)
+				So(dump.String(), ShouldContainSubstring, `"key":"channels/#geoffrey"`)
+				So(dump.String(), ShouldContainSubstring, `"value":{"Name":"geoffrey","Count":0}`)
+			})
+
+			Convey("Should skip expired keys when restoring into "+backend, func() {
+				dump := strings.NewReader(
+					`{"key":"old","value":1,"expires":"2000-01-01T00:00:00Z"}` + "\n\n" +
+						`{"key":"new","value":2}` + "\n",
+				)
+
+				count, err := Restore(store, dump)
+				So(err, ShouldBeNil)
+				So(count, ShouldEqual, 1)
+
+				So(store.View(func(tx Tx) error {
+					_, err := tx.Get([]byte("old"))
+					return err
+				}), ShouldEqual, ErrNotFound)
+			})
+
+			Convey("Should report the line of a broken dump in "+backend, func() {
+				_, err := Restore(store, strings.NewReader(`{"key":"a","value":1}`+"\n{\n"))
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldStartWith, "line 2:")
+			})
+
+			Convey("Should count the keys of each namespace in "+backend, func() {
+				namespaces, err := Inspect(store)
+				So(err, ShouldBeNil)
+				So(namespaces, ShouldResemble, []Namespace{
+					{Name: "", Keys: 1},
+					{Name: "channels", Keys: 2},
+					{Name: "title", Keys: 1},
+				})
+			})
+
+			Convey("Should delete the keys with the prefix in "+backend, func() {
+				count, err := DeletePrefix(store, "channels/")
+				So(err, ShouldBeNil)
+				So(count, ShouldEqual, 2)
+
+				namespaces, err := Inspect(store)
+				So(err, ShouldBeNil)
+				So(namespaces, ShouldHaveLength, 2)
+			})
+
+			Convey("Should delete more keys than fit in a batch in "+backend, func() {
+				So(store.Update(func(tx Tx) error {
+					for i := 0; i < restoreBatch+10; i++ {
+						if err := tx.Set([]byte(fmt.Sprintf("many/%04d", i)), []byte("1"), 0); err != nil {
+							return err
+						}
+					}
+					return nil
+				}), ShouldBeNil)
+
+				count, err := DeletePrefix(store, "many/")
+				So(err, ShouldBeNil)
+				So(count, ShouldEqual, restoreBatch+10)
+			})
+
+			Convey("Should compact the "+backend+" store", func() {
+				So(store.Update(func(tx Tx) error {
+					return tx.Set([]byte("short"), []byte("1"), time.Second)
+				}), ShouldBeNil)
+
+				time.Sleep(1100 * time.Millisecond)
+				So(Compact(store), ShouldBeNil)
+
+				namespaces, err := Inspect(store)
+				So(err, ShouldBeNil)
+				So(namespaces, ShouldHaveLength, 3)
+			})
+
+			Reset(func() {
+				So(store.Close(), ShouldBeNil)
+				os.RemoveAll(dir)
+			})
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryEntry is a value kept in memory
+type memoryEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+// expired returns true if the entry has expired at the time
+func (e *memoryEntry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
+
+// Memory is a store keeping the keys in memory
+type Memory struct {
+	// Now returns the time used to expire the keys
+	Now func() time.Time
+
+	lock    sync.RWMutex
+	entries map[string]*memoryEntry
+}
+
+// NewMemory returns an empty store
+func NewMemory() *Memory {
+	return &Memory{
+		Now:     time.Now,
+		entries: make(map[string]*memoryEntry),
+	}
+}
+
+// View runs the function in a read-only transaction
+func (m *Memory) View(f func(Tx) error) error {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return f(&memoryTx{store: m, now: m.Now()})
+}
+
+// Update runs the function in a read-write transaction. The
+// changes are applied once the function has succeeded.
+func (m *Memory) Update(f func(Tx) error) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	tx := &memoryTx{
+		store:   m,
+		now:     m.Now(),
+		changes: make(map[string]*memoryEntry),
+	}
+
+	if err := f(tx); err != nil {
+		return err
+	}
+
+	for key, entry := range tx.changes {
+		if entry == nil {
+			delete(m.entries, key)
+		} else {
+			m.entries[key] = entry
+		}
+	}
+
+	return nil
+}
+
+// Compact deletes the expired keys
+func (m *Memory) Compact() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	now := m.Now()
+	for key, entry := range m.entries {
+		if entry.expired(now) {
+			delete(m.entries, key)
+		}
+	}
+
+	return nil
+}
+
+// Close drops all keys
+func (m *Memory) Close() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.entries = make(map[string]*memoryEntry)
+	return nil
+}
+
+// memoryTx is a transaction of the memory store. The changes
+// are nil in read-only transactions and hold nil for deleted keys.
+type memoryTx struct {
+	store   *Memory
+	now     time.Time
+	changes map[string]*memoryEntry
+}
+
+// entry returns the live entry of the key
+func (t *memoryTx) entry(key string) (*memoryEntry, bool) {
+	entry, changed := t.changes[key]
+	if !changed {
+		entry = t.store.entries[key]
+	}
+
+	if entry == nil || entry.expired(t.now) {
+		return nil, false
+	}
+
+	return entry, true
+}
+
+func (t *memoryTx) Get(key []byte) ([]byte, error) {
+	entry, ok := t.entry(string(key))
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return append([]byte{}, entry.value...), nil
+}
+
+func (t *memoryTx) Set(key, value []byte, ttl time.Duration) error {
+	if t.changes == nil {
+		return ErrReadOnly
+	}
+
+	t.changes[string(key)] = &memoryEntry{
+		value:   append([]byte{}, value...),
+		expires: expiry(t.now, ttl),
+	}
+
+	return nil
+}
+
+func (t *memoryTx) Delete(key []byte) error {
+	if t.changes == nil {
+		return ErrReadOnly
+	}
+
+	t.changes[string(key)] = nil
+	return nil
+}
+
+func (t *memoryTx) Iterate(prefix []byte, f func(key, value []byte) error) error {
+	var keys []string
+
+	for key := range t.store.entries {
+		if _, changed := t.changes[key]; !changed && bytes.HasPrefix([]byte(key), prefix) {
+			keys = append(keys, key)
+		}
+	}
+
+	for key := range t.changes {
+		if bytes.HasPrefix([]byte(key), prefix) {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		entry, ok := t.entry(key)
+		if !ok {
+			continue
+		}
+
+		if err := f([]byte(key), append([]byte{}, entry.value...)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (t *memoryTx) expires(key []byte) (time.Time, error) {
+	entry, ok := t.entry(string(key))
+	if !ok {
+		return time.Time{}, ErrNotFound
+	}
+
+	return entry.expires, nil
+}
@@ -0,0 +1,215 @@
+package storage
+
+import (
+	"database/sql"
+	"time"
+
+	// Register the pure Go sqlite driver
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema creates the table holding all keys. Expires is
+// the time the key expires at in nanoseconds, or zero.
+const sqliteSchema = `CREATE TABLE IF NOT EXISTS store (
+	key     BLOB PRIMARY KEY,
+	value   BLOB NOT NULL,
+	expires INTEGER NOT NULL DEFAULT 0
+)`
+
+// sqlitePragmas waits for other processes holding the database
+// and lets readers continue while a transaction is written
+const sqlitePragmas = `PRAGMA busy_timeout = 5000; PRAGMA journal_mode = WAL`
+
+// SQLite is a store backed by a SQLite database
+type SQLite struct {
+	db *sql.DB
+}
+
+// OpenSQLite opens or creates the SQLite database file
+func OpenSQLite(path string) (*SQLite, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Transactions are serialized on a single connection
+	db.SetMaxOpenConns(1)
+
+	// The single connection is kept open so the pragmas last
+	for _, statement := range []string{sqlitePragmas, sqliteSchema} {
+		if _, err := db.Exec(statement); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	return &SQLite{db: db}, nil
+}
+
+// DB returns the underlying database
+func (s *SQLite) DB() *sql.DB {
+	return s.db
+}
+
+// View runs the function in a read-only transaction
+func (s *SQLite) View(f func(Tx) error) error {
+	return s.run(false, f)
+}
+
+// Update runs the function in a read-write transaction
+func (s *SQLite) Update(f func(Tx) error) error {
+	return s.run(true, f)
+}
+
+// run runs the function in a transaction and commits it if
+// it is writable and the function succeeded
+func (s *SQLite) run(writable bool, f func(Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := f(&sqliteTx{tx: tx, writable: writable, now: time.Now()}); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if !writable {
+		return tx.Rollback()
+	}
+
+	return tx.Commit()
+}
+
+// Close closes the database
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
+
+// Compact deletes the expired keys and rebuilds the database
+// file to reclaim the free pages
+func (s *SQLite) Compact() error {
+	if _, err := s.db.Exec("DELETE FROM store WHERE expires != 0 AND expires <= ?", time.Now().UnixNano()); err != nil {
+		return err
+	}
+
+	_, err := s.db.Exec("VACUUM")
+	return err
+}
+
+// sqliteTx is a SQLite transaction
+type sqliteTx struct {
+	tx       *sql.Tx
+	writable bool
+	now      time.Time
+}
+
+func (t *sqliteTx) Get(key []byte) ([]byte, error) {
+	var value []byte
+
+	err := t.tx.QueryRow(
+		"SELECT value FROM store WHERE key = ? AND (expires = 0 OR expires > ?)",
+		key, t.now.UnixNano(),
+	).Scan(&value)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+
+	return value, err
+}
+
+func (t *sqliteTx) Set(key, value []byte, ttl time.Duration) error {
+	if !t.writable {
+		return ErrReadOnly
+	}
+
+	var expires int64
+	if at := expiry(t.now, ttl); !at.IsZero() {
+		expires = at.UnixNano()
+	}
+
+	// An empty value binds as NULL and is stored as an empty blob
+	_, err := t.tx.Exec(
+		"INSERT OR REPLACE INTO store (key, value, expires) VALUES (?, coalesce(?, x''), ?)",
+		key, value, expires,
+	)
+	return err
+}
+
+func (t *sqliteTx) Delete(key []byte) error {
+	if !t.writable {
+		return ErrReadOnly
+	}
+
+	_, err := t.tx.Exec("DELETE FROM store WHERE key = ?", key)
+	return err
+}
+
+func (t *sqliteTx) Iterate(prefix []byte, f func(key, value []byte) error) error {
+	query := "SELECT key, value FROM store WHERE (expires = 0 OR expires > ?)"
+	args := []interface{}{t.now.UnixNano()}
+
+	// An empty blob binds as NULL, which no key compares to
+	if len(prefix) > 0 {
+		query += " AND key >= ?"
+		args = append(args, prefix)
+	}
+
+	if bound := upperBound(prefix); bound != nil {
+		query += " AND key < ?"
+		args = append(args, bound)
+	}
+
+	rows, err := t.tx.Query(query+" ORDER BY key", args...)
+	if err != nil {
+		return err
+	}
+
+	// Read all rows first so the function can use the transaction
+	var keys, values [][]byte
+	for rows.Next() {
+		var key, value []byte
+		if err := rows.Scan(&key, &value); err != nil {
+			rows.Close()
+			return err
+		}
+
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return err
+	}
+
+	if err := rows.Close(); err != nil {
+		return err
+	}
+
+	for i := range keys {
+		if err := f(keys[i], values[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (t *sqliteTx) expires(key []byte) (time.Time, error) {
+	var expires int64
+
+	err := t.tx.QueryRow(
+		"SELECT expires FROM store WHERE key = ? AND (expires = 0 OR expires > ?)",
+		key, t.now.UnixNano(),
+	).Scan(&expires)
+
+	if err == sql.ErrNoRows {
+		return time.Time{}, ErrNotFound
+	} else if err != nil || expires == 0 {
+		return time.Time{}, err
+	}
+
+	return time.Unix(0, expires), nil
+}
@@ -0,0 +1,227 @@
+// Package storage is the key-value store used by the bot and
+// its plugins. A store is opened from a source naming the
+// backend and its path:
+//
+//	badger:./db
+//	bolt:./geoffrey.db
+//	sqlite:./geoffrey.sqlite
+//	memory:
+//
+// A source without a known backend is the path of a badger
+// database. Every plugin should use its own Bucket so keys
+// never collide with those of other plugins.
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Tx is a transaction of a store
+type Tx interface {
+	// Get returns the value of the key or ErrNotFound
+	Get(key []byte) ([]byte, error)
+	// Set stores the value under the key. The key expires
+	// after the ttl unless it is zero.
+	Set(key, value []byte, ttl time.Duration) error
+	// Delete removes the key if it exists
+	Delete(key []byte) error
+	// Iterate calls the function for the keys with the
+	// prefix in order until it returns an error
+	Iterate(prefix []byte, f func(key, value []byte) error) error
+}
+
+// Store is a key-value store with transactions
+type Store interface {
+	// View runs the function in a read-only transaction
+	View(f func(Tx) error) error
+	// Update runs the function in a read-write transaction,
+	// which is committed if the function returns nil
+	Update(f func(Tx) error) error
+	// Close closes the store
+	Close() error
+}
+
+// Separator separates the name of a bucket from its keys
+const Separator = "/"
+
+// backends opens the stores by the name of their backend
+var backends = map[string]func(path string) (Store, error){
+	"badger": func(path string) (Store, error) { return OpenBadger(path) },
+	"bolt":   func(path string) (Store, error) { return OpenBolt(path) },
+	"sqlite": func(path string) (Store, error) { return OpenSQLite(path) },
+	"memory": func(string) (Store, error) { return NewMemory(), nil },
+}
+
+// Open opens the store described by the source
+func Open(source string) (Store, error) {
+	if index := strings.Index(source, ":"); index >= 0 {
+		if open, ok := backends[source[:index]]; ok {
+			return open(source[index+1:])
+		}
+	}
+
+	if source == "" {
+		return nil, fmt.Errorf("%w: no database configured", ErrUnknownBackend)
+	}
+
+	return OpenBadger(source)
+}
+
+// Bucket is a namespace of a store. Its keys are prefixed with
+// its name and the separator, and it only sees its own keys.
+type Bucket struct {
+	store  Store
+	prefix []byte
+}
+
+// NewBucket returns the bucket of the store with the name
+func NewBucket(store Store, name string) *Bucket {
+	return &Bucket{
+		store:  store,
+		prefix: []byte(name + Separator),
+	}
+}
+
+// Bucket returns a bucket nested in this bucket
+func (b *Bucket) Bucket(name string) *Bucket {
+	return &Bucket{
+		store:  b.store,
+		prefix: append(append([]byte{}, b.prefix...), name+Separator...),
+	}
+}
+
+// View runs the function in a read-only transaction of the bucket
+func (b *Bucket) View(f func(Tx) error) error {
+	return b.store.View(func(tx Tx) error {
+		return f(&bucketTx{tx: tx, prefix: b.prefix})
+	})
+}
+
+// Update runs the function in a read-write transaction of the bucket
+func (b *Bucket) Update(f func(Tx) error) error {
+	return b.store.Update(func(tx Tx) error {
+		return f(&bucketTx{tx: tx, prefix: b.prefix})
+	})
+}
+
+// Get decodes the JSON value of the key into the value
+func (b *Bucket) Get(key string, value interface{}) error {
+	return b.View(func(tx Tx) error {
+		return GetJSON(tx, key, value)
+	})
+}
+
+// Put stores the value of the key as JSON
+func (b *Bucket) Put(key string, value interface{}) error {
+	return b.PutTTL(key, value, 0)
+}
+
+// PutTTL stores the value of the key as JSON until the ttl
+// has passed
+func (b *Bucket) PutTTL(key string, value interface{}, ttl time.Duration) error {
+	return b.Update(func(tx Tx) error {
+		return SetJSON(tx, key, value, ttl)
+	})
+}
+
+// Delete removes the key
+func (b *Bucket) Delete(key string) error {
+	return b.Update(func(tx Tx) error {
+		return tx.Delete([]byte(key))
+	})
+}
+
+// Each calls the function for the keys with the prefix in order
+func (b *Bucket) Each(prefix string, f func(key string, value Value) error) error {
+	return b.View(func(tx Tx) error {
+		return tx.Iterate([]byte(prefix), func(key, value []byte) error {
+			return f(string(key), value)
+		})
+	})
+}
+
+// Value is a stored JSON value
+type Value []byte
+
+// Decode decodes the value into the target
+func (v Value) Decode(target interface{}) error {
+	return json.Unmarshal(v, target)
+}
+
+// GetJSON decodes the JSON value of the key into the value
+func GetJSON(tx Tx, key string, value interface{}) error {
+	data, err := tx.Get([]byte(key))
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, value)
+}
+
+// SetJSON stores the value of the key as JSON until the ttl
+// has passed, or forever if it is zero
+func SetJSON(tx Tx, key string, value interface{}, ttl time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return tx.Set([]byte(key), data, ttl)
+}
+
+// bucketTx prefixes the keys of a transaction
+type bucketTx struct {
+	tx     Tx
+	prefix []byte
+}
+
+// key returns the key in the store
+func (t *bucketTx) key(key []byte) []byte {
+	return append(append(make([]byte, 0, len(t.prefix)+len(key)), t.prefix...), key...)
+}
+
+func (t *bucketTx) Get(key []byte) ([]byte, error) {
+	return t.tx.Get(t.key(key))
+}
+
+func (t *bucketTx) Set(key, value []byte, ttl time.Duration) error {
+	return t.tx.Set(t.key(key), value, ttl)
+}
+
+func (t *bucketTx) Delete(key []byte) error {
+	return t.tx.Delete(t.key(key))
+}
+
+func (t *bucketTx) Iterate(prefix []byte, f func(key, value []byte) error) error {
+	return t.tx.Iterate(t.key(prefix), func(key, value []byte) error {
+		return f(key[len(t.prefix):], value)
+	})
+}
+
+// expiry returns when a key set now with the ttl expires, or
+// the zero time if it never does
+func expiry(now time.Time, ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+
+	return now.Add(ttl)
+}
+
+// upperBound returns the first key after all the keys with the
+// prefix, or nil if there is none
+func upperBound(prefix []byte) []byte {
+	bound := append([]byte{}, prefix...)
+
+	for i := len(bound) - 1; i >= 0; i-- {
+		if bound[i] < 0xff {
+			bound[i]++
+			return bound[:i+1]
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,227 @@
+package storage
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// item is a value stored as JSON by the tests
+type item struct {
+	Name  string
+	Count int
+}
+
+func TestStores(t *testing.T) {
+	for _, backend := range []string{"badger", "bolt", "sqlite", "memory"} {
+		Convey("With a "+backend+" store", t, func() {
+			dir, err := ioutil.TempDir("", "geoffrey")
+			So(err, ShouldBeNil)
+
+			path := filepath.Join(dir, "store")
+			if backend == "badger" {
+				path = dir
+			}
+
+			store, err := Open(backend + ":" + path)
+			So(err, ShouldBeNil)
+
+			Convey("Should get what was set in "+backend, func() {
+				So(store.Update(func(tx Tx) error {
+					return tx.Set([]byte("key"), []byte("value"), 0)
+				}), ShouldBeNil)
+
+				So(store.View(func(tx Tx) error {
+					value, err := tx.Get([]byte("key"))
+					So(string(value), ShouldEqual, "value")
+					return err
+				}), ShouldBeNil)
+			})
+
+			Convey("Should store empty values in "+backend, func() {
+				So(store.Update(func(tx Tx) error {
+					return tx.Set([]byte("empty"), []byte{}, 0)
+				}), ShouldBeNil)
+
+				So(store.View(func(tx Tx) error {
+					value, err := tx.Get([]byte("empty"))
+					So(value, ShouldBeEmpty)
+					return err
+				}), ShouldBeNil)
+			})
+
+			Convey("Should not find missing keys in "+backend, func() {
+				So(store.View(func(tx Tx) error {
+					_, err := tx.Get([]byte("missing"))
+					return err
+				}), ShouldEqual, ErrNotFound)
+			})
+
+			Convey("Should refuse changes in read-only transactions in "+backend, func() {
+				So(store.View(func(tx Tx) error {
+					return tx.Set([]byte("key"), []byte("value"), 0)
+				}), ShouldEqual, ErrReadOnly)
+			})
+
+			Convey("Should roll back failed transactions in "+backend, func() {
+				failure := errors.New("failure")
+
+				So(store.Update(func(tx Tx) error {
+					So(tx.Set([]byte("key"), []byte("value"), 0), ShouldBeNil)
+					return failure
+				}), ShouldEqual, failure)
+
+				So(store.View(func(tx Tx) error {
+					_, err := tx.Get([]byte("key"))
+					return err
+				}), ShouldEqual, ErrNotFound)
+			})
+
+			Convey("Should delete keys in "+backend, func() {
+				bucket := NewBucket(store, "test")
+				So(bucket.Put("key", item{Name: "geoffrey"}), ShouldBeNil)
+				So(bucket.Delete("key"), ShouldBeNil)
+
+				var value item
+				So(bucket.Get("key", &value), ShouldEqual, ErrNotFound)
+			})
+
+			Convey("Should expire keys after their ttl in "+backend, func() {
+				bucket := NewBucket(store, "test")
+				So(bucket.PutTTL("short", item{Name: "short"}, time.Second), ShouldBeNil)
+				So(bucket.PutTTL("long", item{Name: "long"}, time.Hour), ShouldBeNil)
+
+				var value item
+				So(bucket.Get("short", &value), ShouldBeNil)
+				So(value.Name, ShouldEqual, "short")
+
+				time.Sleep(1100 * time.Millisecond)
+
+				So(bucket.Get("short", &value), ShouldEqual, ErrNotFound)
+				So(bucket.Get("long", &value), ShouldBeNil)
+				So(value.Name, ShouldEqual, "long")
+			})
+
+			Convey("Should keep the buckets apart in "+backend, func() {
+				titles := NewBucket(store, "title")
+				github := NewBucket(store, "github")
+
+				So(titles.Put("https://github.com", item{Name: "title"}), ShouldBeNil)
+				So(github.Put("https://github.com", item{Name: "github"}), ShouldBeNil)
+
+				var value item
+				So(titles.Get("https://github.com", &value), ShouldBeNil)
+				So(value.Name, ShouldEqual, "title")
+				So(github.Get("https://github.com", &value), ShouldBeNil)
+				So(value.Name, ShouldEqual, "github")
+
+				So(store.View(func(tx Tx) error {
+					_, err := tx.Get([]byte("title/https://github.com"))
+					return err
+				}), ShouldBeNil)
+			})
+
+			Convey("Should iterate the keys with the prefix in order in "+backend, func() {
+				bucket := NewBucket(store, "test")
+				for i, key := range []string{"b/2", "a/1", "b/1", "c", "b"} {
+					So(bucket.Put(key, item{Name: key, Count: i}), ShouldBeNil)
+				}
+				So(NewBucket(store, "other").Put("b/3", item{}), ShouldBeNil)
+				So(bucket.Bucket("b").Put("4", item{}), ShouldBeNil)
+
+				var keys []string
+				So(bucket.Each("b/", func(key string, value Value) error {
+					var decoded item
+					So(value.Decode(&decoded), ShouldBeNil)
+
+					keys = append(keys, key)
+					return nil
+				}), ShouldBeNil)
+				So(keys, ShouldResemble, []string{"b/1", "b/2", "b/4"})
+			})
+
+			Convey("Should read its own writes in "+backend, func() {
+				So(store.Update(func(tx Tx) error {
+					So(SetJSON(tx, "a", item{Count: 1}, 0), ShouldBeNil)
+					So(SetJSON(tx, "b", item{Count: 2}, 0), ShouldBeNil)
+
+					var value item
+					So(GetJSON(tx, "a", &value), ShouldBeNil)
+					So(value.Count, ShouldEqual, 1)
+
+					count := 0
+					So(tx.Iterate(nil, func(key, value []byte) error {
+						count++
+						return nil
+					}), ShouldBeNil)
+					So(count, ShouldEqual, 2)
+
+					return nil
+				}), ShouldBeNil)
+			})
+
+			Reset(func() {
+				So(store.Close(), ShouldBeNil)
+				os.RemoveAll(dir)
+			})
+		})
+	}
+}
+
+func TestOpen(t *testing.T) {
+	Convey("With the sources of the stores", t, func() {
+		Convey("Should open badger without a backend", func() {
+			dir, err := ioutil.TempDir("", "geoffrey")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(dir)
+
+			store, err := Open(dir)
+			So(err, ShouldBeNil)
+			defer store.Close()
+
+			So(store, ShouldHaveSameTypeAs, &Badger{})
+		})
+
+		Convey("Should open the memory store", func() {
+			store, err := Open("memory:")
+			So(err, ShouldBeNil)
+			So(store, ShouldHaveSameTypeAs, &Memory{})
+		})
+
+		Convey("Should refuse an empty source", func() {
+			_, err := Open("")
+			So(errors.Is(err, ErrUnknownBackend), ShouldBeTrue)
+		})
+	})
+}
+
+func TestMemoryClock(t *testing.T) {
+	Convey("With a memory store on a fake clock", t, func() {
+		now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+		store := NewMemory()
+		store.Now = func() time.Time { return now }
+
+		bucket := NewBucket(store, "test")
+		So(bucket.PutTTL("key", item{}, time.Minute), ShouldBeNil)
+
+		Convey("Should keep the key until the ttl has passed", func() {
+			now = now.Add(59 * time.Second)
+
+			var value item
+			So(bucket.Get("key", &value), ShouldBeNil)
+		})
+
+		Convey("Should expire the key once the ttl has passed", func() {
+			now = now.Add(time.Minute)
+
+			var value item
+			So(bucket.Get("key", &value), ShouldEqual, ErrNotFound)
+		})
+	})
+}
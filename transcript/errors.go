@@ -0,0 +1,12 @@
+package transcript
+
+import "errors"
+
+var (
+	// ErrInvalidEntry occurs when a transcript line is not
+	// a timestamp, a direction and the raw line.
+	ErrInvalidEntry = errors.New("transcript: invalid entry")
+	// ErrInvalidDirection occurs when the direction is neither
+	// '<' for inbound nor '>' for outbound lines.
+	ErrInvalidDirection = errors.New("transcript: invalid direction")
+)
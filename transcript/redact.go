@@ -0,0 +1,93 @@
+package transcript
+
+import (
+	"strings"
+)
+
+// Redacted replaces the secrets in a transcript
+const Redacted = "<redacted>"
+
+// saslMechanisms are the AUTHENTICATE parameters that are not
+// credentials
+var saslMechanisms = map[string]bool{
+	"+":             true,
+	"*":             true,
+	"PLAIN":         true,
+	"EXTERNAL":      true,
+	"SCRAM-SHA-1":   true,
+	"SCRAM-SHA-256": true,
+	"SCRAM-SHA-512": true,
+}
+
+// servicesCommands are the services commands whose parameters
+// hold credentials
+var servicesCommands = map[string]bool{
+	"IDENTIFY": true,
+	"LOGIN":    true,
+	"REGISTER": true,
+	"GHOST":    true,
+	"RECOVER":  true,
+	"REGAIN":   true,
+	"RELEASE":  true,
+}
+
+// Redact returns the line with the credentials sent by the
+// client replaced, so transcripts can be shared. It covers the
+// parameters of PASS, OPER and AUTHENTICATE and the services
+// commands such as IDENTIFY sent by message or alias.
+func Redact(line string) string {
+	// Skip the tags and the prefix
+	start := 0
+	for _, marker := range []byte{'@', ':'} {
+		if start < len(line) && line[start] == marker {
+			end := strings.IndexByte(line[start:], ' ')
+			if end < 0 {
+				return line
+			}
+			start += end + 1
+		}
+	}
+
+	head, rest := line[:start], line[start:]
+	command, params := rest, ""
+	if index := strings.IndexByte(rest, ' '); index >= 0 {
+		command, params = rest[:index], rest[index+1:]
+	}
+
+	switch strings.ToUpper(command) {
+	case "PASS":
+		return head + command + " " + Redacted
+	case "OPER":
+		if fields := strings.Fields(params); len(fields) > 1 {
+			return head + command + " " + fields[0] + " " + Redacted
+		}
+	case "AUTHENTICATE":
+		if !saslMechanisms[strings.ToUpper(strings.TrimPrefix(params, ":"))] {
+			return head + command + " " + Redacted
+		}
+	case "PRIVMSG", "NOTICE", "SQUERY":
+		// Keep the target and redact the text sent to services
+		if index := strings.IndexByte(params, ' '); index > 0 && !strings.ContainsRune("#&+!", rune(params[0])) {
+			return head + command + " " + params[:index+1] + redactServices(params[index+1:])
+		}
+	case "NICKSERV", "NS", "CHANSERV", "CS":
+		return head + command + " " + redactServices(params)
+	}
+
+	return line
+}
+
+// redactServices redacts the parameters of a services command
+func redactServices(text string) string {
+	colon := ""
+	if strings.HasPrefix(text, ":") {
+		colon, text = ":", text[1:]
+	}
+
+	fields := strings.Fields(text)
+	if len(fields) > 1 && servicesCommands[strings.ToUpper(fields[0])] {
+		return colon + fields[0] + " " + Redacted
+	}
+
+	return colon + text
+}
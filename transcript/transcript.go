@@ -0,0 +1,144 @@
+// Package transcript records and reads the raw traffic of
+// IRC sessions. Every line of a transcript is an entry:
+//
+//	<entry>     ::= <timestamp> ' ' <direction> ' ' <line>
+//	<timestamp> ::= RFC 3339 with nanoseconds
+//	<direction> ::= '<' for inbound | '>' for outbound
+package transcript
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Direction is the direction of a recorded line
+type Direction byte
+
+const (
+	// Inbound lines were sent by the server
+	Inbound Direction = '<'
+	// Outbound lines were sent by the client
+	Outbound Direction = '>'
+)
+
+// Entry is a single recorded line
+type Entry struct {
+	Time      time.Time
+	Direction Direction
+	Line      string
+}
+
+// String returns the entry as written to the transcript
+func (e Entry) String() string {
+	return fmt.Sprintf("%s %c %s", e.Time.UTC().Format(time.RFC3339Nano), e.Direction, e.Line)
+}
+
+// Parse parses a single transcript line into an entry
+func Parse(line string) (Entry, error) {
+	fields := strings.SplitN(strings.TrimRight(line, "\r\n"), " ", 3)
+	if len(fields) != 3 || len(fields[1]) != 1 {
+		return Entry{}, ErrInvalidEntry
+	}
+
+	timestamp, err := time.Parse(time.RFC3339Nano, fields[0])
+	if err != nil {
+		return Entry{}, ErrInvalidEntry
+	}
+
+	direction := Direction(fields[1][0])
+	if direction != Inbound && direction != Outbound {
+		return Entry{}, ErrInvalidDirection
+	}
+
+	return Entry{
+		Time:      timestamp,
+		Direction: direction,
+		Line:      fields[2],
+	}, nil
+}
+
+// Read returns every entry of the transcript, skipping empty
+// lines and comments starting with '#'
+func Read(reader io.Reader) ([]Entry, error) {
+	var entries []Entry
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for number := 1; scanner.Scan(); number++ {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		entry, err := Parse(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", number, err)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, scanner.Err()
+}
+
+// Recorder writes the lines of a session to a transcript
+type Recorder struct {
+	lock    sync.Mutex
+	writer  io.Writer
+	secrets []string
+	now     func() time.Time
+}
+
+// NewRecorder creates a recorder writing to the writer. The
+// secrets are redacted wherever they appear in a line.
+func NewRecorder(writer io.Writer, secrets ...string) *Recorder {
+	recorder := &Recorder{
+		writer: writer,
+		now:    time.Now,
+	}
+
+	for _, secret := range secrets {
+		if secret != "" {
+			recorder.secrets = append(recorder.secrets, secret)
+		}
+	}
+
+	return recorder
+}
+
+// Record writes the raw line without its line ending and with
+// the credentials sent by the client redacted
+func (r *Recorder) Record(direction Direction, line []byte) error {
+	entry := Entry{
+		Direction: direction,
+		Line:      r.Redact(string(bytes.TrimRight(line, "\r\n"))),
+	}
+
+	if direction == Outbound {
+		entry.Line = Redact(entry.Line)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	entry.Time = r.now()
+	_, err := io.WriteString(r.writer, entry.String()+"\n")
+
+	return err
+}
+
+// Redact returns the line with the secrets of the recorder
+// replaced
+func (r *Recorder) Redact(line string) string {
+	for _, secret := range r.secrets {
+		line = strings.Replace(line, secret, Redacted, -1)
+	}
+
+	return line
+}
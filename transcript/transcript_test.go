@@ -0,0 +1,105 @@
+package transcript
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTranscript(t *testing.T) {
+	Convey("With a recorder", t, func() {
+		var buffer bytes.Buffer
+		recorder := NewRecorder(&buffer)
+		recorder.now = func() time.Time {
+			return time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)
+		}
+
+		Convey("Should write timestamped lines without line endings", func() {
+			So(recorder.Record(Inbound, []byte(":geoffrey.com 001 geoffrey :Welcome\r\n")), ShouldBeNil)
+			So(recorder.Record(Outbound, []byte("JOIN #geoffrey\r\n")), ShouldBeNil)
+
+			So(buffer.String(), ShouldEqual, ""+
+				"2020-01-02T03:04:05.000000006Z < :geoffrey.com 001 geoffrey :Welcome\n"+
+				"2020-01-02T03:04:05.000000006Z > JOIN #geoffrey\n")
+		})
+
+		Convey("Should read back what it wrote", func() {
+			So(recorder.Record(Outbound, []byte("PRIVMSG #geoffrey :hello world\r\n")), ShouldBeNil)
+
+			entries, err := Read(&buffer)
+			So(err, ShouldBeNil)
+			So(entries, ShouldHaveLength, 1)
+			So(entries[0].Time.Equal(recorder.now()), ShouldBeTrue)
+			So(entries[0].Direction, ShouldEqual, Outbound)
+			So(entries[0].Line, ShouldEqual, "PRIVMSG #geoffrey :hello world")
+		})
+
+		Convey("Should redact the credentials sent", func() {
+			So(recorder.Record(Outbound, []byte("PASS hunter2\r\n")), ShouldBeNil)
+			So(recorder.Record(Outbound, []byte("AUTHENTICATE PLAIN\r\n")), ShouldBeNil)
+			So(recorder.Record(Outbound, []byte("AUTHENTICATE Z2VvZmZyZXkAZ2VvZmZyZXkAaHVudGVyMg==\r\n")), ShouldBeNil)
+			So(recorder.Record(Outbound, []byte("PRIVMSG NickServ :IDENTIFY geoffrey hunter2\r\n")), ShouldBeNil)
+
+			So(buffer.String(), ShouldNotContainSubstring, "hunter2")
+			So(buffer.String(), ShouldEqual, ""+
+				"2020-01-02T03:04:05.000000006Z > PASS <redacted>\n"+
+				"2020-01-02T03:04:05.000000006Z > AUTHENTICATE PLAIN\n"+
+				"2020-01-02T03:04:05.000000006Z > AUTHENTICATE <redacted>\n"+
+				"2020-01-02T03:04:05.000000006Z > PRIVMSG NickServ :IDENTIFY <redacted>\n")
+		})
+
+		Convey("Should redact the secrets in both directions", func() {
+			recorder = NewRecorder(&buffer, "hunter2", "")
+			recorder.now = time.Now
+
+			So(recorder.Record(Outbound, []byte("PRIVMSG NickServ :ID hunter2\r\n")), ShouldBeNil)
+			So(recorder.Record(Inbound, []byte(":NickServ!s@services. NOTICE geoffrey :Wrong password hunter2\r\n")), ShouldBeNil)
+
+			So(buffer.String(), ShouldNotContainSubstring, "hunter2")
+			So(strings.Count(buffer.String(), Redacted), ShouldEqual, 2)
+		})
+	})
+
+	Convey("With lines to redact", t, func() {
+		Convey("Should keep the lines without credentials", func() {
+			for _, line := range []string{
+				"NICK geoffrey",
+				"PRIVMSG #geoffrey :identify yourself",
+				"PRIVMSG NickServ :INFO geoffrey",
+				"AUTHENTICATE +",
+				"NOTICE geoffrey",
+			} {
+				So(Redact(line), ShouldEqual, line)
+			}
+		})
+
+		Convey("Should redact the credentials of every command", func() {
+			So(Redact("@label=1 :geoffrey PASS :hunter2"), ShouldEqual, "@label=1 :geoffrey PASS <redacted>")
+			So(Redact("OPER geoffrey hunter2"), ShouldEqual, "OPER geoffrey <redacted>")
+			So(Redact("NICKSERV IDENTIFY hunter2"), ShouldEqual, "NICKSERV IDENTIFY <redacted>")
+			So(Redact("NS identify geoffrey hunter2"), ShouldEqual, "NS identify <redacted>")
+			So(Redact("PRIVMSG ChanServ :ghost geoffrey hunter2"), ShouldEqual, "PRIVMSG ChanServ :ghost <redacted>")
+			So(Redact("SQUERY NickServ LOGIN hunter2"), ShouldEqual, "SQUERY NickServ LOGIN <redacted>")
+		})
+	})
+
+	Convey("With a transcript", t, func() {
+		Convey("Should skip comments and empty lines", func() {
+			entries, err := Read(strings.NewReader("# Registration\n\n2020-01-02T03:04:05Z > NICK geoffrey\n"))
+			So(err, ShouldBeNil)
+			So(entries, ShouldHaveLength, 1)
+		})
+
+		Convey("Should reject invalid entries", func() {
+			_, err := Read(strings.NewReader("2020-01-02T03:04:05Z > NICK geoffrey\nNICK geoffrey\n"))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "line 2: transcript: invalid entry")
+
+			_, err = Parse("2020-01-02T03:04:05Z = NICK geoffrey")
+			So(err, ShouldEqual, ErrInvalidDirection)
+		})
+	})
+}